@@ -0,0 +1,39 @@
+// Package admin serves the admin web UI that is embedded into the binary. The
+// UI is a static page that logs in with /api/users/login and talks to the
+// admin and moderation APIs with the token, so it needs no session support.
+package admin
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+//go:embed ui
+var uiFS embed.FS
+
+func init() {
+	sub, err := fs.Sub(uiFS, "ui")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix("/admin/", http.FileServer(http.FS(sub)))
+
+	handler := func(w http.ResponseWriter, req treemux.Request) error {
+		h := w.Header()
+		// The UI only loads its own files and calls the API of this origin.
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Cache-Control", "no-cache")
+
+		files.ServeHTTP(w, req.Request)
+		return nil
+	}
+
+	// The catch-all route doesn't match the index page.
+	rwe.Router.GET("/admin/", handler)
+	rwe.Router.GET("/admin/*path", handler)
+}
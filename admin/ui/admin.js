@@ -0,0 +1,331 @@
+'use strict'
+
+// The token is kept for the browser tab only.
+const tokenKey = 'admin_token'
+
+function $(selector) {
+  return document.querySelector(selector)
+}
+
+// The API may be configured to return snake_case fields.
+function camelize(v) {
+  if (Array.isArray(v)) {
+    return v.map(camelize)
+  }
+  if (v && typeof v === 'object') {
+    const out = {}
+    for (const [key, value] of Object.entries(v)) {
+      out[key.replace(/_([a-z])/g, (_, c) => c.toUpperCase())] = camelize(value)
+    }
+    return out
+  }
+  return v
+}
+
+// Pass raw to keep the keys, e.g. when they are names from the config.
+async function api(method, path, body, raw) {
+  const headers = { 'Content-Type': 'application/json' }
+  const token = sessionStorage.getItem(tokenKey)
+  if (token) {
+    headers.Authorization = 'Token ' + token
+  }
+
+  const resp = await fetch('/api' + path, {
+    method,
+    headers,
+    body: body ? JSON.stringify(body) : undefined,
+  })
+  const text = await resp.text()
+  const data = text ? JSON.parse(text) : {}
+
+  if (resp.status === 401) {
+    logout()
+  }
+  if (!resp.ok) {
+    throw new Error(data.message || resp.statusText)
+  }
+  return raw ? data : camelize(data)
+}
+
+function showError(err) {
+  const el = $('#error')
+  el.textContent = err ? err.message : ''
+  el.hidden = !err
+}
+
+function cell(row, content) {
+  const td = row.insertCell()
+  if (content instanceof Node) {
+    td.append(content)
+  } else {
+    td.textContent = content
+  }
+  return td
+}
+
+function button(label, onClick) {
+  const el = document.createElement('button')
+  el.textContent = label
+  el.addEventListener('click', () => onClick().catch(showError))
+  return el
+}
+
+//------------------------------------------------------------------------------
+
+const roles = ['user', 'moderator', 'admin']
+let usersAfter = ''
+
+async function loadUsers(more) {
+  const username = $('#user-search').username.value
+  const params = new URLSearchParams({ username, after: more ? usersAfter : '' })
+  const data = await api('GET', '/admin/users?' + params)
+
+  const tbody = $('#users tbody')
+  if (!more) {
+    tbody.replaceChildren()
+  }
+
+  for (const user of data.users) {
+    const row = tbody.insertRow()
+    cell(row, user.username)
+    cell(row, user.email)
+
+    const select = document.createElement('select')
+    for (const role of roles) {
+      select.add(new Option(role, role, false, role === user.role))
+    }
+    select.addEventListener('change', () => {
+      const path = '/admin/users/' + encodeURIComponent(user.username) + '/role'
+      api('PUT', path, { user: { role: select.value } }).catch((err) => {
+        select.value = user.role
+        showError(err)
+      })
+    })
+    cell(row, select)
+  }
+
+  usersAfter = data.nextAfter
+  $('#users-more').hidden = !usersAfter
+}
+
+async function loadAppeals() {
+  const data = await api('GET', '/moderation/appeals')
+
+  const tbody = $('#appeals tbody')
+  tbody.replaceChildren()
+
+  for (const appeal of data.appeals) {
+    const row = tbody.insertRow()
+    cell(row, appeal.author)
+
+    const link = document.createElement('a')
+    link.href = '/articles/' + encodeURIComponent(appeal.articleSlug)
+    link.textContent = appeal.commentId
+      ? appeal.articleSlug + ' comment #' + appeal.commentId
+      : appeal.articleSlug
+    cell(row, link)
+
+    cell(row, appeal.hiddenReason)
+    cell(row, appeal.body)
+
+    const path = appeal.commentId
+      ? '/moderation/comments/' + appeal.commentId
+      : '/moderation/articles/' + encodeURIComponent(appeal.articleSlug)
+    cell(
+      row,
+      button('Restore', async () => {
+        await api('DELETE', path)
+        await loadAppeals()
+      })
+    )
+  }
+}
+
+async function loadVerifications() {
+  const data = await api('GET', '/admin/verifications')
+
+  const tbody = $('#verifications tbody')
+  tbody.replaceChildren()
+
+  for (const vr of data.verifications) {
+    const row = tbody.insertRow()
+    cell(row, vr.username)
+    cell(row, vr.evidence)
+    cell(row, new Date(vr.createdAt).toLocaleString())
+
+    const review = (status) => async () => {
+      // The note is shown to the user, e.g. why the request was rejected.
+      const note = window.prompt('Note for ' + vr.username, '')
+      if (note === null) {
+        return
+      }
+      await api('PUT', '/admin/verifications/' + vr.id, {
+        verification: { status, note },
+      })
+      await loadVerifications()
+    }
+    cell(row, button('Approve', review('approved'))).append(button('Reject', review('rejected')))
+  }
+}
+
+async function loadExperiments() {
+  const data = await api('GET', '/admin/experiments')
+
+  const tbody = $('#experiments tbody')
+  tbody.replaceChildren()
+
+  for (const exp of data.experiments) {
+    const row = tbody.insertRow()
+    cell(row, exp.name)
+    cell(row, exp.variants.join(', '))
+    cell(
+      row,
+      Object.entries(exp.exposures)
+        .map(([variant, count]) => variant + ': ' + count)
+        .join(', ')
+    )
+
+    const path = '/admin/experiments/' + encodeURIComponent(exp.name)
+    cell(
+      row,
+      exp.running
+        ? button('Stop', async () => {
+            await api('DELETE', path)
+            await loadExperiments()
+          })
+        : button('Start', async () => {
+            await api('PUT', path, {})
+            await loadExperiments()
+          })
+    )
+  }
+}
+
+async function loadTagRules() {
+  const data = await api('GET', '/admin/tags/rules')
+
+  const tbody = $('#tag-rules tbody')
+  tbody.replaceChildren()
+
+  for (const rule of data.rules) {
+    const row = tbody.insertRow()
+    cell(row, rule.tag)
+    cell(row, rule.kind === 'synonym' ? 'is a synonym of' : 'implies')
+    cell(row, rule.target)
+    cell(
+      row,
+      button('Delete', async () => {
+        await api('DELETE', '/admin/tags/rules/' + rule.id)
+        await loadTagRules()
+      })
+    )
+  }
+}
+
+async function loadFeatures() {
+  const data = await api('GET', '/admin/features', undefined, true)
+
+  const tbody = $('#features tbody')
+  tbody.replaceChildren()
+
+  for (const name of Object.keys(data.features).sort()) {
+    const row = tbody.insertRow()
+    cell(row, name)
+    cell(row, data.features[name] ? 'yes' : 'no')
+  }
+}
+
+async function loadStatus() {
+  const [slo, faults, shadow, pools, throttles, budgets] = await Promise.all([
+    api('GET', '/admin/slo'),
+    api('GET', '/admin/faults'),
+    api('GET', '/admin/shadow'),
+    api('GET', '/admin/pools'),
+    api('GET', '/admin/throttles'),
+    api('GET', '/admin/budgets'),
+  ])
+  $('#slo').textContent = JSON.stringify(slo.objectives, null, 2)
+  $('#faults').textContent = JSON.stringify(faults.faults, null, 2)
+  $('#shadow').textContent = shadow.shadow
+    ? JSON.stringify(shadow.shadow, null, 2)
+    : 'Shadow mode is disabled.'
+  $('#pools').textContent = JSON.stringify(pools.pools, null, 2)
+  $('#throttles').textContent = JSON.stringify(throttles.throttles, null, 2)
+  $('#budgets').textContent = JSON.stringify(budgets.budgets, null, 2)
+}
+
+//------------------------------------------------------------------------------
+
+function loadAll() {
+  showError(null)
+  Promise.all([
+    loadUsers(false),
+    loadAppeals(),
+    loadVerifications(),
+    loadExperiments(),
+    loadTagRules(),
+    loadFeatures(),
+    loadStatus(),
+  ]).catch(showError)
+}
+
+function render() {
+  const loggedIn = Boolean(sessionStorage.getItem(tokenKey))
+  $('#login').hidden = loggedIn
+  $('#main').hidden = !loggedIn
+  $('#logout').hidden = !loggedIn
+  if (loggedIn) {
+    loadAll()
+  }
+}
+
+function logout() {
+  sessionStorage.removeItem(tokenKey)
+  render()
+}
+
+$('#login').addEventListener('submit', async (event) => {
+  event.preventDefault()
+  const form = event.target
+  try {
+    const data = await api('POST', '/users/login', {
+      user: { email: form.email.value, password: form.password.value },
+    })
+    sessionStorage.setItem(tokenKey, data.user.token)
+    form.reset()
+    render()
+  } catch (err) {
+    showError(err)
+  }
+})
+
+$('#user-search').addEventListener('submit', (event) => {
+  event.preventDefault()
+  loadUsers(false).catch(showError)
+})
+
+$('#tag-rule-form').addEventListener('submit', async (event) => {
+  event.preventDefault()
+  const form = event.target
+  // Form properties like target would be ambiguous, so fields are read from elements.
+  const { kind, tag, target } = form.elements
+  try {
+    await api('POST', '/admin/tags/rules', {
+      rule: { kind: kind.value, tag: tag.value, target: target.value },
+    })
+    form.reset()
+    await loadTagRules()
+  } catch (err) {
+    showError(err)
+  }
+})
+
+$('#users-more').addEventListener('click', () => loadUsers(true).catch(showError))
+
+$('#faults-clear').addEventListener('click', () =>
+  api('PUT', '/admin/faults', { faults: [] }).then(loadStatus).catch(showError)
+)
+
+$('#logout').addEventListener('click', logout)
+
+render()
@@ -0,0 +1,80 @@
+// Package apperr defines errors returned by the service layer. Every error
+// carries a machine-readable code from the catalogue below and the HTTP layer
+// maps codes to statuses, see httperror.From.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Code string
+
+// Clients branch on these codes so they must not change once released.
+const (
+	Internal         Code = "INTERNAL"
+	NotFound         Code = "NOT_FOUND"
+	ValidationFailed Code = "VALIDATION_FAILED"
+	RequestTooLarge  Code = "REQUEST_TOO_LARGE"
+	Unauthorized     Code = "UNAUTHORIZED"
+	Forbidden        Code = "FORBIDDEN"
+	RateLimited      Code = "RATE_LIMITED"
+	ReadOnly         Code = "READ_ONLY"
+	Overloaded       Code = "OVERLOADED"
+
+	UnsupportedEncoding Code = "UNSUPPORTED_ENCODING"
+
+	UserNotFound  Code = "USER_NOT_FOUND"
+	EmailTaken    Code = "EMAIL_TAKEN"
+	UsernameTaken Code = "USERNAME_TAKEN"
+
+	ArticleForbidden Code = "ARTICLE_FORBIDDEN"
+	InvalidTag       Code = "INVALID_TAG"
+	TooManyTags      Code = "TOO_MANY_TAGS"
+	CommentsDisabled Code = "COMMENTS_DISABLED"
+	LegalHold        Code = "LEGAL_HOLD"
+)
+
+type Error struct {
+	Code    Code
+	Message string
+	// Field is the name of the invalid input for ValidationFailed errors.
+	Field string
+}
+
+func New(code Code, msg string, args ...interface{}) *Error {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	return &Error{
+		Code:    code,
+		Message: msg,
+	}
+}
+
+// Validation reports invalid input. Field is the name of a JSON field, query
+// param, or route param.
+func Validation(field, msg string, args ...interface{}) *Error {
+	err := New(ValidationFailed, msg, args...)
+	err.Field = field
+	return err
+}
+
+// Required reports a missing JSON field.
+func Required(field string) *Error {
+	return Validation(field, "JSON field %q is required", field)
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// CodeOf returns the code of the error or Internal for errors from outside the
+// catalogue.
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return Internal
+}
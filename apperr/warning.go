@@ -0,0 +1,46 @@
+package apperr
+
+import "fmt"
+
+// Warning codes are stable like error codes.
+const (
+	TagNormalized      Code = "TAG_NORMALIZED"
+	TagDuplicate       Code = "TAG_DUPLICATE"
+	LanguageNormalized Code = "LANGUAGE_NORMALIZED"
+)
+
+// Warning is an advisory message about input that was accepted after it was
+// changed, e.g. a normalized tag. Unlike errors, warnings don't fail the request
+// and are returned next to the result of write endpoints.
+type Warning struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// Warnings collects warnings of a request. Validators accept a nil collector
+// when there is nobody to report warnings to.
+type Warnings []*Warning
+
+func (ws *Warnings) Add(field string, code Code, msg string, args ...interface{}) {
+	if ws == nil {
+		return
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	*ws = append(*ws, &Warning{
+		Code:    code,
+		Message: msg,
+		Field:   field,
+	})
+}
+
+// List returns the warnings as a non-nil slice so responses always contain an
+// array.
+func (ws Warnings) List() []*Warning {
+	if ws == nil {
+		return make([]*Warning, 0)
+	}
+	return ws
+}
@@ -0,0 +1,277 @@
+package blog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+// What happens to articles and comments of a deleted account.
+const (
+	DeleteContent   = "delete"
+	TransferContent = "transfer"
+)
+
+const (
+	accountDeletionAction = "account_deletion"
+	accountDeletionJob    = "account_deletion"
+	accountDeletionTTL    = 15 * time.Minute
+)
+
+// AccountDeletion describes the content of the account. Articles and comments
+// are either deleted with their comment threads or transferred to the ghost
+// user, which keeps the threads readable.
+type AccountDeletion struct {
+	Content       string `json:"content"`
+	ArticlesCount int    `json:"articlesCount"`
+	CommentsCount int    `json:"commentsCount"`
+
+	// Token confirms the deletion, see deleteAccountHandler.
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// planAccountDeletionHandler is the first step of deleting the account. It
+// reports what is going to be deleted and returns the token that confirms
+// the deletion with the chosen option.
+func planAccountDeletionHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	var in struct {
+		Deletion *struct {
+			Content string `json:"content"`
+		} `json:"deletion"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Deletion == nil {
+		return apperr.Required("deletion")
+	}
+
+	deletion := &AccountDeletion{
+		Content: in.Deletion.Content,
+	}
+	if err := countAccountContent(ctx, rwe.PGMain(), user.ID, deletion); err != nil {
+		return err
+	}
+
+	token, err := org.CreateConfirmationToken(
+		user.ID, accountDeletionAction, deletion.Content, accountDeletionTTL)
+	if err != nil {
+		return err
+	}
+	expiresAt := rwe.Clock.Now().Add(accountDeletionTTL)
+	deletion.Token = token
+	deletion.ExpiresAt = &expiresAt
+
+	return httputil.JSON(w, treemux.H{
+		"deletion": deletion,
+	})
+}
+
+// deleteAccountHandler is the second step that enqueues the deletion with the
+// option confirmed by the token. Content under legal hold is refused before
+// the job is enqueued.
+func deleteAccountHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	var in struct {
+		Deletion *struct {
+			Token string `json:"token"`
+		} `json:"deletion"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Deletion == nil {
+		return apperr.Required("deletion")
+	}
+
+	content, err := org.DecodeConfirmationToken(in.Deletion.Token, user.ID, accountDeletionAction)
+	if err != nil {
+		return err
+	}
+
+	deletion := &AccountDeletion{
+		Content: content,
+	}
+	if err := countAccountContent(ctx, rwe.PGMain(), user.ID, deletion); err != nil {
+		return err
+	}
+
+	if _, err := rwe.EnqueueJob(ctx, rwe.PGMain(), accountDeletionJob, &accountDeletionArgs{
+		UserID:  user.ID,
+		Content: content,
+	}); err != nil {
+		return err
+	}
+
+	return httputil.JSONStatus(w, http.StatusAccepted, treemux.H{
+		"deletion": deletion,
+	})
+}
+
+type accountDeletionArgs struct {
+	UserID  uint64 `json:"userId"`
+	Content string `json:"content"`
+}
+
+// runAccountDeletion is the job enqueued by deleteAccountHandler.
+func runAccountDeletion(ctx context.Context, args json.RawMessage) error {
+	var in accountDeletionArgs
+	if err := json.Unmarshal(args, &in); err != nil {
+		return err
+	}
+	_, err := DeleteAccount(ctx, in.UserID, in.Content)
+	return err
+}
+
+// DeleteAccount deletes the user and deletes or transfers the content. It runs
+// as a job and can run again for an account that is already deleted, which
+// does nothing.
+func DeleteAccount(ctx context.Context, userID uint64, content string) (*AccountDeletion, error) {
+	deletion := &AccountDeletion{
+		Content: content,
+	}
+
+	if err := rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Counted again because the content could change after the plan.
+		if err := countAccountContent(ctx, tx, userID, deletion); err != nil {
+			return err
+		}
+
+		if err := handleAccountContent(ctx, tx, userID, content); err != nil {
+			return err
+		}
+
+		// Follows, favorites, and subscriptions are deleted with the user.
+		_, err := tx.ModelContext(ctx, (*org.User)(nil)).
+			Where("id = ?", userID).
+			Delete()
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", userID)); err != nil {
+		return nil, err
+	}
+	return deletion, nil
+}
+
+// countAccountContent validates the deletion option and counts the content.
+// Content under legal hold can only be transferred.
+func countAccountContent(ctx context.Context, db orm.DB, userID uint64, deletion *AccountDeletion) error {
+	switch deletion.Content {
+	case DeleteContent, TransferContent:
+	default:
+		return apperr.Validation("content", "content must be %s or %s", DeleteContent, TransferContent)
+	}
+
+	var err error
+
+	deletion.ArticlesCount, err = db.ModelContext(ctx, (*Article)(nil)).
+		Where("author_id = ?", userID).
+		Count()
+	if err != nil {
+		return err
+	}
+
+	deletion.CommentsCount, err = db.ModelContext(ctx, (*Comment)(nil)).
+		Where("author_id = ?", userID).
+		Count()
+	if err != nil {
+		return err
+	}
+
+	if deletion.Content == TransferContent {
+		return nil
+	}
+
+	held, err := db.ModelContext(ctx, (*Article)(nil)).
+		Where("a.author_id = ?", userID).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			subq := pg.Model((*Comment)(nil)).
+				Where("c.article_id = a.id").
+				Where("c.legal_hold")
+
+			q = q.Where("a.legal_hold").
+				WhereOr("EXISTS (?)", subq)
+			return q, nil
+		}).
+		Exists()
+	if err != nil {
+		return err
+	}
+	if !held {
+		held, err = db.ModelContext(ctx, (*Comment)(nil)).
+			Where("c.author_id = ?", userID).
+			Where("c.legal_hold").
+			Exists()
+		if err != nil {
+			return err
+		}
+	}
+	if held {
+		return apperr.New(apperr.LegalHold,
+			"content is under legal hold and can only be transferred")
+	}
+	return nil
+}
+
+// handleAccountContent deletes the articles and comments or makes the ghost
+// user their author, so comment threads and favorites stay in place.
+func handleAccountContent(ctx context.Context, tx *pg.Tx, userID uint64, content string) error {
+	if content == DeleteContent {
+		// Replies of other users stay as top level comments.
+		if _, err := tx.ModelContext(ctx, (*Comment)(nil)).
+			Where("author_id = ?", userID).
+			Delete(); err != nil {
+			return err
+		}
+		if err := addArticleTombstones(ctx, tx, userID, ""); err != nil {
+			return err
+		}
+		// Comment threads are deleted with the articles.
+		_, err := tx.ModelContext(ctx, (*Article)(nil)).
+			Where("author_id = ?", userID).
+			Delete()
+		return err
+	}
+
+	ghost, err := org.GhostUser(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ModelContext(ctx, (*Article)(nil)).
+		Set("author_id = ?", ghost.ID).
+		Where("author_id = ?", userID).
+		Update(); err != nil {
+		return err
+	}
+	if _, err := tx.ModelContext(ctx, (*Comment)(nil)).
+		Set("author_id = ?", ghost.ID).
+		Where("author_id = ?", userID).
+		Update(); err != nil {
+		return err
+	}
+	return nil
+}
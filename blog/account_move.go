@@ -0,0 +1,397 @@
+package blog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const (
+	accountExportVersion = 1
+	// accountExportTTL limits how long a leaked export can be imported.
+	accountExportTTL = 7 * 24 * time.Hour
+)
+
+// AccountExport is the instance-to-instance migration format of a user
+// account. Follows reference users by username because ids differ between
+// instances.
+type AccountExport struct {
+	Version    int       `json:"version"`
+	Source     string    `json:"source"`
+	ExportedAt time.Time `json:"exportedAt"`
+
+	Profile   *ExportedProfile   `json:"profile"`
+	Articles  []*ExportedArticle `json:"articles"`
+	Following []string           `json:"following"`
+}
+
+type ExportedProfile struct {
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	Bio       string   `json:"bio"`
+	Image     string   `json:"image"`
+	Languages []string `json:"languages"`
+}
+
+type ExportedArticle struct {
+	Slug          string   `json:"slug"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Body          string   `json:"body"`
+	Language      string   `json:"language"`
+	TagList       []string `json:"tagList"`
+	CommentPolicy string   `json:"commentPolicy"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SignedAccountExport carries the export as base64 encoded JSON so the
+// signature survives re-encoding of the response, e.g. the snake_case option.
+type SignedAccountExport struct {
+	KeyID     string `json:"keyId"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// Redirect maps a URL on the source instance to the URL of the imported copy.
+type Redirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func exportAccountHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	keyID := rwe.Config.AccountExportKey
+	secret := rwe.Config.SigningKeys[keyID]
+	if keyID == "" || secret == "" {
+		return apperr.New(apperr.Forbidden, "account export is disabled on this instance")
+	}
+
+	export, err := selectAccountExport(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"export": &SignedAccountExport{
+			KeyID:     keyID,
+			Payload:   base64.StdEncoding.EncodeToString(payload),
+			Signature: rwe.SignPayload(secret, payload),
+		},
+	})
+}
+
+func selectAccountExport(ctx context.Context, user *org.User) (*AccountExport, error) {
+	export := &AccountExport{
+		Version:    accountExportVersion,
+		Source:     rwe.Config.SiteURL,
+		ExportedAt: rwe.Clock.Now(),
+		Profile: &ExportedProfile{
+			Username:  user.Username,
+			Email:     user.Email,
+			Bio:       user.Bio,
+			Image:     user.Image,
+			Languages: user.Languages,
+		},
+		Articles:  make([]*ExportedArticle, 0),
+		Following: make([]string, 0),
+	}
+
+	articles := make([]*Article, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &articles).
+		ColumnExpr("a.*").
+		ColumnExpr("(?) AS tag_list", pg.Model((*ArticleTag)(nil)).
+			ColumnExpr("array_agg(t.tag)::text[]").
+			Where("t.article_id = a.id")).
+		Where("a.author_id = ?", user.ID).
+		Where("a.hidden_at IS NULL").
+		OrderExpr("a.id ASC").
+		Select(); err != nil {
+		return nil, err
+	}
+
+	for _, article := range articles {
+		if article.TagList == nil {
+			article.TagList = make([]string, 0)
+		}
+		export.Articles = append(export.Articles, &ExportedArticle{
+			Slug:          article.Slug,
+			Title:         article.Title,
+			Description:   article.Description,
+			Body:          article.Body,
+			Language:      article.Language,
+			TagList:       article.TagList,
+			CommentPolicy: article.CommentPolicy,
+			CreatedAt:     article.CreatedAt,
+			UpdatedAt:     article.UpdatedAt,
+		})
+	}
+
+	if err := rwe.PGMain().ModelContext(ctx, (*org.User)(nil)).
+		Column("u.username").
+		Join("JOIN follow_users AS fu ON fu.followed_user_id = u.id").
+		Where("fu.user_id = ?", user.ID).
+		OrderExpr("u.username ASC").
+		Select(&export.Following); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+//------------------------------------------------------------------------------
+
+func importAccountHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	var in struct {
+		Export   *SignedAccountExport `json:"export"`
+		Password string               `json:"password"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<mb); err != nil {
+		return err
+	}
+
+	if in.Export == nil {
+		return apperr.Required("export")
+	}
+	if in.Password == "" {
+		return apperr.Required("password")
+	}
+
+	export, err := decodeAccountExport(ctx, in.Export)
+	if err != nil {
+		return err
+	}
+
+	user := &org.User{
+		Username:  export.Profile.Username,
+		Email:     export.Profile.Email,
+		Bio:       export.Profile.Bio,
+		Image:     export.Profile.Image,
+		Password:  in.Password,
+		Languages: export.Profile.Languages,
+	}
+	var redirects []*Redirect
+	var skipped []string
+
+	if err := rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := org.InsertUser(ctx, tx, user); err != nil {
+			return err
+		}
+
+		var err error
+		redirects, err = importArticles(ctx, tx, user, export)
+		if err != nil {
+			return err
+		}
+
+		skipped, err = importFollowing(ctx, tx, user, export.Following)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	token, err := org.CreateUserToken(user.ID, 24*time.Hour)
+	if err != nil {
+		return err
+	}
+	user.Token = token
+	user.Password = ""
+
+	redirects = append(redirects, &Redirect{
+		From: sourceURL(export.Source, "/profiles/", export.Profile.Username),
+		To:   sourceURL(rwe.Config.SiteURL, "/profiles/", user.Username),
+	})
+
+	return httputil.JSON(w, treemux.H{
+		"user":             org.NewUserResponse(user),
+		"redirects":        redirects,
+		"skippedFollowing": skipped,
+	})
+}
+
+// decodeAccountExport verifies the signature of the source instance and
+// validates the export before anything is inserted.
+func decodeAccountExport(ctx context.Context, signed *SignedAccountExport) (*AccountExport, error) {
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, apperr.Validation("payload", "payload must be base64 encoded")
+	}
+	if err := rwe.VerifyPayload(signed.KeyID, payload, signed.Signature); err != nil {
+		return nil, err
+	}
+
+	export := new(AccountExport)
+	if err := json.Unmarshal(payload, export); err != nil {
+		return nil, apperr.Validation("payload", "payload is not a valid account export")
+	}
+
+	if export.Version != accountExportVersion {
+		return nil, apperr.Validation("version",
+			"export version %d is not supported", export.Version)
+	}
+	if rwe.Clock.Now().Sub(export.ExportedAt) > accountExportTTL {
+		return nil, apperr.Validation("exportedAt",
+			"export is older than %s, export the account again", accountExportTTL)
+	}
+	if export.Profile == nil {
+		return nil, apperr.Required("profile")
+	}
+
+	for _, article := range export.Articles {
+		if article.CommentPolicy == "" {
+			article.CommentPolicy = CommentsEveryone
+		}
+		if err := validateCommentPolicy(article.CommentPolicy); err != nil {
+			return nil, err
+		}
+
+		article.TagList, err = normalizeTags(ctx, article.TagList, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if article.Language != "" {
+			article.Language, err = org.NormalizeLanguage(article.Language)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return export, nil
+}
+
+// importArticles recreates the articles keeping their slugs when they are not
+// taken on this instance.
+func importArticles(
+	ctx context.Context, tx *pg.Tx, user *org.User, export *AccountExport,
+) ([]*Redirect, error) {
+	redirects := make([]*Redirect, 0, len(export.Articles)+1)
+
+	for _, src := range export.Articles {
+		article := &Article{
+			Slug:          src.Slug,
+			Title:         src.Title,
+			Description:   src.Description,
+			Body:          src.Body,
+			Language:      src.Language,
+			TagList:       src.TagList,
+			CommentPolicy: src.CommentPolicy,
+			AuthorID:      user.ID,
+			CreatedAt:     src.CreatedAt,
+			UpdatedAt:     src.UpdatedAt,
+		}
+
+		if err := article.normalizeText(); err != nil {
+			return nil, err
+		}
+		if article.CreatedAt.IsZero() {
+			article.CreatedAt = rwe.Clock.Now()
+		}
+		if article.UpdatedAt.IsZero() {
+			article.UpdatedAt = article.CreatedAt
+		}
+
+		taken, err := tx.ModelContext(ctx, (*Article)(nil)).
+			Where("slug = ?", article.Slug).
+			Exists()
+		if err != nil {
+			return nil, err
+		}
+		if taken || httputil.Slug(article.Slug) != nil {
+			article.Slug = makeSlug(article.Title)
+		}
+
+		if _, err := tx.ModelContext(ctx, article).Insert(); err != nil {
+			return nil, err
+		}
+
+		if len(article.TagList) > 0 {
+			tags := make([]ArticleTag, 0, len(article.TagList))
+			for _, t := range article.TagList {
+				tags = append(tags, ArticleTag{ArticleID: article.ID, Tag: t})
+			}
+			if _, err := tx.ModelContext(ctx, &tags).Insert(); err != nil {
+				return nil, err
+			}
+		}
+
+		redirects = append(redirects, &Redirect{
+			From: sourceURL(export.Source, "/articles/", src.Slug),
+			To:   sourceURL(rwe.Config.SiteURL, "/articles/", article.Slug),
+		})
+	}
+
+	return redirects, nil
+}
+
+// importFollowing follows the users registered on this instance and returns
+// the usernames that are not.
+func importFollowing(
+	ctx context.Context, tx *pg.Tx, user *org.User, usernames []string,
+) ([]string, error) {
+	skipped := make([]string, 0)
+	if len(usernames) == 0 {
+		return skipped, nil
+	}
+
+	users := make([]*org.User, 0)
+	if err := tx.ModelContext(ctx, &users).
+		Column("id", "username").
+		Where("username IN (?)", pg.In(usernames)).
+		Where("id != ?", user.ID).
+		Select(); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(users))
+	follows := make([]*org.FollowUser, 0, len(users))
+	for _, u := range users {
+		found[u.Username] = true
+		follows = append(follows, &org.FollowUser{
+			UserID:         user.ID,
+			FollowedUserID: u.ID,
+			CreatedAt:      rwe.Clock.Now(),
+		})
+	}
+
+	if len(follows) > 0 {
+		if _, err := tx.ModelContext(ctx, &follows).
+			OnConflict("DO NOTHING").
+			Insert(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, username := range usernames {
+		if !found[username] {
+			skipped = append(skipped, username)
+		}
+	}
+	return skipped, nil
+}
+
+func sourceURL(site, prefix, name string) string {
+	return strings.TrimSuffix(site, "/") + prefix + name
+}
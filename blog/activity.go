@@ -0,0 +1,388 @@
+package blog
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const (
+	activityFavorite = "favorite"
+	activityFollow   = "follow"
+	activityComment  = "comment"
+	activitySearch   = "search"
+)
+
+// activityDigestWindow is the period in which favorites of the same article
+// and new followers are collapsed into a single event.
+const activityDigestWindow = time.Hour
+
+// Activity is a single event or a digest of similar events. Digests have the
+// latest actor and the number of actors; the individual events are returned by
+// selectActivityDigest.
+type Activity struct {
+	ID          string           `json:"id"`
+	Type        string           `json:"type"`
+	Actor       *org.Profile     `json:"actor"`
+	ActorsCount int              `json:"actorsCount"`
+	Article     *ActivityArticle `json:"article,omitempty"`
+	Comment     *ActivityComment `json:"comment,omitempty"`
+	// SearchQuery is the saved search that matched the article.
+	SearchQuery string    `json:"searchQuery,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type ActivityArticle struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type ActivityComment struct {
+	ID   uint64 `json:"id"`
+	Body string `json:"body"`
+}
+
+type activityRow struct {
+	tableName struct{} `pg:"_,alias:e"`
+
+	ID             string
+	Type           string
+	ActorUsername  string
+	ActorBio       string
+	ActorImage     string
+	ActorVerified  bool
+	ActorFollowing bool
+	ArticleSlug    string
+	ArticleTitle   string
+	CommentID      uint64
+	CommentBody    string
+	SearchQuery    string
+	CreatedAt      time.Time
+	ActorsCount    int
+}
+
+func (row *activityRow) activity() *Activity {
+	activity := &Activity{
+		ID:   row.ID,
+		Type: row.Type,
+		Actor: &org.Profile{
+			Username:  row.ActorUsername,
+			Bio:       row.ActorBio,
+			Image:     row.ActorImage,
+			Verified:  row.ActorVerified,
+			Following: row.ActorFollowing,
+		},
+		ActorsCount: row.ActorsCount,
+		SearchQuery: row.SearchQuery,
+		CreatedAt:   row.CreatedAt,
+	}
+	if row.ArticleSlug != "" {
+		activity.Article = &ActivityArticle{
+			Slug:  row.ArticleSlug,
+			Title: row.ArticleTitle,
+		}
+	}
+	if row.CommentID != 0 {
+		activity.Comment = &ActivityComment{
+			ID:   row.CommentID,
+			Body: row.CommentBody,
+		}
+	}
+	return activity
+}
+
+//------------------------------------------------------------------------------
+
+type ActivityFilter struct {
+	UserID uint64
+	Limit  int
+
+	CursorTime time.Time
+	CursorID   string
+
+	// Since selects only events newer than the time.
+	Since time.Time
+}
+
+func decodeActivityFilter(req treemux.Request) (*ActivityFilter, error) {
+	query := req.URL.Query()
+
+	f := &ActivityFilter{
+		UserID: org.UserFromContext(req.Context()).ID,
+		Limit:  httputil.QueryInt(req, "limit", 20),
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		if err := f.decodeCursor(s); err != nil {
+			return nil, apperr.Validation("cursor", "cursor is malformed")
+		}
+	}
+
+	return f, nil
+}
+
+func (f *ActivityFilter) decodeCursor(s string) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	parts := strings.SplitN(string(b), "|", 2)
+	if len(parts) != 2 {
+		return errors.New("cursor must contain time and id")
+	}
+
+	tm, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return err
+	}
+
+	f.CursorTime = tm
+	f.CursorID = parts[1]
+	return nil
+}
+
+func encodeActivityCursor(activity *Activity) string {
+	s := activity.CreatedAt.Format(time.RFC3339Nano) + "|" + activity.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// union merges favorites of the user's articles, new followers of the user,
+// comments on the user's articles, and new articles matching saved searches
+// into a single stream of events. All but comments are collapsed into digests.
+func (f *ActivityFilter) union() *orm.Query {
+	return f.favoriteDigests().
+		UnionAll(f.followDigests()).
+		UnionAll(f.comments()).
+		UnionAll(f.searchDigests())
+}
+
+// digestBucket numbers activityDigestWindow periods since the epoch.
+func digestBucket(column string) *orm.SafeQueryAppender {
+	return pg.SafeQuery("floor(extract(epoch FROM ?) / ?)::int8",
+		pg.Ident(column), int64(activityDigestWindow/time.Second))
+}
+
+func (f *ActivityFilter) favorites() *orm.Query {
+	return pg.Model((*FavoriteArticle)(nil)).
+		Join("JOIN articles AS a ON a.id = fa.article_id").
+		Where("a.author_id = ?", f.UserID).
+		Where("a.hidden_at IS NULL").
+		Where("fa.user_id != ?", f.UserID)
+}
+
+func (f *ActivityFilter) favoriteEvents() *orm.Query {
+	return f.favorites().
+		ColumnExpr("'favorite:' || fa.user_id || ':' || fa.article_id AS id").
+		ColumnExpr("?::text AS type", activityFavorite).
+		Apply(f.actorColumns).
+		ColumnExpr("a.slug AS article_slug, a.title AS article_title").
+		ColumnExpr("NULL::int8 AS comment_id, NULL::text AS comment_body").
+		ColumnExpr("fa.created_at, 1::int8 AS actors_count").
+		ColumnExpr("NULL::text AS search_query").
+		Join("JOIN users AS u ON u.id = fa.user_id")
+}
+
+// favoriteDigests returns one event per article and digest window with the
+// latest actor.
+func (f *ActivityFilter) favoriteDigests() *orm.Query {
+	bucket := digestBucket("fa.created_at")
+	ranked := f.favorites().
+		ColumnExpr("fa.*, ? AS bucket", bucket).
+		ColumnExpr("count(*) OVER (PARTITION BY fa.article_id, ?) AS actors_count", bucket).
+		ColumnExpr("row_number() OVER (PARTITION BY fa.article_id, ? "+
+			"ORDER BY fa.created_at DESC, fa.user_id DESC) AS digest_rank", bucket)
+
+	return pg.Model().
+		TableExpr("(?) AS fa", ranked).
+		ColumnExpr("'favorite:' || fa.article_id || ':' || fa.bucket AS id").
+		ColumnExpr("?::text AS type", activityFavorite).
+		Apply(f.actorColumns).
+		ColumnExpr("a.slug AS article_slug, a.title AS article_title").
+		ColumnExpr("NULL::int8 AS comment_id, NULL::text AS comment_body").
+		ColumnExpr("fa.created_at, fa.actors_count").
+		ColumnExpr("NULL::text AS search_query").
+		Join("JOIN articles AS a ON a.id = fa.article_id").
+		Join("JOIN users AS u ON u.id = fa.user_id").
+		Where("fa.digest_rank = 1")
+}
+
+func (f *ActivityFilter) followEvents() *orm.Query {
+	return pg.Model((*org.FollowUser)(nil)).
+		ColumnExpr("'follow:' || fu.user_id AS id").
+		ColumnExpr("?::text AS type", activityFollow).
+		Apply(f.actorColumns).
+		ColumnExpr("NULL::varchar AS article_slug, NULL::varchar AS article_title").
+		ColumnExpr("NULL::int8 AS comment_id, NULL::text AS comment_body").
+		ColumnExpr("fu.created_at, 1::int8 AS actors_count").
+		ColumnExpr("NULL::text AS search_query").
+		Join("JOIN users AS u ON u.id = fu.user_id").
+		Where("fu.followed_user_id = ?", f.UserID)
+}
+
+// followDigests returns one event per digest window with the latest follower.
+func (f *ActivityFilter) followDigests() *orm.Query {
+	bucket := digestBucket("fu.created_at")
+	ranked := pg.Model((*org.FollowUser)(nil)).
+		ColumnExpr("fu.*, ? AS bucket", bucket).
+		ColumnExpr("count(*) OVER (PARTITION BY ?) AS actors_count", bucket).
+		ColumnExpr("row_number() OVER (PARTITION BY ? "+
+			"ORDER BY fu.created_at DESC, fu.user_id DESC) AS digest_rank", bucket).
+		Where("fu.followed_user_id = ?", f.UserID)
+
+	return pg.Model().
+		TableExpr("(?) AS fu", ranked).
+		ColumnExpr("'follow:' || fu.bucket AS id").
+		ColumnExpr("?::text AS type", activityFollow).
+		Apply(f.actorColumns).
+		ColumnExpr("NULL::varchar AS article_slug, NULL::varchar AS article_title").
+		ColumnExpr("NULL::int8 AS comment_id, NULL::text AS comment_body").
+		ColumnExpr("fu.created_at, fu.actors_count").
+		ColumnExpr("NULL::text AS search_query").
+		Join("JOIN users AS u ON u.id = fu.user_id").
+		Where("fu.digest_rank = 1")
+}
+
+func (f *ActivityFilter) comments() *orm.Query {
+	return pg.Model((*Comment)(nil)).
+		ColumnExpr("'comment:' || c.id AS id").
+		ColumnExpr("?::text AS type", activityComment).
+		Apply(f.actorColumns).
+		ColumnExpr("a.slug AS article_slug, a.title AS article_title").
+		ColumnExpr("c.id AS comment_id, c.body AS comment_body").
+		ColumnExpr("c.created_at, 1::int8 AS actors_count").
+		ColumnExpr("NULL::text AS search_query").
+		Join("JOIN articles AS a ON a.id = c.article_id").
+		Join("JOIN users AS u ON u.id = c.author_id").
+		Where("a.author_id = ?", f.UserID).
+		Where("a.hidden_at IS NULL").
+		Where("c.author_id != ?", f.UserID).
+		Where("c.hidden_at IS NULL")
+}
+
+// digestEvents returns the query for individual events of the digest or nil
+// when the id is not a digest id.
+func (f *ActivityFilter) digestEvents(id string) *orm.Query {
+	parts := strings.Split(id, ":")
+	switch {
+	case len(parts) == 3 && parts[0] == activityFavorite:
+		articleID, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		bucket, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return f.favoriteEvents().
+			Where("fa.article_id = ?", articleID).
+			Where("? = ?", digestBucket("fa.created_at"), bucket)
+	case len(parts) == 3 && parts[0] == activitySearch:
+		searchID, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		bucket, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return f.searchEvents().
+			Where("ss.id = ?", searchID).
+			Where("? = ?", digestBucket("a.created_at"), bucket)
+	case len(parts) == 2 && parts[0] == activityFollow:
+		bucket, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		return f.followEvents().
+			Where("? = ?", digestBucket("fu.created_at"), bucket)
+	default:
+		return nil
+	}
+}
+
+func (f *ActivityFilter) actorColumns(q *orm.Query) (*orm.Query, error) {
+	subq := pg.Model((*org.FollowUser)(nil)).
+		Where("fu.followed_user_id = u.id").
+		Where("fu.user_id = ?", f.UserID)
+
+	q = q.ColumnExpr("u.username AS actor_username, u.bio AS actor_bio, u.image AS actor_image").
+		ColumnExpr("u.verified AS actor_verified").
+		ColumnExpr("EXISTS (?) AS actor_following", subq)
+	return q, nil
+}
+
+// selectActivity returns up to f.Limit events and the cursor for the next page.
+// The cursor is empty when there are no more events.
+func selectActivity(ctx context.Context, f *ActivityFilter) ([]*Activity, string, error) {
+	rows := make([]*activityRow, 0)
+	q := rwe.PGMain().ModelContext(ctx, &rows).
+		ColumnExpr("e.*").
+		TableExpr("(?)", f.union()).
+		OrderExpr("e.created_at DESC, e.id DESC").
+		Limit(f.Limit + 1)
+
+	if f.CursorID != "" {
+		q = q.Where("(e.created_at, e.id) < (?, ?)", f.CursorTime, f.CursorID)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("e.created_at > ?", f.Since)
+	}
+
+	if err := q.Select(); err != nil {
+		return nil, "", err
+	}
+
+	var hasMore bool
+	if len(rows) > f.Limit {
+		rows = rows[:f.Limit]
+		hasMore = true
+	}
+
+	activity := make([]*Activity, len(rows))
+	for i, row := range rows {
+		activity[i] = row.activity()
+	}
+
+	var cursor string
+	if hasMore {
+		cursor = encodeActivityCursor(activity[len(activity)-1])
+	}
+
+	return activity, cursor, nil
+}
+
+// selectActivityDigest returns individual events collapsed into the digest.
+func selectActivityDigest(ctx context.Context, f *ActivityFilter, id string) ([]*Activity, error) {
+	events := f.digestEvents(id)
+	if events == nil {
+		return nil, apperr.Validation("activity", "activity must be a favorite, follow, or search digest id")
+	}
+
+	rows := make([]*activityRow, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &rows).
+		ColumnExpr("e.*").
+		TableExpr("(?)", events).
+		OrderExpr("e.created_at DESC, e.id DESC").
+		Limit(100).
+		Select(); err != nil {
+		return nil, err
+	}
+
+	activity := make([]*Activity, len(rows))
+	for i, row := range rows {
+		activity[i] = row.activity()
+	}
+	return activity, nil
+}
@@ -0,0 +1,46 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+func userActivityHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	f, err := decodeActivityFilter(req)
+	if err != nil {
+		return err
+	}
+
+	activity, cursor, err := selectActivity(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	return rwe.JSON(w, req, treemux.H{
+		"activity":   activity,
+		"nextCursor": cursor,
+	})
+}
+
+func activityDigestHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	f := &ActivityFilter{
+		UserID: org.UserFromContext(ctx).ID,
+	}
+
+	activity, err := selectActivityDigest(ctx, f, req.Param("activity"))
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"activity": activity,
+	})
+}
@@ -0,0 +1,72 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const maxViewsBatch = 1000
+
+// ArticleViews is the number of views of the article since the previous batch.
+type ArticleViews struct {
+	Slug  string `json:"slug"`
+	Count int    `json:"count"`
+}
+
+// ingestViewsHandler adds the views reported by the analytics pipeline. The
+// route is signed, so a batch can be applied only once.
+func ingestViewsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	var in struct {
+		Views []*ArticleViews `json:"views"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 1<<mb); err != nil {
+		return err
+	}
+
+	if in.Views == nil {
+		return apperr.Required("views")
+	}
+	if len(in.Views) > maxViewsBatch {
+		return apperr.Validation("views", "batch can't have more than %d articles", maxViewsBatch)
+	}
+
+	counts := make(map[string]int, len(in.Views))
+	for i, v := range in.Views {
+		if v == nil || v.Slug == "" {
+			return apperr.Validation("views", "views #%d must have slug", i)
+		}
+		if v.Count < 0 {
+			return apperr.Validation("views", "views #%d count can't be negative", i)
+		}
+		counts[v.Slug] += v.Count
+	}
+
+	var updated int
+	if err := rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		updated = 0
+		for slug, count := range counts {
+			res, err := tx.ExecContext(ctx, `
+				UPDATE articles SET views_count = views_count + ? WHERE slug = ?
+			`, count, slug)
+			if err != nil {
+				return err
+			}
+			updated += res.RowsAffected()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"updated": updated,
+	})
+}
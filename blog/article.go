@@ -4,10 +4,15 @@ import (
 	"context"
 	"time"
 
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
 )
 
+var errArticleForbidden = apperr.New(apperr.ArticleForbidden, "only the author can change the article")
+
 type Article struct {
 	tableName struct{} `pg:"articles,alias:a"`
 
@@ -16,6 +21,10 @@ type Article struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	Body        string `json:"body"`
+	// Language is the ISO 639 code of the article language if known.
+	Language string `json:"language"`
+	// Metadata is a JSON object of custom fields set by the author.
+	Metadata map[string]interface{} `json:"metadata"`
 
 	Author   *org.Profile `json:"author" pg:"rel:has-one"`
 	AuthorID uint64       `json:"-"`
@@ -26,10 +35,35 @@ type Article struct {
 	Favorited      bool `json:"favorited" pg:"-"`
 	FavoritesCount int  `json:"favoritesCount" pg:"-"`
 
+	CommentsCount int             `json:"commentsCount" pg:"-"`
+	LatestComment *CommentPreview `json:"latestComment" pg:"-"`
+
+	// ViewsCount is reported by the analytics pipeline, see ingestViewsHandler.
+	ViewsCount int `json:"viewsCount"`
+
+	CommentPolicy   string `json:"commentPolicy"`
+	CommentsEnabled bool   `json:"commentsEnabled" pg:"-"`
+
+	HiddenAt     time.Time `json:"-"`
+	HiddenReason string    `json:"-"`
+	LegalHold    bool      `json:"-"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// normalizeText normalizes the text fields written by the author and checks
+// their lengths.
+func (a *Article) normalizeText() error {
+	if err := textutil.Line("title", &a.Title, maxTitleLength); err != nil {
+		return err
+	}
+	if err := textutil.Line("description", &a.Description, maxDescriptionLength); err != nil {
+		return err
+	}
+	return textutil.Text("body", &a.Body, 0)
+}
+
 type ArticleTag struct {
 	tableName struct{} `pg:"alias:t"`
 
@@ -37,17 +71,48 @@ type ArticleTag struct {
 	Tag       string
 }
 
+const ActionFavorite = "favorite"
+
+func redeemFavorite(ctx context.Context, tx *pg.Tx, userID uint64, slug string) error {
+	article := new(Article)
+	if err := tx.ModelContext(ctx, article).
+		Column("id").
+		Where("slug = ?", slug).
+		Where("hidden_at IS NULL").
+		Select(); err != nil {
+		return err
+	}
+
+	res, err := tx.ModelContext(ctx, &FavoriteArticle{
+		UserID:    userID,
+		ArticleID: article.ID,
+		CreatedAt: rwe.Clock.Now(),
+	}).OnConflict("DO NOTHING").Insert()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() != 0 && rwe.FeatureEnabled(FavoritesCountFlag) {
+		if err := addFavoritesCount(ctx, tx, article.ID, 1); err != nil {
+			return err
+		}
+	}
+
+	return deleteFavoriteTombstone(ctx, tx, userID, article.ID)
+}
+
 type FavoriteArticle struct {
 	tableName struct{} `pg:"alias:fa"`
 
 	UserID    uint64
 	ArticleID uint64
+	CreatedAt time.Time
 }
 
 func SelectArticle(c context.Context, slug string) (*Article, error) {
 	article := new(Article)
 	if err := rwe.PGMain().ModelContext(c, article).
 		Where("slug = ?", slug).
+		Where("hidden_at IS NULL").
 		Select(); err != nil {
 		return nil, err
 	}
@@ -56,11 +121,7 @@ func SelectArticle(c context.Context, slug string) (*Article, error) {
 
 func selectArticleByFilter(ctx context.Context, f *ArticleFilter) (*Article, error) {
 	article := new(Article)
-	if err := rwe.PGMain().
-		ModelContext(ctx, article).
-		ColumnExpr("?TableColumns").
-		Apply(f.query).
-		Select(); err != nil {
+	if err := f.selectOne(ctx, article); err != nil {
 		return nil, err
 	}
 
@@ -70,3 +131,18 @@ func selectArticleByFilter(ctx context.Context, f *ArticleFilter) (*Article, err
 
 	return article, nil
 }
+
+// checkArticleAuthor fails unless the user is the author of the article.
+func checkArticleAuthor(ctx context.Context, slug string, userID uint64) error {
+	var authorID uint64
+	if err := rwe.PGMain().ModelContext(ctx, (*Article)(nil)).
+		Column("author_id").
+		Where("slug = ?", slug).
+		Select(pg.Scan(&authorID)); err != nil {
+		return err
+	}
+	if authorID != userID {
+		return errArticleForbidden
+	}
+	return nil
+}
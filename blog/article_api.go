@@ -2,23 +2,33 @@ package blog
 
 import (
 	"context"
-	"errors"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/uptrace/go-realworld-example-app/experiment"
 	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/migrate"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 	"github.com/vmihailenco/treemux"
 
 	"github.com/go-pg/pg/v10"
 	"github.com/gosimple/slug"
+	"github.com/uptrace/go-realworld-example-app/apperr"
 )
 
 const (
 	kb = 10
 	mb = 20
+
+	// Request size limits are reported to clients by GET /api/meta.
+	maxArticleSize = 100 << kb
+	maxCommentSize = 10 << kb
+
+	maxTitleLength       = 500
+	maxDescriptionLength = 500
 )
 
 func makeSlug(title string) string {
@@ -34,18 +44,19 @@ func listArticlesHandler(w http.ResponseWriter, req treemux.Request) error {
 	}
 
 	articles := make([]*Article, 0)
-	if err := rwe.PGMain().ModelContext(ctx, &articles).
-		ColumnExpr("?TableColumns").
-		Apply(f.query).
-		Limit(f.Pager.GetLimit()).
-		Offset(f.Pager.GetOffset()).
-		Select(); err != nil {
+	if err := f.selectPage(ctx, &articles); err != nil {
+		return err
+	}
+
+	count, exact, err := countArticles(ctx, f, "articles")
+	if err != nil {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"articles":      articles,
-		"articlesCount": len(articles),
+	return rwe.JSON(w, req, treemux.H{
+		"articles":      NewArticleResponses(articles),
+		"articlesCount": count,
+		"exactCount":    exact,
 	})
 }
 
@@ -62,8 +73,8 @@ func showArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"article": article,
+	return httputil.JSON(w, treemux.H{
+		"article": NewArticleResponse(article),
 	})
 }
 
@@ -76,18 +87,30 @@ func articleFeedHandler(w http.ResponseWriter, req treemux.Request) error {
 	}
 	f.Feed = true
 
+	if req.URL.Query().Get("ranking") == "" && rwe.FeatureEnabled("feed_ranking") {
+		ranking, ok, err := experiment.Assign(ctx, w, FeedRankingExperiment, f.UserID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			f.Ranking = ranking
+		}
+	}
+
 	articles := make([]*Article, 0)
-	if err := rwe.PGMain().
-		ModelContext(ctx, &articles).
-		ColumnExpr("?TableColumns").
-		Apply(f.query).
-		Select(); err != nil {
+	if err := f.selectPage(ctx, &articles); err != nil {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"articles":      articles,
-		"articlesCount": len(articles),
+	count, exact, err := countArticles(ctx, f, "feed")
+	if err != nil {
+		return err
+	}
+
+	return rwe.JSON(w, req, treemux.H{
+		"articles":      NewArticleResponses(articles),
+		"articlesCount": count,
+		"exactCount":    exact,
 	})
 }
 
@@ -99,15 +122,43 @@ func createArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 		Article *Article `json:"article"`
 	}
 
-	if err := httputil.UnmarshalJSON(w, req, &in, 100<<kb); err != nil {
+	if err := httputil.UnmarshalJSON(w, req, &in, maxArticleSize); err != nil {
 		return err
 	}
 
 	if in.Article == nil {
-		return errors.New(`JSON field "article" is required`)
+		return apperr.Required("article")
 	}
 
 	article := in.Article
+	if err := article.normalizeText(); err != nil {
+		return err
+	}
+
+	if article.CommentPolicy == "" {
+		article.CommentPolicy = CommentsEveryone
+	}
+	if err := validateCommentPolicy(article.CommentPolicy); err != nil {
+		return err
+	}
+	if err := validateMetadata(article.Metadata); err != nil {
+		return err
+	}
+
+	var warnings apperr.Warnings
+
+	tags, err := normalizeTags(ctx, article.TagList, &warnings)
+	if err != nil {
+		return err
+	}
+	article.TagList = tags
+
+	if article.Language != "" {
+		article.Language, err = normalizeArticleLanguage(article.Language, &warnings)
+		if err != nil {
+			return err
+		}
+	}
 
 	article.Slug = makeSlug(article.Title)
 	article.AuthorID = user.ID
@@ -124,9 +175,11 @@ func createArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
+	article.CommentsEnabled = article.CommentPolicy != CommentsOff
 	article.Author = org.NewProfile(user)
-	return treemux.JSON(w, treemux.H{
-		"article": article,
+	return httputil.JSON(w, treemux.H{
+		"article":  NewArticleResponse(article),
+		"warnings": warnings.List(),
 	})
 }
 
@@ -138,22 +191,61 @@ func updateArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 		Article *Article `json:"article"`
 	}
 
-	if err := httputil.UnmarshalJSON(w, req, &in, 100<<kb); err != nil {
+	if err := httputil.UnmarshalJSON(w, req, &in, maxArticleSize); err != nil {
 		return err
 	}
 
 	if in.Article == nil {
-		return errors.New(`JSON field "article" is required`)
+		return apperr.Required("article")
+	}
+
+	if err := checkArticleAuthor(ctx, req.Param("slug"), user.ID); err != nil {
+		return err
 	}
 
 	article := in.Article
+	if err := article.normalizeText(); err != nil {
+		return err
+	}
 
-	if _, err := rwe.PGMain().
+	var warnings apperr.Warnings
+
+	tags, err := normalizeTags(ctx, article.TagList, &warnings)
+	if err != nil {
+		return err
+	}
+	article.TagList = tags
+
+	q := rwe.PGMain().
 		ModelContext(ctx, article).
 		Set("title = ?", article.Title).
 		Set("description = ?", article.Description).
 		Set("body = ?", article.Body).
-		Set("updated_at = ?", rwe.Clock.Now()).
+		Set("updated_at = ?", rwe.Clock.Now())
+
+	if article.CommentPolicy != "" {
+		if err := validateCommentPolicy(article.CommentPolicy); err != nil {
+			return err
+		}
+		q = q.Set("comment_policy = ?", article.CommentPolicy)
+	}
+
+	if article.Language != "" {
+		article.Language, err = normalizeArticleLanguage(article.Language, &warnings)
+		if err != nil {
+			return err
+		}
+		q = q.Set("language = ?", article.Language)
+	}
+
+	if article.Metadata != nil {
+		if err := validateMetadata(article.Metadata); err != nil {
+			return err
+		}
+		q = q.Set("metadata = ?", article.Metadata)
+	}
+
+	if _, err := q.
 		Where("slug = ?", req.Param("slug")).
 		Returning("*").
 		Update(); err != nil {
@@ -174,25 +266,47 @@ func updateArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 		article.TagList = make([]string, 0)
 	}
 
+	article.CommentsEnabled = article.CommentPolicy != CommentsOff
 	article.Author = org.NewProfile(user)
-	return treemux.JSON(w, treemux.H{
-		"article": article,
+	return httputil.JSON(w, treemux.H{
+		"article":  NewArticleResponse(article),
+		"warnings": warnings.List(),
 	})
 }
 
+func normalizeArticleLanguage(lang string, warnings *apperr.Warnings) (string, error) {
+	norm, err := org.NormalizeLanguage(lang)
+	if err != nil {
+		return "", err
+	}
+	if norm != lang {
+		warnings.Add("language", apperr.LanguageNormalized, "language %q normalized to %q", lang, norm)
+	}
+	return norm, nil
+}
+
 func deleteArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 	ctx := req.Context()
 	user := org.UserFromContext(ctx)
 
-	if _, err := rwe.PGMain().
-		ModelContext(ctx, (*Article)(nil)).
-		Where("author_id = ?", user.ID).
-		Where("slug = ?", req.Param("slug")).
-		Delete(); err != nil {
+	if err := checkArticleAuthor(ctx, req.Param("slug"), user.ID); err != nil {
+		return err
+	}
+	if err := checkArticleLegalHold(ctx, user.ID, req.Param("slug")); err != nil {
 		return err
 	}
 
-	return nil
+	// Tombstones let clients syncing favorites remove the article.
+	return rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := addArticleTombstones(ctx, tx, user.ID, req.Param("slug")); err != nil {
+			return err
+		}
+		_, err := tx.ModelContext(ctx, (*Article)(nil)).
+			Where("author_id = ?", user.ID).
+			Where("slug = ?", req.Param("slug")).
+			Delete()
+		return err
+	})
 }
 
 func createTags(ctx context.Context, article *Article) error {
@@ -234,21 +348,35 @@ func favoriteArticleHandler(w http.ResponseWriter, req treemux.Request) error {
 	favoriteArticle := &FavoriteArticle{
 		UserID:    user.ID,
 		ArticleID: article.ID,
-	}
-	res, err := rwe.PGMain().
-		ModelContext(ctx, favoriteArticle).
-		Insert()
-	if err != nil {
+		CreatedAt: rwe.Clock.Now(),
+	}
+	var res pg.Result
+	if err := migrate.DualWrite(ctx, FavoritesCountFlag, func(tx *pg.Tx) error {
+		var err error
+		res, err = tx.ModelContext(ctx, favoriteArticle).Insert()
+		if err != nil {
+			return err
+		}
+		return deleteFavoriteTombstone(ctx, tx, user.ID, article.ID)
+	}, func(tx *pg.Tx) error {
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+		return addFavoritesCount(ctx, tx, article.ID, 1)
+	}); err != nil {
 		return err
 	}
 
 	if res.RowsAffected() != 0 {
 		article.Favorited = true
 		article.FavoritesCount = article.FavoritesCount + 1
+		if article.AuthorID != user.ID {
+			rwe.PublishActivity(ctx, article.AuthorID)
+		}
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"article": article,
+	return httputil.JSON(w, treemux.H{
+		"article": NewArticleResponse(article),
 	})
 }
 
@@ -266,12 +394,26 @@ func unfavoriteArticleHandler(w http.ResponseWriter, req treemux.Request) error
 		return err
 	}
 
-	res, err := rwe.PGMain().
-		ModelContext(ctx, (*FavoriteArticle)(nil)).
-		Where("user_id = ?", user.ID).
-		Where("article_id = ?", article.ID).
-		Delete()
-	if err != nil {
+	var res pg.Result
+	if err := migrate.DualWrite(ctx, FavoritesCountFlag, func(tx *pg.Tx) error {
+		var err error
+		res, err = tx.ModelContext(ctx, (*FavoriteArticle)(nil)).
+			Where("user_id = ?", user.ID).
+			Where("article_id = ?", article.ID).
+			Delete()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+		return addFavoriteTombstone(ctx, tx, user.ID, article)
+	}, func(tx *pg.Tx) error {
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+		return addFavoritesCount(ctx, tx, article.ID, -1)
+	}); err != nil {
 		return err
 	}
 
@@ -280,8 +422,8 @@ func unfavoriteArticleHandler(w http.ResponseWriter, req treemux.Request) error
 		article.FavoritesCount = article.FavoritesCount - 1
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"article": article,
+	return httputil.JSON(w, treemux.H{
+		"article": NewArticleResponse(article),
 	})
 }
 
@@ -290,14 +432,44 @@ func listTagsHandler(w http.ResponseWriter, req treemux.Request) error {
 
 	tags := make([]string, 0)
 	if err := rwe.PGMain().ModelContext(ctx, (*ArticleTag)(nil)).
-		ColumnExpr("tag").
-		GroupExpr("tag").
-		OrderExpr("count(tag) DESC").
+		ColumnExpr("t.tag").
+		Join("JOIN articles AS a ON a.id = t.article_id").
+		Where("a.hidden_at IS NULL").
+		GroupExpr("t.tag").
+		OrderExpr("count(t.tag) DESC").
 		Select(&tags); err != nil && err != pg.ErrNoRows {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
+	return rwe.JSON(w, req, treemux.H{
 		"tags": tags,
 	})
 }
+
+func exportFavoritesHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	var since time.Time
+	if s := req.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = decodeSyncToken(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if httputil.WantsNDJSON(req) {
+		// Headers are sent with the first row, so the sync token can't follow
+		// the rows like in the JSON export.
+		w.Header().Set("X-Sync-Token", encodeSyncToken(rwe.Clock.Now()))
+		return streamFavoritesExport(ctx, httputil.NewNDJSONWriter(w, req), user.ID, since)
+	}
+
+	export, err := SelectFavoritesExport(ctx, user.ID, since)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, export)
+}
@@ -1,14 +1,26 @@
 package blog_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/go-pg/pg/v10"
+	"github.com/klauspost/compress/zstd"
+	"github.com/uptrace/go-realworld-example-app/blog"
+	"github.com/uptrace/go-realworld-example-app/experiment"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/jsonschema"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 	. "github.com/uptrace/go-realworld-example-app/testbed"
@@ -39,6 +51,10 @@ func init() {
 	}
 
 	ctx = rwe.Init(ctx, cfg)
+
+	if err := rwe.ParseTemplates(); err != nil {
+		panic(err)
+	}
 }
 
 var _ = Describe("createArticle", func() {
@@ -54,7 +70,7 @@ var _ = Describe("createArticle", func() {
 			Email:        "foo@bar.com",
 			PasswordHash: "h2",
 		}
-		_, err := rwe.PGMain().Model(followedUser).Insert()
+		_, err := rwe.PGMain().ModelContext(ctx, followedUser).Insert()
 		Expect(err).NotTo(HaveOccurred())
 
 		url := fmt.Sprintf("/api/profiles/%s/follow", followedUser.Username)
@@ -64,20 +80,36 @@ var _ = Describe("createArticle", func() {
 		return followedUser
 	}
 
+	setRole := func(user *org.User, role string) {
+		_, err := rwe.PGMain().ModelContext(ctx, user).
+			Set("role = ?", role).
+			WherePK().
+			Update()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+	}
+
 	BeforeEach(func() {
 		ResetAll(ctx)
 
 		helloArticleKeys = Keys{
-			"title":          Equal("Hello world"),
-			"slug":           HavePrefix("hello-world-"),
-			"description":    Equal("Hello world article description!"),
-			"body":           Equal("Hello world article body."),
-			"author":         Equal(map[string]interface{}{"following": false, "username": "CurrentUser", "bio": "", "image": ""}),
-			"tagList":        ConsistOf([]interface{}{"greeting", "welcome", "salut"}),
-			"favoritesCount": Equal(float64(0)),
-			"favorited":      Equal(false),
-			"createdAt":      Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
-			"updatedAt":      Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			"title":           Equal("Hello world"),
+			"slug":            HavePrefix("hello-world-"),
+			"description":     Equal("Hello world article description!"),
+			"body":            Equal("Hello world article body."),
+			"language":        Equal(""),
+			"author":          Equal(map[string]interface{}{"following": false, "username": "CurrentUser", "bio": "", "image": "", "verified": false}),
+			"tagList":         ConsistOf([]interface{}{"greeting", "welcome", "salut"}),
+			"favoritesCount":  Equal(float64(0)),
+			"favorited":       Equal(false),
+			"commentsCount":   Equal(float64(0)),
+			"latestComment":   BeNil(),
+			"commentPolicy":   Equal("everyone"),
+			"commentsEnabled": Equal(true),
+			"metadata":        BeEmpty(),
+			"viewsCount":      Equal(float64(0)),
+			"createdAt":       Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			"updatedAt":       Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
 		}
 
 		favoritedArticleKeys = ExtendKeys(helloArticleKeys, Keys{
@@ -86,16 +118,23 @@ var _ = Describe("createArticle", func() {
 		})
 
 		fooArticleKeys = Keys{
-			"title":          Equal("Foo bar"),
-			"slug":           HavePrefix("foo-bar-"),
-			"description":    Equal("Foo bar article description!"),
-			"body":           Equal("Foo bar article body."),
-			"author":         Equal(map[string]interface{}{"following": false, "username": "CurrentUser", "bio": "", "image": ""}),
-			"tagList":        ConsistOf([]interface{}{"foobar", "variable"}),
-			"favoritesCount": Equal(float64(0)),
-			"favorited":      Equal(false),
-			"createdAt":      Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
-			"updatedAt":      Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			"title":           Equal("Foo bar"),
+			"slug":            HavePrefix("foo-bar-"),
+			"description":     Equal("Foo bar article description!"),
+			"body":            Equal("Foo bar article body."),
+			"language":        Equal(""),
+			"author":          Equal(map[string]interface{}{"following": false, "username": "CurrentUser", "bio": "", "image": "", "verified": false}),
+			"tagList":         ConsistOf([]interface{}{"foobar", "variable"}),
+			"favoritesCount":  Equal(float64(0)),
+			"favorited":       Equal(false),
+			"commentsCount":   Equal(float64(0)),
+			"latestComment":   BeNil(),
+			"commentPolicy":   Equal("everyone"),
+			"commentsEnabled": Equal(true),
+			"metadata":        BeEmpty(),
+			"viewsCount":      Equal(float64(0)),
+			"createdAt":       Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			"updatedAt":       Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
 		}
 
 		user = &org.User{
@@ -103,7 +142,7 @@ var _ = Describe("createArticle", func() {
 			Email:        "hello@world.com",
 			PasswordHash: "#1",
 		}
-		_, err := rwe.PGMain().Model(user).Insert()
+		_, err := rwe.PGMain().ModelContext(ctx, user).Insert()
 		Expect(err).NotTo(HaveOccurred())
 	})
 
@@ -117,6 +156,205 @@ var _ = Describe("createArticle", func() {
 
 	It("creates new article", func() {
 		Expect(data["article"]).To(MatchAllKeys(helloArticleKeys))
+		Expect(data["warnings"]).To(BeEmpty())
+	})
+
+	It("filters lists by preferred languages", func() {
+		json := `{"article": {"title": "Hallo", "description": "Hallo", "body": "Hallo", "language": "de-DE"}}`
+		resp := PostWithToken("/api/articles", json, user.ID)
+		data := ParseJSON(resp, http.StatusOK)
+		Expect(data["article"].(map[string]interface{})["language"]).To(Equal("de"))
+
+		resp = PutWithToken("/api/user/preferences", `{"preferences": {"languages": ["en"]}}`, user.ID)
+		_ = ParseJSON(resp, http.StatusOK)
+
+		resp = GetWithToken("/api/articles", user.ID)
+		data = ParseJSON(resp, http.StatusOK)
+		Expect(data["articles"]).To(HaveLen(1))
+		Expect(data["articlesCount"]).To(Equal(float64(1)))
+
+		resp = Get("/api/articles")
+		data = ParseJSON(resp, http.StatusOK)
+		Expect(data["articles"]).To(HaveLen(2))
+	})
+
+	Describe("metadata", func() {
+		AfterEach(func() {
+			rwe.SetArticleMetadataSchema(nil)
+		})
+
+		It("stores metadata and filters lists by it", func() {
+			Expect(data["article"].(map[string]interface{})["metadata"]).To(BeEmpty())
+
+			json := `{"article": {"title": "Dataset", "description": "d", "body": "b", "metadata": {"kind": "dataset", "rows": 10}}}`
+			resp := PostWithToken("/api/articles", json, user.ID)
+			data := ParseJSON(resp, http.StatusOK)
+			Expect(data["article"].(map[string]interface{})["metadata"]).To(Equal(map[string]interface{}{
+				"kind": "dataset",
+				"rows": float64(10),
+			}))
+
+			resp = Get("/api/articles?meta.kind=dataset&meta.rows=10")
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["articles"]).To(HaveLen(1))
+			Expect(data["articlesCount"]).To(Equal(float64(1)))
+
+			resp = Get("/api/articles?meta.kind=paper")
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["articles"]).To(BeEmpty())
+
+			resp = Get("/api/articles?meta.a.b=c")
+			data = ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["field"]).To(Equal("meta.a.b"))
+		})
+
+		It("validates metadata against schema", func() {
+			schema, err := jsonschema.Parse([]byte(`{
+				"type": "object",
+				"properties": {"kind": {"enum": ["dataset", "paper"]}},
+				"additionalProperties": false
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			rwe.SetArticleMetadataSchema(schema)
+
+			url := "/api/articles/" + slug
+			resp := PutWithToken(url, `{"article": {"title": "Hello world", "metadata": {"kind": "video"}}}`, user.ID)
+			data := ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["field"]).To(Equal("metadata.kind"))
+
+			resp = PutWithToken(url, `{"article": {"title": "Hello world", "metadata": {"color": "red"}}}`, user.ID)
+			data = ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["message"]).To(Equal("metadata.color is not allowed"))
+
+			resp = PutWithToken(url, `{"article": {"title": "Hello world", "metadata": {"kind": "paper"}}}`, user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["article"].(map[string]interface{})["metadata"]).To(Equal(map[string]interface{}{
+				"kind": "paper",
+			}))
+		})
+	})
+
+	It("normalizes text and counts emoji as one character", func() {
+		url := "/api/articles/" + slug
+		resp := PutWithToken(url, `{"article": {"title": "Cafe\u0301\u0007"}}`, user.ID)
+		data := ParseJSON(resp, http.StatusOK)
+		Expect(data["article"].(map[string]interface{})["title"]).To(Equal("Café"))
+
+		title := strings.Repeat("👍🏽", 500)
+		resp = PutWithToken(url, `{"article": {"title": "`+title+`"}}`, user.ID)
+		data = ParseJSON(resp, http.StatusOK)
+		Expect(data["article"].(map[string]interface{})["title"]).To(Equal(title))
+
+		resp = PutWithToken(url, `{"article": {"title": "`+title+`!"}}`, user.ID)
+		data = ParseJSON(resp, http.StatusBadRequest)
+		Expect(data["field"]).To(Equal("title"))
+	})
+
+	It("returns instance meta", func() {
+		resp := Get("/api/meta")
+		data := ParseJSON(resp, http.StatusOK)
+		Expect(data["meta"]).To(MatchKeys(IgnoreExtras, Keys{
+			"name":       Not(BeEmpty()),
+			"languages":  Not(BeNil()),
+			"signupOpen": Equal(true),
+			"readOnly":   Equal(false),
+			"jsonNaming": Equal("camelCase"),
+			"limits": Equal(map[string]interface{}{
+				"maxArticleSize": float64(100 << 10),
+				"maxCommentSize": float64(10 << 10),
+				"maxTags":        float64(10),
+				"maxTagLength":   float64(50),
+
+				"maxTitleLength":       float64(500),
+				"maxDescriptionLength": float64(500),
+
+				"maxCommentDepth": float64(3),
+				"maxMetadataSize": float64(8 << 10),
+			}),
+		}))
+	})
+
+	It("returns request id", func() {
+		resp := Get("/api/meta")
+		Expect(resp.Header().Get("X-Request-ID")).To(HaveLen(32))
+
+		req := httptest.NewRequest("GET", "/api/meta", nil)
+		req.Header.Set("X-Request-ID", "proxy-id")
+		resp = httptest.NewRecorder()
+		rwe.Router.ServeHTTP(resp, req)
+		Expect(resp.Header().Get("X-Request-ID")).To(Equal("proxy-id"))
+	})
+
+	Describe("compression", func() {
+		postImport := func(encoding string, body []byte) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/api/users/import", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", encoding)
+			resp := httptest.NewRecorder()
+			rwe.Router.ServeHTTP(resp, req)
+			return resp
+		}
+
+		gzipped := func(s string) []byte {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, err := zw.Write([]byte(s))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zw.Close()).To(Succeed())
+			return buf.Bytes()
+		}
+
+		It("prefers zstd responses", func() {
+			req := httptest.NewRequest("GET", "/api/meta", nil)
+			req.Header.Set("Accept-Encoding", "gzip, zstd")
+			resp := httptest.NewRecorder()
+			rwe.Router.ServeHTTP(resp, req)
+			Expect(resp.Header().Get("Content-Encoding")).To(Equal("zstd"))
+
+			zr, err := zstd.NewReader(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			defer zr.Close()
+
+			var data map[string]interface{}
+			Expect(json.NewDecoder(zr).Decode(&data)).To(Succeed())
+			Expect(data).To(HaveKey("meta"))
+		})
+
+		It("decompresses request bodies", func() {
+			resp := postImport("gzip", gzipped(`{"password": "secret"}`))
+			data := ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["field"]).To(Equal("export"))
+		})
+
+		It("limits decompressed size", func() {
+			resp := postImport("gzip", gzipped(strings.Repeat(" ", 11<<20)))
+			data := ParseJSON(resp, http.StatusRequestEntityTooLarge)
+			Expect(data["code"]).To(Equal("REQUEST_TOO_LARGE"))
+		})
+
+		It("rejects unknown encodings", func() {
+			resp := postImport("br", []byte("{}"))
+			data := ParseJSON(resp, http.StatusUnsupportedMediaType)
+			Expect(data["code"]).To(Equal("UNSUPPORTED_ENCODING"))
+		})
+	})
+
+	It("normalizes tags", func() {
+		json := `{"article": {"title": "Go", "description": "Go", "body": "Go", "tagList": ["Go", " go ", "Go Lang", "go-lang"]}}`
+		resp := PostWithToken("/api/articles", json, user.ID)
+		data := ParseJSON(resp, http.StatusOK)
+		Expect(data["article"].(map[string]interface{})["tagList"]).To(Equal([]interface{}{"go", "go-lang"}))
+		Expect(data["warnings"]).To(Equal([]interface{}{
+			map[string]interface{}{"code": "TAG_NORMALIZED", "field": "tagList", "message": `tag "Go" normalized to "go"`},
+			map[string]interface{}{"code": "TAG_DUPLICATE", "field": "tagList", "message": `duplicate tag " go " removed`},
+			map[string]interface{}{"code": "TAG_NORMALIZED", "field": "tagList", "message": `tag "Go Lang" normalized to "go-lang"`},
+			map[string]interface{}{"code": "TAG_DUPLICATE", "field": "tagList", "message": `duplicate tag "go-lang" removed`},
+		}))
+
+		json = `{"article": {"title": "Go", "description": "Go", "body": "Go", "tagList": ["1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"]}}`
+		resp = PostWithToken("/api/articles", json, user.ID)
+		data = ParseJSON(resp, http.StatusUnprocessableEntity)
+		Expect(data["code"]).To(Equal("TOO_MANY_TAGS"))
 	})
 
 	Describe("showFeed", func() {
@@ -142,10 +380,84 @@ var _ = Describe("createArticle", func() {
 					"username":  "FollowedUser",
 					"bio":       "",
 					"image":     "",
+					"verified":  false,
 				}),
 			})
 			Expect(articles[0].(map[string]interface{})).To(MatchAllKeys(followedAuthorKeys))
 		})
+
+		It("supports feed rankings", func() {
+			for _, ranking := range []string{"chronological", "engagement", "affinity"} {
+				resp := GetWithToken("/api/articles/feed?ranking="+ranking, user.ID)
+				data := ParseJSON(resp, http.StatusOK)
+				Expect(data["articles"]).To(HaveLen(1))
+			}
+
+			resp := GetWithToken("/api/articles/feed?ranking=random", user.ID)
+			_ = ParseJSON(resp, http.StatusBadRequest)
+		})
+
+		It("reports latency budget", func() {
+			setRole(user, org.RoleAdmin)
+
+			requests := func() uint64 {
+				if stats, ok := rwe.BudgetStatuses()["GET /api/articles/feed"]; ok {
+					return stats.Requests
+				}
+				return 0
+			}
+			before := requests()
+
+			resp := GetWithToken("/api/articles/feed", user.ID)
+			_ = ParseJSON(resp, http.StatusOK)
+			Expect(requests()).To(Equal(before + 1))
+
+			resp = GetWithToken("/api/admin/budgets", user.ID)
+			data := ParseJSON(resp, http.StatusOK)
+			Expect(data["budgets"]).To(HaveKeyWithValue("GET /api/articles/feed", MatchKeys(IgnoreExtras, Keys{
+				"budgetMs": Equal(float64(500)),
+				"requests": Equal(float64(before + 1)),
+				"phasesMs": And(HaveKey("auth"), HaveKey("db"), HaveKey("serialize")),
+			})))
+		})
+
+		It("assigns feed ranking experiment", func() {
+			setRole(user, org.RoleAdmin)
+
+			json := `{"experiment": {"variants": ["engagement"]}}`
+			resp := PutWithToken("/api/admin/experiments/feed_ranking", json, user.ID)
+			data := ParseJSON(resp, http.StatusOK)
+			Expect(data["experiment"]).To(MatchKeys(IgnoreExtras, Keys{
+				"running":  Equal(true),
+				"variants": Equal([]interface{}{"engagement"}),
+			}))
+
+			resp = GetWithToken("/api/articles/feed", user.ID)
+			_ = ParseJSON(resp, http.StatusOK)
+			Expect(resp.Header().Get(experiment.Header)).To(Equal("feed_ranking=engagement"))
+
+			resp = GetWithToken("/api/admin/experiments", user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["experiments"]).To(ConsistOf(MatchKeys(IgnoreExtras, Keys{
+				"name":      Equal("feed_ranking"),
+				"exposures": Equal(map[string]interface{}{"engagement": float64(1)}),
+			})))
+
+			resp = DeleteWithToken("/api/admin/experiments/feed_ranking", user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["experiment"]).To(HaveKeyWithValue("running", false))
+
+			resp = GetWithToken("/api/articles/feed", user.ID)
+			_ = ParseJSON(resp, http.StatusOK)
+			Expect(resp.Header().Get(experiment.Header)).To(BeEmpty())
+		})
+
+		It("rejects limit out of range", func() {
+			resp := GetWithToken("/api/articles/feed?limit=1000", user.ID)
+			data := ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["code"]).To(Equal("VALIDATION_FAILED"))
+			Expect(data["field"]).To(Equal("limit"))
+		})
 	})
 
 	Describe("showArticle", func() {
@@ -161,17 +473,124 @@ var _ = Describe("createArticle", func() {
 		})
 	})
 
-	Describe("listArticles", func() {
+	Describe("ingestViews", func() {
+		signedPost := func(uri, body string, signedURI string, timestamp int64) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", uri, strings.NewReader(body))
+			req.Header.Set(rwe.SignatureKeyHeader, "test")
+			req.Header.Set(rwe.SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+			req.Header.Set(rwe.SignatureHeader,
+				rwe.Signature("secret", "POST", signedURI, timestamp, []byte(body)))
+
+			resp := httptest.NewRecorder()
+			rwe.Router.ServeHTTP(resp, req)
+			return resp
+		}
+
+		var body string
+
 		BeforeEach(func() {
-			url := fmt.Sprintf("/api/articles/%s?author=CurrentUser", slug)
-			resp := Get(url)
+			rwe.Config.SigningKeys = map[string]string{"test": "secret"}
+			body = fmt.Sprintf(`{"views": [{"slug": %q, "count": 3}, {"slug": %q, "count": 2}]}`, slug, slug)
+		})
+
+		AfterEach(func() {
+			rwe.Config.SigningKeys = nil
+		})
+
+		It("adds views of signed batch once", func() {
+			const uri = "/api/internal/analytics/views"
+			now := time.Now().Unix()
+
+			resp := signedPost(uri, body, uri, now)
+			data := ParseJSON(resp, http.StatusOK)
+			Expect(data["updated"]).To(Equal(float64(1)))
+
+			resp = signedPost(uri, body, uri, now)
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
 
+			resp = Get("/api/articles/" + slug)
 			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["article"]).To(MatchAllKeys(ExtendKeys(helloArticleKeys, Keys{
+				"viewsCount": Equal(float64(5)),
+			})))
 		})
 
+		It("rejects stale, unsigned or tampered requests", func() {
+			const uri = "/api/internal/analytics/views?batch=1"
+
+			resp := signedPost(uri, body, uri, time.Now().Add(-time.Hour).Unix())
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+
+			resp = Post(uri, body)
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+
+			resp = signedPost("/api/internal/analytics/views?batch=2", body, uri, time.Now().Unix())
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Describe("articlePage", func() {
+		var resp *httptest.ResponseRecorder
+
+		BeforeEach(func() {
+			url := fmt.Sprintf("/articles/%s", slug)
+			resp = Get(url)
+		})
+
+		It("renders article HTML", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+			Expect(resp.Body.String()).To(ContainSubstring("<h1>Hello world</h1>"))
+			Expect(resp.Body.String()).To(ContainSubstring(`<meta property="og:title" content="Hello world">`))
+		})
+	})
+
+	Describe("favoriteArticle while logged out", func() {
+		BeforeEach(func() {
+			url := fmt.Sprintf("/api/articles/%s/favorite", slug)
+			resp := Post(url, "")
+			res := ParseJSON(resp, http.StatusUnauthorized)
+			Expect(res["pendingAction"]).NotTo(BeEmpty())
+
+			json := fmt.Sprintf(`{"pendingActions": [%q]}`, res["pendingAction"])
+			resp = PostWithToken("/api/user/pending-actions", json, user.ID)
+			_ = ParseJSON(resp, http.StatusOK)
+
+			url = fmt.Sprintf("/api/articles/%s", slug)
+			resp = GetWithToken(url, user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+		})
+
+		It("favorites article after login", func() {
+			Expect(data["article"]).To(MatchAllKeys(favoritedArticleKeys))
+		})
+	})
+
+	Describe("listArticles", func() {
 		It("returns articles by author", func() {
+			url := fmt.Sprintf("/api/articles/%s?author=CurrentUser", slug)
+			resp := Get(url)
+
+			data = ParseJSON(resp, http.StatusOK)
 			Expect(data["article"]).To(MatchAllKeys(helloArticleKeys))
 		})
+
+		It("returns articles", func() {
+			url := fmt.Sprintf("/api/articles/%s/favorite", slug)
+			resp := PostWithToken(url, "", user.ID)
+			_ = ParseJSON(resp, 200)
+
+			resp = GetWithToken("/api/articles", user.ID)
+			data = ParseJSON(resp, 200)
+
+			articles := data["articles"].([]interface{})
+
+			Expect(articles).To(HaveLen(1))
+			article := articles[0].(map[string]interface{})
+			Expect(article).To(MatchAllKeys(favoritedArticleKeys))
+			Expect(data["articlesCount"]).To(Equal(float64(1)))
+			Expect(data["exactCount"]).To(Equal(true))
+		})
 	})
 
 	Describe("favoriteArticle", func() {
@@ -189,6 +608,121 @@ var _ = Describe("createArticle", func() {
 			Expect(data["article"]).To(MatchAllKeys(favoritedArticleKeys))
 		})
 
+		It("dual writes favorites count", func() {
+			selectCount := func() int {
+				var n int
+				_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&n),
+					"SELECT favorites_count FROM articles WHERE slug = ?", slug)
+				Expect(err).NotTo(HaveOccurred())
+				return n
+			}
+
+			// The article was favorited before the flag was on, so it was
+			// not counted.
+			url := fmt.Sprintf("/api/articles/%s/favorite", slug)
+			resp := DeleteWithToken(url, user.ID)
+			_ = ParseJSON(resp, 200)
+			Expect(selectCount()).To(Equal(0))
+
+			features := rwe.Config.Features
+			rwe.Config.Features = map[string]bool{blog.FavoritesCountFlag: true}
+			defer func() { rwe.Config.Features = features }()
+
+			resp = PostWithToken(url, "", user.ID)
+			_ = ParseJSON(resp, 200)
+			Expect(selectCount()).To(Equal(1))
+
+			resp = DeleteWithToken(url, user.ID)
+			_ = ParseJSON(resp, 200)
+			Expect(selectCount()).To(Equal(0))
+		})
+
+		It("exports favorites", func() {
+			resp := GetWithToken("/api/user/favorites/export", user.ID)
+			data = ParseJSON(resp, 200)
+			Expect(data["favorites"]).To(Equal([]interface{}{
+				map[string]interface{}{"slug": slug, "favoritedAt": rwe.Clock.Now().Format(time.RFC3339Nano)},
+			}))
+			Expect(data["removed"]).To(BeEmpty())
+			Expect(data["syncToken"]).NotTo(BeEmpty())
+		})
+
+		It("streams favorites in batches", func() {
+			batch := blog.FavoritesExportBatch
+			blog.FavoritesExportBatch = 2
+			defer func() { blog.FavoritesExportBatch = batch }()
+
+			// Favorites are exported in the order they were made.
+			mock := rwe.Clock.(*clock.Mock)
+			slugs := []string{slug}
+			for _, title := range []string{"First", "Second"} {
+				json := fmt.Sprintf(`{"article": {"title": %q, "description": "Foo", "body": "Foo"}}`, title)
+				resp := PostWithToken("/api/articles", json, user.ID)
+				data = ParseJSON(resp, 200)
+				other := data["article"].(map[string]interface{})["slug"].(string)
+				slugs = append(slugs, other)
+
+				mock.Add(time.Second)
+				defer mock.Add(-time.Second)
+
+				resp = PostWithToken(fmt.Sprintf("/api/articles/%s/favorite", other), "", user.ID)
+				_ = ParseJSON(resp, 200)
+			}
+
+			resp := GetWithToken("/api/user/favorites/export?format=ndjson", user.ID)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(Equal(httputil.NDJSONContentType))
+			Expect(resp.Header().Get("X-Sync-Token")).NotTo(BeEmpty())
+
+			lines := strings.Split(strings.TrimSuffix(resp.Body.String(), "\n"), "\n")
+			Expect(lines).To(HaveLen(3))
+			for i, line := range lines {
+				var favorite map[string]interface{}
+				Expect(json.Unmarshal([]byte(line), &favorite)).To(Succeed())
+				Expect(favorite).To(HaveKeyWithValue("slug", slugs[i]))
+			}
+		})
+
+		It("throttles concurrent exports", func() {
+			rwe.SetThrottles(map[string]*xconfig.Throttle{
+				rwe.ThrottleExport: {Concurrency: 1, QueueSize: 1, MaxWait: time.Millisecond},
+			})
+			defer rwe.SetThrottles(nil)
+
+			release, err := rwe.AcquireThrottle(ctx, rwe.ThrottleExport)
+			Expect(err).NotTo(HaveOccurred())
+
+			resp := GetWithToken("/api/user/favorites/export", user.ID)
+			data = ParseJSON(resp, http.StatusServiceUnavailable)
+			Expect(data["code"]).To(Equal("OVERLOADED"))
+			Expect(resp.Header().Get("Retry-After")).To(Equal("1"))
+
+			release()
+			resp = GetWithToken("/api/user/favorites/export", user.ID)
+			_ = ParseJSON(resp, http.StatusOK)
+
+			Expect(rwe.ThrottleStatuses()[rwe.ThrottleExport]).To(Equal(&rwe.ThrottleStats{
+				Concurrency: 1,
+				Served:      2,
+				Rejected:    1,
+			}))
+		})
+
+		It("exports tombstone when article is deleted", func() {
+			since := rwe.Clock.Now().Add(-time.Second).Format(time.RFC3339Nano)
+			token := base64.RawURLEncoding.EncodeToString([]byte(since))
+
+			resp := DeleteWithToken("/api/articles/"+slug, user.ID)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			resp = GetWithToken("/api/user/favorites/export?since="+token, user.ID)
+			data = ParseJSON(resp, 200)
+			Expect(data["favorites"]).To(BeEmpty())
+			Expect(data["removed"]).To(Equal([]interface{}{
+				map[string]interface{}{"slug": slug, "removedAt": rwe.Clock.Now().Format(time.RFC3339Nano)},
+			}))
+		})
+
 		Describe("unfavoriteArticle", func() {
 			BeforeEach(func() {
 				url := fmt.Sprintf("/api/articles/%s/favorite", slug)
@@ -203,25 +737,158 @@ var _ = Describe("createArticle", func() {
 			It("returns article", func() {
 				Expect(data["article"]).To(MatchAllKeys(helloArticleKeys))
 			})
+
+			It("exports tombstone since sync token", func() {
+				since := rwe.Clock.Now().Add(-time.Second).Format(time.RFC3339Nano)
+				token := base64.RawURLEncoding.EncodeToString([]byte(since))
+
+				resp := GetWithToken("/api/user/favorites/export?since="+token, user.ID)
+				data = ParseJSON(resp, 200)
+				Expect(data["favorites"]).To(BeEmpty())
+				Expect(data["removed"]).To(Equal([]interface{}{
+					map[string]interface{}{"slug": slug, "removedAt": rwe.Clock.Now().Format(time.RFC3339Nano)},
+				}))
+
+				resp = GetWithToken("/api/user/favorites/export?format=ndjson&since="+token, user.ID)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(resp.Body.String()).To(MatchJSON(fmt.Sprintf(
+					`{"slug": %q, "removedAt": %q}`, slug, rwe.Clock.Now().Format(time.RFC3339Nano))))
+			})
 		})
 	})
 
-	Describe("listArticles", func() {
+	Describe("account migration", func() {
+		var signingKeys map[string]string
+		var signed *blog.SignedAccountExport
+
 		BeforeEach(func() {
-			url := fmt.Sprintf("/api/articles/%s/favorite", slug)
-			resp := PostWithToken(url, "", user.ID)
-			_ = ParseJSON(resp, 200)
+			signingKeys = rwe.Config.SigningKeys
+			rwe.Config.SigningKeys = map[string]string{"instance": "shared-secret"}
+			rwe.Config.AccountExportKey = "instance"
 
-			resp = GetWithToken("/api/articles", user.ID)
+			createFollowedUser()
+
+			resp := GetWithToken("/api/user/account/export", user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+
+			b, err := json.Marshal(data["export"])
+			Expect(err).NotTo(HaveOccurred())
+			signed = new(blog.SignedAccountExport)
+			Expect(json.Unmarshal(b, signed)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			rwe.Config.SigningKeys = signingKeys
+			rwe.Config.AccountExportKey = ""
+		})
+
+		decodeExport := func() *blog.AccountExport {
+			payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(signed.Signature).To(Equal(rwe.SignPayload("shared-secret", payload)))
+
+			export := new(blog.AccountExport)
+			Expect(json.Unmarshal(payload, export)).To(Succeed())
+			return export
+		}
+
+		importExport := func(export *blog.AccountExport) *httptest.ResponseRecorder {
+			payload, err := json.Marshal(export)
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := json.Marshal(map[string]interface{}{
+				"export": &blog.SignedAccountExport{
+					KeyID:     "instance",
+					Payload:   base64.StdEncoding.EncodeToString(payload),
+					Signature: signed.Signature,
+				},
+				"password": "new-password",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			return Post("/api/users/import", string(b))
+		}
+
+		It("exports signed account", func() {
+			export := decodeExport()
+			Expect(export.Profile.Username).To(Equal("CurrentUser"))
+			Expect(export.Profile.Email).To(Equal("hello@world.com"))
+			Expect(export.Articles).To(HaveLen(1))
+			Expect(export.Articles[0].Slug).To(Equal(slug))
+			Expect(export.Articles[0].TagList).To(ConsistOf("greeting", "welcome", "salut"))
+			Expect(export.Following).To(Equal([]string{"FollowedUser"}))
+		})
+
+		It("rejects tampered export", func() {
+			export := decodeExport()
+			export.Profile.Username = "MovedUser"
+
+			resp := importExport(export)
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("imports account and emits redirects", func() {
+			export := decodeExport()
+			export.Profile.Username = "MovedUser"
+			export.Profile.Email = "moved@world.com"
+
+			payload, err := json.Marshal(export)
+			Expect(err).NotTo(HaveOccurred())
+			signed.Signature = rwe.SignPayload("shared-secret", payload)
+
+			resp := importExport(export)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["user"]).To(HaveKeyWithValue("username", "MovedUser"))
+			Expect(data["skippedFollowing"]).To(BeEmpty())
+
+			redirects := data["redirects"].([]interface{})
+			Expect(redirects).To(HaveLen(2))
+
+			// The slug is taken on this instance so the article gets a new one.
+			article := redirects[0].(map[string]interface{})
+			Expect(article["from"]).To(HaveSuffix("/articles/" + slug))
+			Expect(article["to"]).To(ContainSubstring("/articles/hello-world-"))
+			Expect(article["to"]).NotTo(HaveSuffix("/articles/" + slug))
+
+			Expect(redirects[1]).To(Equal(map[string]interface{}{
+				"from": rwe.Config.SiteURL + "/profiles/CurrentUser",
+				"to":   rwe.Config.SiteURL + "/profiles/MovedUser",
+			}))
+		})
+
+		It("rejects taken username", func() {
+			export := decodeExport()
+			export.Profile.Email = "moved@world.com"
+
+			payload, err := json.Marshal(export)
+			Expect(err).NotTo(HaveOccurred())
+			signed.Signature = rwe.SignPayload("shared-secret", payload)
+
+			resp := importExport(export)
+			data = ParseJSON(resp, http.StatusConflict)
+			Expect(data["code"]).To(Equal("USERNAME_TAKEN"))
+		})
+	})
+
+	Describe("listArticles with snake_case JSON", func() {
+		BeforeEach(func() {
+			httputil.SetJSONOptions(httputil.JSONOptions{SnakeCase: true, OmitNulls: true})
+
+			resp := GetWithToken("/api/articles", user.ID)
 			data = ParseJSON(resp, 200)
 		})
 
-		It("returns articles", func() {
-			articles := data["articles"].([]interface{})
+		AfterEach(func() {
+			httputil.SetJSONOptions(httputil.JSONOptions{})
+		})
 
-			Expect(articles).To(HaveLen(1))
-			article := articles[0].(map[string]interface{})
-			Expect(article).To(MatchAllKeys(favoritedArticleKeys))
+		It("renames fields and omits nulls", func() {
+			Expect(data).To(HaveKeyWithValue("articles_count", float64(1)))
+			Expect(data).NotTo(HaveKey("articlesCount"))
+
+			article := data["articles"].([]interface{})[0].(map[string]interface{})
+			Expect(article).To(HaveKey("favorites_count"))
+			Expect(article).To(HaveKey("created_at"))
+			Expect(article).NotTo(HaveKey("latest_comment"))
 		})
 	})
 
@@ -244,6 +911,42 @@ var _ = Describe("createArticle", func() {
 		})
 	})
 
+	Describe("updateArticle by another user", func() {
+		BeforeEach(func() {
+			followedUser := createFollowedUser()
+
+			json := `{"article": {"title": "Foo bar"}}`
+			url := fmt.Sprintf("/api/articles/%s", slug)
+			resp := PutWithToken(url, json, followedUser.ID)
+			data = ParseJSON(resp, http.StatusForbidden)
+		})
+
+		It("returns error code", func() {
+			Expect(data["code"]).To(Equal("ARTICLE_FORBIDDEN"))
+		})
+	})
+
+	Describe("updateArticle comment policy", func() {
+		BeforeEach(func() {
+			json := `{"article": {"title": "Hello world", "commentPolicy": "off"}}`
+
+			url := fmt.Sprintf("/api/articles/%s", slug)
+			resp := PutWithToken(url, json, user.ID)
+			data = ParseJSON(resp, 200)
+		})
+
+		It("disables comments", func() {
+			article := data["article"].(map[string]interface{})
+			Expect(article["commentPolicy"]).To(Equal("off"))
+			Expect(article["commentsEnabled"]).To(Equal(false))
+
+			followedUser := createFollowedUser()
+			url := fmt.Sprintf("/api/articles/%s/comments", slug)
+			resp := PostWithToken(url, `{"comment": {"body": "First comment."}}`, followedUser.ID)
+			Expect(resp.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
 	Describe("deleteArticle", func() {
 		var resp *httptest.ResponseRecorder
 
@@ -257,6 +960,75 @@ var _ = Describe("createArticle", func() {
 		})
 	})
 
+	Describe("hideArticle", func() {
+		var moderator *org.User
+
+		BeforeEach(func() {
+			moderator = createFollowedUser()
+			setRole(moderator, org.RoleModerator)
+
+			url := fmt.Sprintf("/api/moderation/articles/%s", slug)
+			json := `{"takedown": {"reason": "copyright", "legalHold": true}}`
+			resp := PutWithToken(url, json, moderator.ID)
+			data = ParseJSON(resp, 200)
+		})
+
+		It("hides article from readers", func() {
+			Expect(data["takedown"]).To(MatchAllKeys(Keys{
+				"reason":    Equal("copyright"),
+				"legalHold": Equal(true),
+				"hiddenAt":  Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			}))
+
+			resp := Get("/api/articles/" + slug)
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+
+			resp = Get("/api/articles")
+			data = ParseJSON(resp, 200)
+			Expect(data["articles"]).To(BeEmpty())
+		})
+
+		It("blocks deletion under legal hold", func() {
+			resp := DeleteWithToken("/api/articles/"+slug, user.ID)
+			Expect(resp.Code).To(Equal(http.StatusConflict))
+		})
+
+		It("keeps legal hold after restore", func() {
+			url := fmt.Sprintf("/api/moderation/articles/%s", slug)
+			resp := DeleteWithToken(url, moderator.ID)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			resp = Get("/api/articles/" + slug)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			resp = DeleteWithToken("/api/articles/"+slug, user.ID)
+			Expect(resp.Code).To(Equal(http.StatusConflict))
+
+			resp = DeleteWithToken(url+"/legal-hold", moderator.ID)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+
+			resp = DeleteWithToken("/api/articles/"+slug, user.ID)
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+
+		It("accepts appeal from author", func() {
+			url := fmt.Sprintf("/api/articles/%s/appeal", slug)
+			resp := PostWithToken(url, `{"appeal": {"body": "I own the rights."}}`, user.ID)
+			data = ParseJSON(resp, 200)
+
+			resp = GetWithToken("/api/moderation/appeals", moderator.ID)
+			data = ParseJSON(resp, 200)
+			Expect(data["appeals"]).To(ConsistOf(MatchAllKeys(Keys{
+				"id":           Not(BeZero()),
+				"body":         Equal("I own the rights."),
+				"author":       Equal("CurrentUser"),
+				"articleSlug":  Equal(slug),
+				"hiddenReason": Equal("copyright"),
+				"createdAt":    Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			})))
+		})
+	})
+
 	Describe("createComment", func() {
 		var commentKeys Keys
 		var commentID uint64
@@ -266,7 +1038,7 @@ var _ = Describe("createArticle", func() {
 			commentKeys = Keys{
 				"id":        Not(BeZero()),
 				"body":      Equal("First comment."),
-				"author":    Equal(map[string]interface{}{"following": false, "username": "FollowedUser", "bio": "", "image": ""}),
+				"author":    Equal(map[string]interface{}{"following": false, "username": "FollowedUser", "bio": "", "image": "", "verified": false}),
 				"createdAt": Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
 				"updatedAt": Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
 			}
@@ -297,6 +1069,28 @@ var _ = Describe("createArticle", func() {
 			})
 		})
 
+		It("returns comments preview in article list", func() {
+			data := ParseJSON(Get("/api/articles"), 200)
+			articles := data["articles"].([]interface{})
+			Expect(articles).To(HaveLen(1))
+
+			article := articles[0].(map[string]interface{})
+			Expect(article["commentsCount"]).To(Equal(float64(1)))
+			Expect(article["latestComment"]).To(MatchAllKeys(Keys{
+				"id":        Equal(float64(commentID)),
+				"body":      Equal("First comment."),
+				"author":    Equal("FollowedUser"),
+				"createdAt": Not(BeEmpty()),
+			}))
+		})
+
+		It("rejects malformed comment id", func() {
+			url := fmt.Sprintf("/api/articles/%s/comments/abc", slug)
+			data := ParseJSON(Get(url), http.StatusBadRequest)
+			Expect(data["code"]).To(Equal("VALIDATION_FAILED"))
+			Expect(data["field"]).To(Equal("id"))
+		})
+
 		Describe("showComment with authentication", func() {
 			BeforeEach(func() {
 				url := fmt.Sprintf("/api/articles/%s/comments/%d", slug, commentID)
@@ -306,7 +1100,7 @@ var _ = Describe("createArticle", func() {
 
 			It("returns comment to article", func() {
 				followedCommentKeys := ExtendKeys(commentKeys, Keys{
-					"author": Equal(map[string]interface{}{"following": true, "username": "FollowedUser", "bio": "", "image": ""}),
+					"author": Equal(map[string]interface{}{"following": true, "username": "FollowedUser", "bio": "", "image": "", "verified": false}),
 				})
 				Expect(data["comment"]).To(MatchAllKeys(followedCommentKeys))
 			})
@@ -321,12 +1115,224 @@ var _ = Describe("createArticle", func() {
 
 			It("returns article comments", func() {
 				followedCommentKeys := ExtendKeys(commentKeys, Keys{
-					"author": Equal(map[string]interface{}{"following": true, "username": "FollowedUser", "bio": "", "image": ""}),
+					"author": Equal(map[string]interface{}{"following": true, "username": "FollowedUser", "bio": "", "image": "", "verified": false}),
 				})
 				Expect(data["comments"].([]interface{})[0]).To(MatchAllKeys(followedCommentKeys))
 			})
 		})
 
+		Describe("listParticipants", func() {
+			It("returns author and commenters matching prefix", func() {
+				url := fmt.Sprintf("/api/articles/%s/participants?q=follow", slug)
+				resp := GetWithToken(url, user.ID)
+				data = ParseJSON(resp, 200)
+				Expect(data["participants"]).To(Equal([]interface{}{
+					map[string]interface{}{"following": true, "username": "FollowedUser", "bio": "", "image": "", "verified": false},
+				}))
+
+				url = fmt.Sprintf("/api/articles/%s/participants", slug)
+				resp = Get(url)
+				data = ParseJSON(resp, 200)
+				participants := data["participants"].([]interface{})
+				Expect(participants).To(HaveLen(2))
+				Expect(participants[0]).To(HaveKeyWithValue("username", "CurrentUser"))
+			})
+		})
+
+		Describe("replies", func() {
+			var url string
+			var replyID uint64
+
+			reply := func(parentID uint64) map[string]interface{} {
+				json := fmt.Sprintf(`{"comment": {"body": "Reply.", "parentId": %d}}`, parentID)
+				resp := PostWithToken(url, json, user.ID)
+				data := ParseJSON(resp, http.StatusOK)
+				return data["comment"].(map[string]interface{})
+			}
+
+			BeforeEach(func() {
+				url = fmt.Sprintf("/api/articles/%s/comments", slug)
+				comment := reply(commentID)
+				Expect(comment).To(HaveKeyWithValue("parentId", float64(commentID)))
+				replyID = uint64(comment["id"].(float64))
+			})
+
+			AfterEach(func() {
+				rwe.Config.Comments.MaxDepth = 0
+			})
+
+			It("lists comments flat by default", func() {
+				data := ParseJSON(Get(url), http.StatusOK)
+				comments := data["comments"].([]interface{})
+				Expect(comments).To(HaveLen(2))
+				Expect(comments[0]).NotTo(HaveKey("parentId"))
+				Expect(comments[1]).To(HaveKeyWithValue("parentId", float64(commentID)))
+			})
+
+			It("nests replies in tree view", func() {
+				data := ParseJSON(Get(url+"?view=tree"), http.StatusOK)
+				comments := data["comments"].([]interface{})
+				Expect(comments).To(HaveLen(1))
+
+				replies := comments[0].(map[string]interface{})["replies"].([]interface{})
+				Expect(replies).To(HaveLen(1))
+				Expect(replies[0]).To(HaveKeyWithValue("id", float64(replyID)))
+			})
+
+			It("flattens replies beyond max depth", func() {
+				rwe.Config.Comments.MaxDepth = 1
+
+				comment := reply(replyID)
+				Expect(comment).To(HaveKeyWithValue("parentId", float64(commentID)))
+			})
+
+			It("rejects unknown parent", func() {
+				json := `{"comment": {"body": "Reply.", "parentId": 123456789}}`
+				resp := PostWithToken(url, json, user.ID)
+				data := ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("parentId"))
+			})
+
+			It("rejects unknown view", func() {
+				resp := Get(url + "?view=nested")
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Describe("userActivity", func() {
+			BeforeEach(func() {
+				resp := GetWithToken("/api/user/activity", user.ID)
+				data = ParseJSON(resp, 200)
+			})
+
+			It("returns comment on user article", func() {
+				activity := data["activity"].([]interface{})
+				Expect(activity).To(HaveLen(1))
+				Expect(activity[0]).To(MatchAllKeys(Keys{
+					"id":          Equal(fmt.Sprintf("comment:%d", commentID)),
+					"type":        Equal("comment"),
+					"actor":       Equal(map[string]interface{}{"following": true, "username": "FollowedUser", "bio": "", "image": "", "verified": false}),
+					"article":     Equal(map[string]interface{}{"slug": slug, "title": "Hello world"}),
+					"comment":     Equal(map[string]interface{}{"id": float64(commentID), "body": "First comment."}),
+					"actorsCount": Equal(float64(1)),
+					"createdAt":   Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+				}))
+				Expect(data["nextCursor"]).To(Equal(""))
+			})
+
+			It("polls for new activity", func() {
+				since := rwe.Clock.Now().Add(-time.Second).Format(time.RFC3339Nano)
+				resp := GetWithToken("/api/notifications/poll?timeout=1&since="+since, user.ID)
+				data = ParseJSON(resp, 200)
+				Expect(data["activity"]).To(HaveLen(1))
+				Expect(data["since"]).To(Equal(rwe.Clock.Now().Format(time.RFC3339Nano)))
+
+				resp = GetWithToken("/api/notifications/poll?timeout=1&since="+data["since"].(string), user.ID)
+				data = ParseJSON(resp, 200)
+				Expect(data["activity"]).To(BeEmpty())
+			})
+
+			It("wakes up the poll on new activity", func() {
+				mock := rwe.Clock.(*clock.Mock)
+				since := rwe.Clock.Now().Format(time.RFC3339Nano)
+				mock.Add(time.Second)
+				defer mock.Add(-time.Second)
+
+				done := make(chan *httptest.ResponseRecorder, 1)
+				go func() {
+					defer GinkgoRecover()
+					done <- GetWithToken("/api/notifications/poll?timeout=8&since="+since, user.ID)
+				}()
+
+				url := fmt.Sprintf("/api/articles/%s/comments", slug)
+				resp := PostWithToken(url, `{"comment": {"body": "Second comment."}}`, followedUser.ID)
+				_ = ParseJSON(resp, 200)
+
+				// The poll returns before the poll interval.
+				Eventually(done, 4*time.Second).Should(Receive(&resp))
+				data = ParseJSON(resp, 200)
+				Expect(data["activity"]).To(HaveLen(1))
+			})
+
+			It("collapses favorites into a digest", func() {
+				for _, name := range []string{"Fan1", "Fan2"} {
+					fan := &org.User{Username: name, Email: name + "@bar.com", PasswordHash: "h"}
+					_, err := rwe.PGMain().ModelContext(ctx, fan).Insert()
+					Expect(err).NotTo(HaveOccurred())
+
+					url := fmt.Sprintf("/api/articles/%s/favorite", slug)
+					_ = ParseJSON(PostWithToken(url, "", fan.ID), 200)
+				}
+
+				resp := GetWithToken("/api/user/activity", user.ID)
+				data = ParseJSON(resp, 200)
+
+				activity := data["activity"].([]interface{})
+				Expect(activity).To(HaveLen(2))
+				digest := activity[0].(map[string]interface{})
+				if digest["type"] != "favorite" {
+					digest = activity[1].(map[string]interface{})
+				}
+				Expect(digest["type"]).To(Equal("favorite"))
+				Expect(digest["actorsCount"]).To(Equal(float64(2)))
+
+				resp = GetWithToken("/api/user/activity/"+digest["id"].(string), user.ID)
+				data = ParseJSON(resp, 200)
+				Expect(data["activity"]).To(HaveLen(2))
+			})
+		})
+
+		Describe("exportComments", func() {
+			var url string
+
+			BeforeEach(func() {
+				url = fmt.Sprintf("/api/articles/%s/comments/export", slug)
+			})
+
+			It("requires admin role", func() {
+				resp := GetWithToken(url, followedUser.ID)
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("returns comments with author email", func() {
+				setRole(user, org.RoleAdmin)
+
+				resp := GetWithToken(url, user.ID)
+				data = ParseJSON(resp, 200)
+				Expect(data["comments"]).To(ConsistOf(MatchAllKeys(Keys{
+					"id":        Equal(float64(commentID)),
+					"body":      Equal("First comment."),
+					"author":    Equal(map[string]interface{}{"username": "FollowedUser", "email": "foo@bar.com"}),
+					"createdAt": Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+					"updatedAt": Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+				})))
+			})
+
+			It("streams comments as ndjson", func() {
+				setRole(user, org.RoleAdmin)
+
+				resp := GetWithToken(url+"?format=ndjson", user.ID)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(resp.Header().Get("Content-Type")).To(Equal(httputil.NDJSONContentType))
+
+				lines := strings.Split(strings.TrimSuffix(resp.Body.String(), "\n"), "\n")
+				Expect(lines).To(HaveLen(1))
+
+				var comment map[string]interface{}
+				Expect(json.Unmarshal([]byte(lines[0]), &comment)).To(Succeed())
+				Expect(comment).To(HaveKeyWithValue("id", float64(commentID)))
+				Expect(comment).To(HaveKeyWithValue("author",
+					map[string]interface{}{"username": "FollowedUser", "email": "foo@bar.com"}))
+			})
+
+			It("rejects unknown format", func() {
+				setRole(user, org.RoleAdmin)
+
+				resp := GetWithToken(url+"?format=xml", user.ID)
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
 		Describe("deleteComment", func() {
 			var resp *httptest.ResponseRecorder
 
@@ -339,6 +1345,334 @@ var _ = Describe("createArticle", func() {
 				Expect(resp.Code).To(Equal(http.StatusOK))
 			})
 		})
+
+		Describe("account deletion", func() {
+			planDeletion := func(content string) string {
+				json := fmt.Sprintf(`{"deletion": {"content": %q}}`, content)
+				resp := PostWithToken("/api/user/account/deletion", json, user.ID)
+				data = ParseJSON(resp, 200)
+				deletion := data["deletion"].(map[string]interface{})
+				Expect(deletion).To(HaveKeyWithValue("articlesCount", float64(1)))
+				return deletion["token"].(string)
+			}
+
+			confirmDeletion := func(token string, userID uint64) *httptest.ResponseRecorder {
+				json := fmt.Sprintf(`{"deletion": {"token": %q}}`, token)
+				return PostWithToken("/api/user/account/deletion/confirm", json, userID)
+			}
+
+			It("rejects unknown options and tokens of other users", func() {
+				resp := PostWithToken("/api/user/account/deletion", `{"deletion": {"content": "archive"}}`, user.ID)
+				data = ParseJSON(resp, 400)
+				Expect(data["field"]).To(Equal("content"))
+
+				token := planDeletion(blog.TransferContent)
+				resp = confirmDeletion(token, followedUser.ID)
+				data = ParseJSON(resp, 400)
+				Expect(data["field"]).To(Equal("token"))
+			})
+
+			runJobs := func() {
+				n, err := rwe.RunJobs(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n).To(Equal(1))
+			}
+
+			It("rejects expired tokens", func() {
+				token := planDeletion(blog.TransferContent)
+
+				mock := rwe.Clock.(*clock.Mock)
+				mock.Add(16 * time.Minute)
+				defer mock.Add(-16 * time.Minute)
+
+				resp := confirmDeletion(token, user.ID)
+				data = ParseJSON(resp, 400)
+				Expect(data["field"]).To(Equal("token"))
+				Expect(data["message"]).To(Equal("confirmation token has expired"))
+			})
+
+			It("refuses to delete content under legal hold", func() {
+				token := planDeletion(blog.DeleteContent)
+
+				_, err := rwe.PGMain().ExecContext(ctx,
+					"UPDATE articles SET legal_hold = TRUE WHERE slug = ?", slug)
+				Expect(err).NotTo(HaveOccurred())
+
+				resp := PostWithToken("/api/user/account/deletion", `{"deletion": {"content": "delete"}}`, user.ID)
+				data = ParseJSON(resp, http.StatusConflict)
+				Expect(data["code"]).To(Equal("LEGAL_HOLD"))
+
+				// The token was issued before the hold.
+				resp = confirmDeletion(token, user.ID)
+				data = ParseJSON(resp, http.StatusConflict)
+				Expect(data["code"]).To(Equal("LEGAL_HOLD"))
+
+				n, err := rwe.RunJobs(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n).To(BeZero())
+
+				resp = Get("/api/articles/" + slug)
+				_ = ParseJSON(resp, 200)
+			})
+
+			It("transfers articles to the ghost user", func() {
+				resp := confirmDeletion(planDeletion(blog.TransferContent), user.ID)
+				data = ParseJSON(resp, http.StatusAccepted)
+				Expect(data["deletion"]).To(HaveKeyWithValue("articlesCount", float64(1)))
+
+				// The account is deleted by the job.
+				resp = GetWithToken("/api/user/", user.ID)
+				_ = ParseJSON(resp, 200)
+				runJobs()
+
+				resp = Get("/api/articles/" + slug)
+				data = ParseJSON(resp, 200)
+				author := data["article"].(map[string]interface{})["author"]
+				Expect(author).To(HaveKeyWithValue("username", org.GhostUsername))
+
+				resp = Get(fmt.Sprintf("/api/articles/%s/comments", slug))
+				data = ParseJSON(resp, 200)
+				Expect(data["comments"]).To(HaveLen(1))
+
+				resp = GetWithToken("/api/user/", user.ID)
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			})
+
+			It("deletes articles with their comments", func() {
+				resp := confirmDeletion(planDeletion(blog.DeleteContent), user.ID)
+				_ = ParseJSON(resp, http.StatusAccepted)
+				runJobs()
+
+				resp = Get("/api/articles/" + slug)
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+
+				n, err := rwe.PGMain().ModelContext(ctx, (*blog.Comment)(nil)).Count()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n).To(BeZero())
+			})
+		})
+	})
+
+	Describe("leaderboard", func() {
+		BeforeEach(func() {
+			createFollowedUser()
+
+			resp := Get("/api/leaderboard?period=week")
+			data = ParseJSON(resp, 200)
+		})
+
+		It("returns authors ranked by followers", func() {
+			entries := data["leaderboard"].([]interface{})
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0]).To(MatchAllKeys(Keys{
+				"rank":           Equal(float64(1)),
+				"author":         Equal(map[string]interface{}{"following": false, "username": "FollowedUser", "bio": "", "image": "", "verified": false}),
+				"favoritesCount": Equal(float64(0)),
+				"followersCount": Equal(float64(1)),
+			}))
+		})
+	})
+
+	Describe("authorStats", func() {
+		BeforeEach(func() {
+			reader := createFollowedUser()
+
+			var articleID uint64
+			_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&articleID),
+				"SELECT id FROM articles WHERE slug = ?", slug)
+			Expect(err).NotTo(HaveOccurred())
+
+			// 00:30 on Jan 1 in Berlin, but Dec 31 in UTC.
+			_, err = rwe.PGMain().ExecContext(ctx, `
+				INSERT INTO favorite_articles (user_id, article_id, created_at) VALUES (?, ?, ?)
+			`, reader.ID, articleID, time.Date(2019, time.December, 31, 23, 30, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Favorites of the author are not counted.
+			_, err = rwe.PGMain().ExecContext(ctx, `
+				INSERT INTO favorite_articles (user_id, article_id, created_at) VALUES (?, ?, ?)
+			`, user.ID, articleID, time.Date(2019, time.December, 31, 23, 30, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = rwe.PGMain().ExecContext(ctx, `
+				INSERT INTO comments (author_id, article_id, body, created_at) VALUES (?, ?, 'body', ?)
+			`, reader.ID, articleID, time.Date(2019, time.December, 31, 22, 30, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("counts per day in UTC by default", func() {
+			resp := GetWithToken("/api/user/stats?days=2", user.ID)
+			data = ParseJSON(resp, 200)
+			Expect(data["timeZone"]).To(Equal("UTC"))
+			Expect(data["stats"]).To(Equal([]interface{}{
+				map[string]interface{}{"date": "2019-12-31", "favorites": float64(1), "comments": float64(1)},
+				map[string]interface{}{"date": "2020-01-01", "favorites": float64(0), "comments": float64(0)},
+			}))
+		})
+
+		It("counts per day in the time zone of the user", func() {
+			resp := PutWithToken("/api/user/preferences",
+				`{"preferences": {"timeZone": "Europe/Berlin"}}`, user.ID)
+			_ = ParseJSON(resp, 200)
+
+			resp = GetWithToken("/api/user/stats?days=2", user.ID)
+			data = ParseJSON(resp, 200)
+			Expect(data["timeZone"]).To(Equal("Europe/Berlin"))
+			Expect(data["stats"]).To(Equal([]interface{}{
+				map[string]interface{}{"date": "2019-12-31", "favorites": float64(0), "comments": float64(1)},
+				map[string]interface{}{"date": "2020-01-01", "favorites": float64(1), "comments": float64(0)},
+			}))
+		})
+
+		It("rejects days out of range", func() {
+			resp := GetWithToken("/api/user/stats?days=1000", user.ID)
+			data := ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["code"]).To(Equal("VALIDATION_FAILED"))
+			Expect(data["field"]).To(Equal("days"))
+		})
+	})
+
+	Describe("createSubscription", func() {
+		BeforeEach(func() {
+			json := `{"subscription": {"kind": "tag", "target": "greeting", "channels": ["rss", "email"]}}`
+			resp := PostWithToken("/api/subscriptions", json, user.ID)
+			_ = ParseJSON(resp, 200)
+
+			resp = GetWithToken("/api/subscriptions", user.ID)
+			data = ParseJSON(resp, 200)
+		})
+
+		It("returns subscriptions with RSS URL", func() {
+			subs := data["subscriptions"].([]interface{})
+			Expect(subs).To(HaveLen(1))
+			Expect(subs[0]).To(MatchAllKeys(Keys{
+				"id":        Not(BeZero()),
+				"kind":      Equal("tag"),
+				"target":    Equal("greeting"),
+				"channels":  Equal([]interface{}{"rss", "email"}),
+				"createdAt": Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			}))
+			Expect(data["rssUrl"]).To(ContainSubstring("/api/subscriptions/rss/"))
+		})
+	})
+
+	Describe("searchSuggest", func() {
+		BeforeEach(func() {
+			resp := Get("/api/search/suggest?q=hel")
+			data = ParseJSON(resp, 200)
+		})
+
+		It("returns article title matching prefix", func() {
+			suggestions := data["suggestions"].([]interface{})
+			Expect(suggestions).NotTo(BeEmpty())
+			Expect(suggestions[0]).To(MatchAllKeys(Keys{
+				"type": Equal("article"),
+				"text": Equal("Hello world"),
+				"slug": Equal(slug),
+			}))
+		})
+	})
+
+	Describe("savedSearches", func() {
+		var followedUser *org.User
+
+		BeforeEach(func() {
+			followedUser = createFollowedUser()
+
+			json := `{"search": {"query": "Dataset"}}`
+			resp := PostWithToken("/api/user/searches", json, followedUser.ID)
+			data = ParseJSON(resp, 200)
+		})
+
+		It("reports new matching articles as activity", func() {
+			search := data["search"].(map[string]interface{})
+			Expect(search["query"]).To(Equal("dataset"))
+
+			// Matches are limited to articles created after the search.
+			mock := rwe.Clock.(*clock.Mock)
+			mock.Add(time.Second)
+			defer mock.Add(-time.Second)
+
+			json := `{"article": {"title": "New dataset", "description": "Dataset.", "body": "Dataset."}}`
+			resp := PostWithToken("/api/articles", json, user.ID)
+			data = ParseJSON(resp, 200)
+			slug := data["article"].(map[string]interface{})["slug"].(string)
+
+			resp = GetWithToken("/api/user/activity", followedUser.ID)
+			data = ParseJSON(resp, 200)
+
+			activity := data["activity"].([]interface{})
+			Expect(activity).To(HaveLen(1))
+			Expect(activity[0]).To(MatchAllKeys(Keys{
+				"id":          Equal(fmt.Sprintf("search:%d:%d", int64(search["id"].(float64)), rwe.Clock.Now().Unix()/3600)),
+				"type":        Equal("search"),
+				"actor":       Equal(map[string]interface{}{"following": false, "username": "CurrentUser", "bio": "", "image": "", "verified": false}),
+				"article":     Equal(map[string]interface{}{"slug": slug, "title": "New dataset"}),
+				"searchQuery": Equal("dataset"),
+				"actorsCount": Equal(float64(1)),
+				"createdAt":   Equal(rwe.Clock.Now().Format(time.RFC3339Nano)),
+			}))
+		})
+
+		It("deletes saved search", func() {
+			id := int64(data["search"].(map[string]interface{})["id"].(float64))
+			resp := DeleteWithToken(fmt.Sprintf("/api/user/searches/%d", id), followedUser.ID)
+			Expect(resp.Code).To(Equal(200))
+
+			resp = GetWithToken("/api/user/searches", followedUser.ID)
+			data = ParseJSON(resp, 200)
+			Expect(data["searches"]).To(BeEmpty())
+		})
+	})
+
+	Describe("tag rules", func() {
+		BeforeEach(func() {
+			setRole(user, org.RoleAdmin)
+
+			for _, rule := range []string{
+				`{"rule": {"kind": "synonym", "tag": "JS", "target": "javascript"}}`,
+				`{"rule": {"kind": "implies", "tag": "react", "target": "javascript"}}`,
+			} {
+				resp := PostWithToken("/api/admin/tags/rules", rule, user.ID)
+				_ = ParseJSON(resp, http.StatusOK)
+			}
+		})
+
+		It("replaces synonyms and lists articles with implied tags", func() {
+			json := `{"article": {"title": "JS", "description": "JS", "body": "JS", "tagList": ["js"]}}`
+			resp := PostWithToken("/api/articles", json, user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["article"].(map[string]interface{})["tagList"]).To(Equal([]interface{}{"javascript"}))
+			Expect(data["warnings"]).To(Equal([]interface{}{
+				map[string]interface{}{"code": "TAG_NORMALIZED", "field": "tagList", "message": `tag "js" normalized to "javascript"`},
+			}))
+
+			json = `{"article": {"title": "React", "description": "React", "body": "React", "tagList": ["react"]}}`
+			resp = PostWithToken("/api/articles", json, user.ID)
+			_ = ParseJSON(resp, http.StatusOK)
+
+			resp = Get("/api/articles?tag=js")
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["articlesCount"]).To(Equal(float64(2)))
+
+			resp = Get("/api/articles?tag=react")
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["articlesCount"]).To(Equal(float64(1)))
+		})
+
+		It("rejects chained synonyms", func() {
+			json := `{"rule": {"kind": "synonym", "tag": "javascript", "target": "ecmascript"}}`
+			resp := PostWithToken("/api/admin/tags/rules", json, user.ID)
+			data = ParseJSON(resp, http.StatusBadRequest)
+			Expect(data["field"]).To(Equal("target"))
+
+			resp = GetWithToken("/api/admin/tags/rules", user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["rules"]).To(ConsistOf(
+				MatchKeys(IgnoreExtras, Keys{"kind": Equal("implies"), "tag": Equal("react"), "target": Equal("javascript")}),
+				MatchKeys(IgnoreExtras, Keys{"kind": Equal("synonym"), "tag": Equal("js"), "target": Equal("javascript")}),
+			))
+		})
 	})
 
 	Describe("listTags", func() {
@@ -356,3 +1690,30 @@ var _ = Describe("createArticle", func() {
 		})
 	})
 })
+
+var _ = Describe("request context", func() {
+	It("cancels queries when the client disconnects", func() {
+		reqCtx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := rwe.PGMain().ExecContext(reqCtx, "SELECT pg_sleep(10)")
+		Expect(err).To(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	It("returns 499 for canceled requests", func() {
+		reqCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		req := httptest.NewRequest("GET", "/api/articles", nil).WithContext(reqCtx)
+		resp := httptest.NewRecorder()
+		rwe.Router.ServeHTTP(resp, req)
+		Expect(resp.Code).To(Equal(499))
+	})
+
+	It("rejects queries without context", func() {
+		_, err := rwe.PGMain().Exec("SELECT 1")
+		Expect(err).To(MatchError(rwe.ErrQueryWithoutContext))
+	})
+})
@@ -1,9 +1,15 @@
 package blog
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
 	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/go-pg/urlstruct"
+	"github.com/uptrace/go-realworld-example-app/httputil"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 	"github.com/vmihailenco/treemux"
@@ -16,29 +22,156 @@ type ArticleFilter struct {
 	Favorited string
 	Slug      string
 	Feed      bool
+	Ranking   string
+	// Languages are preferred languages of the user. Lists skip articles in
+	// other languages, but keep articles without a language.
+	Languages []string
+	// Meta keeps articles with the metadata values, see decodeMetaFilters.
+	Meta map[string]string
 	urlstruct.Pager
+
+	// compiled makes the filter reference params with placeholders, see arg.
+	compiled bool
+}
+
+// Positional params of compiled article queries, see ArticleFilter.args.
+const (
+	argUserID = iota
+	argSlug
+	argAuthor
+	argTag
+	argNow
+	argLimit
+	argOffset
+	argLanguages
+	argMeta
+	argBoost
+)
+
+// arg returns the value to embed in the query or the placeholder for the value
+// when the query is compiled.
+func (f *ArticleFilter) arg(n int, value interface{}) interface{} {
+	if f.compiled {
+		return pg.Safe("?" + strconv.Itoa(n))
+	}
+	return value
+}
+
+// userArg is like arg, but returns nil for logged out users.
+func (f *ArticleFilter) userArg() interface{} {
+	if f.UserID == 0 {
+		return nil
+	}
+	return f.arg(argUserID, f.UserID)
+}
+
+// args returns the values of the placeholders in the order of arg positions.
+func (f *ArticleFilter) args() []interface{} {
+	return []interface{}{
+		f.UserID, f.Slug, f.Author, f.Tag, rwe.Clock.Now(),
+		f.Pager.GetLimit(), f.Pager.GetOffset(), pg.Array(f.Languages), f.metaJSON(),
+		verifiedBoost(),
+	}
+}
+
+// metaJSON returns the metadata filters as a JSON object.
+func (f *ArticleFilter) metaJSON() string {
+	if len(f.Meta) == 0 {
+		return "{}"
+	}
+	b, _ := json.Marshal(f.Meta)
+	return string(b)
+}
+
+// shape identifies compiled queries. Filters with the same shape differ only
+// in the values of params.
+func (f *ArticleFilter) shape() string {
+	return fmt.Sprintf("user=%t author=%t tag=%t slug=%t feed=%t ranking=%s languages=%t meta=%t",
+		f.UserID != 0, f.Author != "", f.Tag != "", f.Slug != "", f.Feed, f.Ranking,
+		f.filtersLanguages(), len(f.Meta) > 0)
+}
+
+var articleQueries rwe.QueryCache
+
+// selectOne selects a single article reusing the SQL compiled for the filter
+// shape.
+func (f *ArticleFilter) selectOne(ctx context.Context, article *Article) error {
+	q := rwe.PGMain().Model(article).Relation("Author")
+
+	query, err := articleQueries.Compile("one "+f.shape(), func() (string, error) {
+		return f.compile(q)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = rwe.PGMain().QueryOneContext(ctx, q.TableModel(), query, f.args()...)
+	return err
+}
+
+// selectPage is like selectOne, but selects a page of articles.
+func (f *ArticleFilter) selectPage(ctx context.Context, articles *[]*Article) error {
+	q := rwe.PGMain().Model(articles).Relation("Author")
+
+	query, err := articleQueries.Compile("page "+f.shape(), func() (string, error) {
+		query, err := f.compile(q)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s LIMIT ?%d OFFSET ?%d", query, argLimit, argOffset), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = rwe.PGMain().QueryContext(ctx, q.TableModel(), query, f.args()...)
+	return err
+}
+
+func (f *ArticleFilter) compile(q *orm.Query) (string, error) {
+	cf := *f
+	cf.compiled = true
+	return rwe.FormatSelect(rwe.PGMain(), q.Clone().
+		ColumnExpr("?TableColumns").
+		Apply(cf.query))
 }
 
 func decodeArticleFilter(req treemux.Request) (*ArticleFilter, error) {
 	ctx := req.Context()
 	query := req.URL.Query()
 
+	tag, err := canonicalTag(ctx, query.Get("tag"))
+	if err != nil {
+		return nil, err
+	}
+
 	f := &ArticleFilter{
-		Tag:       query.Get("tag"),
+		Tag:       tag,
 		Author:    query.Get("author"),
 		Favorited: query.Get("favorited"),
 		Slug:      req.Param("slug"),
+		Ranking:   decodeRanking(query.Get("ranking")),
+	}
+
+	meta, err := decodeMetaFilters(query)
+	if err != nil {
+		return nil, err
 	}
+	f.Meta = meta
+
+	f.Pager.Limit = httputil.QueryInt(req, "limit", 0)
+	f.Pager.Offset = httputil.QueryInt(req, "offset", 0)
 
 	if user := org.UserFromContext(ctx); user != nil {
 		f.UserID = user.ID
+		f.Languages = user.Languages
 	}
 
 	return f, nil
 }
 
 func (f *ArticleFilter) query(q *orm.Query) (*orm.Query, error) {
-	q = q.Relation("Author")
+	q = q.Apply(f.where)
 
 	{
 		subq := pg.Model((*ArticleTag)(nil)).
@@ -53,12 +186,13 @@ func (f *ArticleFilter) query(q *orm.Query) (*orm.Query, error) {
 	} else {
 		subq := pg.Model((*FavoriteArticle)(nil)).
 			Where("fa.article_id = a.id").
-			Where("fa.user_id = ?", f.UserID)
+			Where("fa.user_id = ?", f.userArg())
 
 		q = q.ColumnExpr("EXISTS (?) AS favorited", subq)
 	}
 
-	q.Apply(authorFollowingColumn(f.UserID))
+	q.Apply(authorFollowingColumn(f.userArg()))
+	q.Apply(commentsEnabledColumn(f.userArg()))
 
 	{
 		subq := pg.Model((*FavoriteArticle)(nil)).
@@ -68,15 +202,31 @@ func (f *ArticleFilter) query(q *orm.Query) (*orm.Query, error) {
 		q = q.ColumnExpr("(?) AS favorites_count", subq)
 	}
 
+	q = q.Apply(commentsPreviewColumns)
+
+	if f.Feed {
+		q = q.Apply(f.feedOrder)
+	}
+
+	return q, nil
+}
+
+// where applies the filter conditions without selecting any extra columns so
+// it can be used to count articles.
+func (f *ArticleFilter) where(q *orm.Query) (*orm.Query, error) {
+	q = q.Relation("Author").
+		Where("a.hidden_at IS NULL")
+
 	if f.Author != "" {
-		q = q.Where("author.username = ?", f.Author)
+		q = q.Where("author.username = ?", f.arg(argAuthor, f.Author))
 	}
 
+	// Articles with tags that imply the tag are listed too, see TagRule.
 	if f.Tag != "" {
 		subq := pg.Model((*ArticleTag)(nil)).
 			Distinct().
 			ColumnExpr("t.article_id").
-			Where("t.tag = ?", f.Tag)
+			Where("t.tag IN (?)", tagsImplying(f.arg(argTag, f.Tag)))
 
 		q = q.Where("a.id IN (?)", subq)
 	}
@@ -84,19 +234,69 @@ func (f *ArticleFilter) query(q *orm.Query) (*orm.Query, error) {
 	if f.Feed {
 		subq := pg.Model((*org.FollowUser)(nil)).
 			ColumnExpr("fu.followed_user_id").
-			Where("fu.user_id = ?", f.UserID)
+			Where("fu.user_id = ?", f.arg(argUserID, f.UserID))
 
 		q = q.Where("a.author_id IN (?)", subq)
 	} else if f.Slug != "" {
-		q = q.Where("a.slug = ?", f.Slug)
+		q = q.Where("a.slug = ?", f.arg(argSlug, f.Slug))
+	}
+
+	if f.filtersLanguages() {
+		q = q.Where("a.language IS NULL OR a.language = ANY(?)",
+			f.arg(argLanguages, pg.Array(f.Languages)))
 	}
 
+	if len(f.Meta) > 0 {
+		q = q.Where(`NOT EXISTS (
+			SELECT 1 FROM jsonb_each_text(?::jsonb) AS m
+			WHERE a.metadata ->> m.key IS DISTINCT FROM m.value
+		)`, f.arg(argMeta, f.metaJSON()))
+	}
+
+	return q, nil
+}
+
+// filtersLanguages reports whether lists are limited to preferred languages.
+// Articles requested by slug are always shown.
+func (f *ArticleFilter) filtersLanguages() bool {
+	return len(f.Languages) > 0 && f.Slug == ""
+}
+
+const commentPreviewLen = 200
+
+// commentsPreviewColumns selects the number of visible comments and the latest
+// one for every article in a single query.
+func commentsPreviewColumns(q *orm.Query) (*orm.Query, error) {
+	counts := pg.Model((*Comment)(nil)).
+		ColumnExpr("c.article_id, count(*) AS count").
+		Where("c.hidden_at IS NULL").
+		Group("c.article_id")
+
+	latest := pg.Model((*Comment)(nil)).
+		ColumnExpr("c.id, c.body, c.created_at, u.username").
+		Join("JOIN users AS u ON u.id = c.author_id").
+		Where("c.article_id = a.id").
+		Where("c.hidden_at IS NULL").
+		OrderExpr("c.created_at DESC, c.id DESC").
+		Limit(1)
+
+	q = q.Join("LEFT JOIN (?) AS cc ON cc.article_id = a.id", counts).
+		Join("LEFT JOIN LATERAL (?) AS lc ON true", latest).
+		ColumnExpr("coalesce(cc.count, 0) AS comments_count").
+		ColumnExpr(`CASE WHEN lc.id IS NULL THEN NULL ELSE json_build_object(
+			'id', lc.id,
+			'body', left(lc.body, ?),
+			'author', lc.username,
+			'createdAt', lc.created_at
+		) END AS latest_comment`, commentPreviewLen)
 	return q, nil
 }
 
-func authorFollowingColumn(userID uint64) func(*orm.Query) (*orm.Query, error) {
+// authorFollowingColumn reports whether the user follows the author. Nil userID
+// means a logged out user.
+func authorFollowingColumn(userID interface{}) func(*orm.Query) (*orm.Query, error) {
 	return func(q *orm.Query) (*orm.Query, error) {
-		if userID == 0 {
+		if userID == nil {
 			q = q.ColumnExpr("false AS author__following")
 		} else {
 			subq := rwe.PGMain().Model((*org.FollowUser)(nil)).
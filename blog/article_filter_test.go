@@ -0,0 +1,42 @@
+package blog
+
+import (
+	"testing"
+
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+// BenchmarkArticleQuery compares building and formatting the article detail
+// query on every request with reusing the compiled query. Both select the
+// author like selectOne and exclude the round trip to the database.
+func BenchmarkArticleQuery(b *testing.B) {
+	f := &ArticleFilter{UserID: 1, Slug: "hello-world-1"}
+
+	b.Run("builder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			q := rwe.PGMain().Model(new(Article)).
+				Relation("Author").
+				ColumnExpr("?TableColumns").
+				Apply(f.query)
+			if _, err := rwe.FormatSelect(rwe.PGMain(), q); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		query, err := f.compile(rwe.PGMain().Model(new(Article)).Relation("Author"))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// selectOne still builds the model to scan the row into.
+			_ = rwe.PGMain().Model(new(Article)).Relation("Author").TableModel()
+			_ = rwe.PGMain().Formatter().FormatQuery(nil, query, f.args()...)
+		}
+	})
+}
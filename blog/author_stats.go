@@ -0,0 +1,92 @@
+package blog
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 90
+)
+
+// AuthorStats are the favorites and comments that articles of the author got
+// from other users on a day. Days are in the time zone of the author.
+type AuthorStats struct {
+	Date      string `json:"date"`
+	Favorites int    `json:"favorites"`
+	Comments  int    `json:"comments"`
+}
+
+type authorStatsRow struct {
+	Date  string
+	Count int
+}
+
+// SelectAuthorStats returns stats for the last days including today, oldest
+// first. Days without favorites and comments are included with zero counts.
+func SelectAuthorStats(ctx context.Context, user *org.User, days int) ([]*AuthorStats, error) {
+	loc := user.Location()
+	now := rwe.Clock.Now()
+	start := rwe.StartOfDay(rwe.AddDays(now, 1-days, loc), loc)
+	end := rwe.StartOfDay(rwe.AddDays(now, 1, loc), loc)
+
+	stats := make([]*AuthorStats, days)
+	first := start.In(loc)
+	for i := range stats {
+		// Dates are labels, so they are computed in UTC where every day is
+		// 24 hours long.
+		date := time.Date(first.Year(), first.Month(), first.Day()+i, 0, 0, 0, 0, time.UTC)
+		stats[i] = &AuthorStats{Date: date.Format("2006-01-02")}
+	}
+
+	favorites, err := countByLocalDate(rwe.PGMain().ModelContext(ctx, (*FavoriteArticle)(nil)).
+		Join("JOIN articles AS a ON a.id = fa.article_id").
+		Where("a.author_id = ?", user.ID).
+		Where("fa.user_id != a.author_id"),
+		"fa.created_at", start, end, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := countByLocalDate(rwe.PGMain().ModelContext(ctx, (*Comment)(nil)).
+		Join("JOIN articles AS a ON a.id = c.article_id").
+		Where("a.author_id = ?", user.ID).
+		Where("c.author_id != a.author_id"),
+		"c.created_at", start, end, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stats {
+		s.Favorites = favorites[s.Date]
+		s.Comments = comments[s.Date]
+	}
+	return stats, nil
+}
+
+// countByLocalDate counts rows of the query created between start and end by
+// the local date of the column.
+func countByLocalDate(
+	q *orm.Query, column string, start, end time.Time, loc *time.Location,
+) (map[string]int, error) {
+	var rows []authorStatsRow
+	if err := q.ColumnExpr("? AS date, count(*) AS count", rwe.LocalDate(column, loc)).
+		Where("? >= ?", pg.Ident(column), start).
+		Where("? < ?", pg.Ident(column), end).
+		GroupExpr("1").
+		Select(&rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Date] = row.Count
+	}
+	return counts, nil
+}
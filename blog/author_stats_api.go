@@ -0,0 +1,26 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/vmihailenco/treemux"
+)
+
+// authorStatsHandler returns the author dashboard: favorites and comments of
+// the articles of the current user per day in the time zone of the user.
+func authorStatsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	stats, err := SelectAuthorStats(ctx, user, httputil.QueryInt(req, "days", defaultStatsDays))
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"stats":    stats,
+		"timeZone": user.Location().String(),
+	})
+}
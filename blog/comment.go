@@ -1,9 +1,14 @@
 package blog
 
 import (
+	"context"
 	"time"
 
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
 )
 
 type Comment struct {
@@ -17,6 +22,135 @@ type Comment struct {
 
 	ArticleID uint64 `json:"-"`
 
+	// ParentID is the comment this comment replies to. Depth is 0 for
+	// top-level comments.
+	ParentID uint64 `json:"parentId"`
+	Depth    int    `json:"-" pg:",use_zero"`
+
+	HiddenAt     time.Time `json:"-"`
+	HiddenReason string    `json:"-"`
+	LegalHold    bool      `json:"-"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+func (c *Comment) normalizeText() error {
+	return textutil.Text("body", &c.Body, 0)
+}
+
+// CommentPreview is the latest comment shown in article listings.
+type CommentPreview struct {
+	ID        uint64    `json:"id"`
+	Body      string    `json:"body"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const defaultMaxCommentDepth = 3
+
+func maxCommentDepth() int {
+	if n := rwe.Config.Comments.MaxDepth; n > 0 {
+		return n
+	}
+	return defaultMaxCommentDepth
+}
+
+// setCommentParent attaches the reply to the parent comment. Replies to
+// comments at maxCommentDepth are flattened, i.e. attached to the closest
+// ancestor that can have replies, so they become siblings of the parent.
+func setCommentParent(ctx context.Context, comment *Comment) error {
+	parent := new(Comment)
+	if err := rwe.PGMain().ModelContext(ctx, parent).
+		Column("id", "parent_id", "depth").
+		Where("id = ?", comment.ParentID).
+		Where("article_id = ?", comment.ArticleID).
+		Where("hidden_at IS NULL").
+		Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return apperr.Validation("parentId", "parent comment does not exist")
+		}
+		return err
+	}
+
+	for parent.Depth >= maxCommentDepth() && parent.ParentID != 0 {
+		ancestor := new(Comment)
+		if err := rwe.PGMain().ModelContext(ctx, ancestor).
+			Column("id", "parent_id", "depth").
+			Where("id = ?", parent.ParentID).
+			Select(); err != nil {
+			return err
+		}
+		parent = ancestor
+	}
+
+	comment.ParentID = parent.ID
+	comment.Depth = parent.Depth + 1
+	if comment.Depth > maxCommentDepth() {
+		// The parent lost its own parent and kept a stale depth.
+		comment.Depth = maxCommentDepth()
+	}
+	return nil
+}
+
+// commentTree nests replies under their parents keeping the order of
+// comments. Replies to hidden comments are shown at the top level.
+func commentTree(comments []*CommentResponse) []*CommentResponse {
+	byID := make(map[uint64]*CommentResponse, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	roots := make([]*CommentResponse, 0)
+	for _, comment := range comments {
+		if parent, ok := byID[comment.ParentID]; ok && comment.ParentID != 0 {
+			parent.Replies = append(parent.Replies, comment)
+			continue
+		}
+		roots = append(roots, comment)
+	}
+	return roots
+}
+
+const maxParticipants = 10
+
+// SelectParticipants returns the author and commenters of the article whose
+// usernames start with prefix. The viewer is excluded because users don't
+// mention themselves. Nil userID means a logged out user.
+func SelectParticipants(
+	ctx context.Context, slug, prefix string, userID interface{},
+) ([]*org.Profile, error) {
+	article := pg.Model((*Article)(nil)).
+		Where("a.slug = ?", slug).
+		Where("a.hidden_at IS NULL")
+
+	authors := article.Clone().ColumnExpr("a.author_id")
+	commenters := pg.Model((*Comment)(nil)).
+		ColumnExpr("c.author_id").
+		Where("c.article_id IN (?)", article.Clone().Column("a.id")).
+		Where("c.hidden_at IS NULL")
+
+	profiles := make([]*org.Profile, 0)
+	q := rwe.PGMain().ModelContext(ctx, &profiles).
+		Column("u.id", "u.username", "u.bio", "u.image", "u.verified").
+		Where("u.id IN (?)", authors.Union(commenters)).
+		Where("u.username ILIKE ?", likeEscaper.Replace(prefix)+"%").
+		OrderExpr("u.username ASC").
+		Limit(maxParticipants)
+
+	if userID == nil {
+		q = q.ColumnExpr("false AS following")
+	} else {
+		subq := pg.Model((*org.FollowUser)(nil)).
+			Where("fu.followed_user_id = u.id").
+			Where("fu.user_id = ?", userID)
+
+		q = q.ColumnExpr("EXISTS (?) AS following", subq).
+			Where("u.id != ?", userID)
+	}
+
+	if err := q.Select(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
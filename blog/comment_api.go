@@ -1,9 +1,9 @@
 package blog
 
 import (
-	"errors"
 	"net/http"
 
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/uptrace/go-realworld-example-app/httputil"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
@@ -18,7 +18,7 @@ func listCommentsHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
-	var userID uint64
+	var userID interface{}
 	if user := org.UserFromContext(ctx); user != nil {
 		userID = user.ID
 	}
@@ -29,12 +29,19 @@ func listCommentsHandler(w http.ResponseWriter, req treemux.Request) error {
 		Relation("Author").
 		Apply(authorFollowingColumn(userID)).
 		Where("article_id = ?", article.ID).
+		Where("c.hidden_at IS NULL").
+		OrderExpr("c.created_at ASC, c.id ASC").
 		Select(); err != nil {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"comments": comments,
+	resp := NewCommentResponses(comments)
+	if req.URL.Query().Get("view") == "tree" {
+		resp = commentTree(resp)
+	}
+
+	return rwe.JSON(w, req, treemux.H{
+		"comments": resp,
 	})
 }
 
@@ -51,7 +58,7 @@ func showCommentHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
-	var userID uint64
+	var userID interface{}
 	if user := org.UserFromContext(ctx); user != nil {
 		userID = user.ID
 	}
@@ -63,12 +70,13 @@ func showCommentHandler(w http.ResponseWriter, req treemux.Request) error {
 		Apply(authorFollowingColumn(userID)).
 		Where("c.id = ?", id).
 		Where("article_id = ?", article.ID).
+		Where("c.hidden_at IS NULL").
 		Select(); err != nil {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"comment": comment,
+	return httputil.JSON(w, treemux.H{
+		"comment": NewCommentResponse(comment),
 	})
 }
 
@@ -85,30 +93,47 @@ func createCommentHandler(w http.ResponseWriter, req treemux.Request) error {
 		Comment *Comment `json:"comment"`
 	}
 
-	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+	if err := httputil.UnmarshalJSON(w, req, &in, maxCommentSize); err != nil {
 		return err
 	}
 
 	if in.Comment == nil {
-		return errors.New(`JSON field "comment" is required`)
+		return apperr.Required("comment")
+	}
+
+	if err := article.checkCommentPolicy(ctx, user.ID); err != nil {
+		return err
 	}
 
 	comment := in.Comment
+	if err := comment.normalizeText(); err != nil {
+		return err
+	}
 
 	comment.AuthorID = user.ID
 	comment.ArticleID = article.ID
+	comment.Depth = 0
 	comment.CreatedAt = rwe.Clock.Now()
 	comment.UpdatedAt = rwe.Clock.Now()
 
+	if comment.ParentID != 0 {
+		if err := setCommentParent(ctx, comment); err != nil {
+			return err
+		}
+	}
+
 	if _, err := rwe.PGMain().
 		ModelContext(ctx, comment).
 		Insert(); err != nil {
 		return err
 	}
+	if article.AuthorID != user.ID {
+		rwe.PublishActivity(ctx, article.AuthorID)
+	}
 
 	comment.Author = org.NewProfile(user)
-	return treemux.JSON(w, treemux.H{
-		"comment": comment,
+	return httputil.JSON(w, treemux.H{
+		"comment": NewCommentResponse(comment),
 	})
 }
 
@@ -121,6 +146,10 @@ func deleteCommentHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
+	if err := checkCommentsLegalHold(ctx, user.ID, article.ID); err != nil {
+		return err
+	}
+
 	if _, err := rwe.PGMain().
 		ModelContext(ctx, (*Comment)(nil)).
 		Where("author_id = ?", user.ID).
@@ -131,3 +160,26 @@ func deleteCommentHandler(w http.ResponseWriter, req treemux.Request) error {
 
 	return nil
 }
+
+func listParticipantsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	var userID interface{}
+	if user := org.UserFromContext(ctx); user != nil {
+		userID = user.ID
+	}
+
+	profiles, err := SelectParticipants(ctx, req.Param("slug"), req.URL.Query().Get("q"), userID)
+	if err != nil {
+		return err
+	}
+
+	participants := make([]*org.ProfileResponse, len(profiles))
+	for i, profile := range profiles {
+		participants[i] = org.NewProfileResponse(profile)
+	}
+
+	return rwe.JSON(w, req, treemux.H{
+		"participants": participants,
+	})
+}
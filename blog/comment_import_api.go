@@ -0,0 +1,261 @@
+package blog
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+// ExportedComment is the portable comment format. Authors are referenced by
+// email and username so comments can be moved between databases.
+type ExportedComment struct {
+	ID     uint64          `json:"id,omitempty"`
+	Body   string          `json:"body"`
+	Author *ExportedAuthor `json:"author"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ExportedAuthor struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+func exportCommentsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	article, err := SelectArticle(ctx, req.Param("slug"))
+	if err != nil {
+		return err
+	}
+
+	if httputil.WantsNDJSON(req) {
+		return streamComments(ctx, httputil.NewNDJSONWriter(w, req), article.ID)
+	}
+
+	comments := make([]*Comment, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &comments).
+		Where("article_id = ?", article.ID).
+		OrderExpr("c.created_at ASC, c.id ASC").
+		Select(); err != nil {
+		return err
+	}
+
+	authors, err := selectExportedAuthors(ctx, comments)
+	if err != nil {
+		return err
+	}
+
+	exported := make([]*ExportedComment, len(comments))
+	for i, comment := range comments {
+		exported[i] = &ExportedComment{
+			ID:        comment.ID,
+			Body:      comment.Body,
+			Author:    authors[comment.AuthorID],
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+		}
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"comments": exported,
+	})
+}
+
+// exportedCommentRow is scanned by the streaming export one row at a time.
+type exportedCommentRow struct {
+	ID             uint64
+	Body           string
+	AuthorUsername string
+	AuthorEmail    string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// streamComments writes comments as they are read from the database instead
+// of loading all of them first.
+func streamComments(ctx context.Context, enc *httputil.NDJSONWriter, articleID uint64) error {
+	return rwe.PGMain().ModelContext(ctx, (*Comment)(nil)).
+		Column("c.id", "c.body", "c.created_at", "c.updated_at").
+		ColumnExpr("u.username AS author_username, u.email AS author_email").
+		Join("JOIN users AS u ON u.id = c.author_id").
+		Where("c.article_id = ?", articleID).
+		OrderExpr("c.created_at ASC, c.id ASC").
+		ForEach(func(row *exportedCommentRow) error {
+			return enc.Encode(&ExportedComment{
+				ID:   row.ID,
+				Body: row.Body,
+				Author: &ExportedAuthor{
+					Username: row.AuthorUsername,
+					Email:    row.AuthorEmail,
+				},
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+			})
+		})
+}
+
+func selectExportedAuthors(
+	ctx context.Context, comments []*Comment,
+) (map[uint64]*ExportedAuthor, error) {
+	authors := make(map[uint64]*ExportedAuthor)
+	if len(comments) == 0 {
+		return authors, nil
+	}
+
+	ids := make([]uint64, 0, len(comments))
+	for _, comment := range comments {
+		ids = append(ids, comment.AuthorID)
+	}
+
+	users := make([]*org.User, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &users).
+		Column("id", "username", "email").
+		Where("id IN (?)", pg.In(ids)).
+		Select(); err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		authors[user.ID] = &ExportedAuthor{
+			Username: user.Username,
+			Email:    user.Email,
+		}
+	}
+	return authors, nil
+}
+
+func importCommentsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	article, err := SelectArticle(ctx, req.Param("slug"))
+	if err != nil {
+		return err
+	}
+
+	var in struct {
+		Comments []*ExportedComment `json:"comments"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<mb); err != nil {
+		return err
+	}
+
+	if in.Comments == nil {
+		return apperr.Required("comments")
+	}
+
+	authorIDs, err := resolveImportedAuthors(ctx, in.Comments)
+	if err != nil {
+		return err
+	}
+
+	comments := make([]*Comment, len(in.Comments))
+	for i, src := range in.Comments {
+		if src.CreatedAt.IsZero() {
+			src.CreatedAt = rwe.Clock.Now()
+		}
+		if src.UpdatedAt.IsZero() {
+			src.UpdatedAt = src.CreatedAt
+		}
+
+		comments[i] = &Comment{
+			Body:      src.Body,
+			AuthorID:  authorIDs[i],
+			ArticleID: article.ID,
+			CreatedAt: src.CreatedAt,
+			UpdatedAt: src.UpdatedAt,
+		}
+		if err := comments[i].normalizeText(); err != nil {
+			return err
+		}
+	}
+
+	if len(comments) > 0 {
+		if err := rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+			_, err := tx.ModelContext(ctx, &comments).Insert()
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"imported": len(comments),
+	})
+}
+
+// resolveImportedAuthors maps imported authors to local users by email and
+// then by username. Import fails if any author can't be found.
+func resolveImportedAuthors(ctx context.Context, comments []*ExportedComment) ([]uint64, error) {
+	var emails, usernames []string
+	for i, comment := range comments {
+		if comment.Author == nil || (comment.Author.Email == "" && comment.Author.Username == "") {
+			return nil, apperr.Validation("author",
+				"comment #%d must have author email or username", i)
+		}
+		if comment.Author.Email != "" {
+			emails = append(emails, comment.Author.Email)
+		}
+		if comment.Author.Username != "" {
+			usernames = append(usernames, comment.Author.Username)
+		}
+	}
+
+	users := make([]*org.User, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &users).
+		Column("id", "username", "email").
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			if len(emails) > 0 {
+				q = q.WhereOr("email IN (?)", pg.In(emails))
+			}
+			if len(usernames) > 0 {
+				q = q.WhereOr("username IN (?)", pg.In(usernames))
+			}
+			return q, nil
+		}).
+		Select(); err != nil {
+		return nil, err
+	}
+
+	byEmail := make(map[string]uint64, len(users))
+	byUsername := make(map[string]uint64, len(users))
+	for _, user := range users {
+		byEmail[user.Email] = user.ID
+		byUsername[user.Username] = user.ID
+	}
+
+	ids := make([]uint64, len(comments))
+	var missing []string
+	for i, comment := range comments {
+		if id, ok := byEmail[comment.Author.Email]; ok && comment.Author.Email != "" {
+			ids[i] = id
+			continue
+		}
+		if id, ok := byUsername[comment.Author.Username]; ok && comment.Author.Username != "" {
+			ids[i] = id
+			continue
+		}
+		if comment.Author.Email != "" {
+			missing = append(missing, comment.Author.Email)
+		} else {
+			missing = append(missing, comment.Author.Username)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, apperr.Validation("author",
+			"authors are not registered: %s", strings.Join(missing, ", "))
+	}
+	return ids, nil
+}
@@ -0,0 +1,78 @@
+package blog
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	CommentsEveryone  = "everyone"
+	CommentsFollowers = "followers"
+	CommentsOff       = "off"
+)
+
+var (
+	errCommentsOff = apperr.New(apperr.CommentsDisabled,
+		"comments are disabled for this article")
+	errCommentsFollowers = apperr.New(apperr.CommentsDisabled,
+		"only followers of the author can comment on this article")
+)
+
+func validateCommentPolicy(policy string) error {
+	switch policy {
+	case CommentsEveryone, CommentsFollowers, CommentsOff:
+		return nil
+	default:
+		return apperr.Validation("commentPolicy",
+			"commentPolicy must be one of everyone, followers, or off")
+	}
+}
+
+// commentsEnabledColumn reports whether the user can comment on the article.
+// Nil userID means a logged out user.
+func commentsEnabledColumn(userID interface{}) func(*orm.Query) (*orm.Query, error) {
+	return func(q *orm.Query) (*orm.Query, error) {
+		if userID == nil {
+			q = q.ColumnExpr("a.comment_policy = ? AS comments_enabled", CommentsEveryone)
+			return q, nil
+		}
+
+		subq := pg.Model((*org.FollowUser)(nil)).
+			Where("fu.followed_user_id = a.author_id").
+			Where("fu.user_id = ?", userID)
+
+		q = q.ColumnExpr("CASE a.comment_policy WHEN ? THEN true "+
+			"WHEN ? THEN a.author_id = ? OR EXISTS (?) "+
+			"ELSE false END AS comments_enabled",
+			CommentsEveryone, CommentsFollowers, userID, subq)
+		return q, nil
+	}
+}
+
+func (a *Article) checkCommentPolicy(ctx context.Context, userID uint64) error {
+	switch a.CommentPolicy {
+	case CommentsOff:
+		return errCommentsOff
+	case CommentsFollowers:
+		if userID == a.AuthorID {
+			return nil
+		}
+
+		follows, err := rwe.PGMain().ModelContext(ctx, (*org.FollowUser)(nil)).
+			Where("fu.followed_user_id = ?", a.AuthorID).
+			Where("fu.user_id = ?", userID).
+			Exists()
+		if err != nil {
+			return err
+		}
+		if !follows {
+			return errCommentsFollowers
+		}
+	}
+	return nil
+}
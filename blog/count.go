@@ -0,0 +1,45 @@
+package blog
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+// selectCount counts rows matching the query. Up to threshold rows are counted
+// exactly. Above the threshold the count is estimated by the query planner,
+// which uses pg_class.reltuples statistics, and exact is false. Zero threshold
+// always counts exactly.
+func selectCount(ctx context.Context, q *orm.Query, threshold int) (count int, exact bool, _ error) {
+	if threshold <= 0 {
+		count, err := q.Count()
+		return count, true, err
+	}
+
+	bounded := q.Clone().ColumnExpr("1").Limit(threshold + 1)
+	if _, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&count),
+		"SELECT count(*) FROM (?) AS bounded", bounded); err != nil {
+		return 0, false, err
+	}
+	if count <= threshold {
+		return count, true, nil
+	}
+
+	estimate, err := q.CountEstimate(threshold)
+	if err != nil {
+		return 0, false, err
+	}
+	// The planner can underestimate, but there are at least count rows.
+	if estimate < count {
+		estimate = count
+	}
+	return estimate, false, nil
+}
+
+func countArticles(ctx context.Context, f *ArticleFilter, endpoint string) (int, bool, error) {
+	q := rwe.PGMain().ModelContext(ctx, (*Article)(nil)).
+		Apply(f.where)
+	return selectCount(ctx, q, rwe.CountThreshold(endpoint))
+}
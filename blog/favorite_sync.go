@@ -0,0 +1,240 @@
+package blog
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+// syncTokenTTL must be shorter than the retention of favorite tombstones so
+// clients with a valid token don't miss unfavorites.
+const syncTokenTTL = 30 * 24 * time.Hour
+
+var errSyncTokenExpired = apperr.Validation("since",
+	"sync token is malformed or expired, export all favorites without since")
+
+// FavoriteTombstone records an unfavorite so clients syncing favorites can
+// remove the article.
+type FavoriteTombstone struct {
+	tableName struct{} `pg:"favorite_tombstones,alias:ft"`
+
+	ID        uint64
+	UserID    uint64
+	ArticleID uint64
+	Slug      string
+	DeletedAt time.Time
+}
+
+type SyncedFavorite struct {
+	Slug        string    `json:"slug"`
+	FavoritedAt time.Time `json:"favoritedAt"`
+}
+
+type RemovedFavorite struct {
+	Slug      string    `json:"slug"`
+	RemovedAt time.Time `json:"removedAt"`
+}
+
+// FavoritesExport contains favorites changed since the sync token. The full
+// export has no removed favorites.
+type FavoritesExport struct {
+	Favorites []*SyncedFavorite  `json:"favorites"`
+	Removed   []*RemovedFavorite `json:"removed"`
+	SyncToken string             `json:"syncToken"`
+}
+
+func encodeSyncToken(tm time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(tm.Format(time.RFC3339Nano)))
+}
+
+func decodeSyncToken(s string) (time.Time, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, errSyncTokenExpired
+	}
+	tm, err := time.Parse(time.RFC3339Nano, string(b))
+	if err != nil || rwe.Clock.Now().Sub(tm) > syncTokenTTL {
+		return time.Time{}, errSyncTokenExpired
+	}
+	return tm, nil
+}
+
+// addFavoriteTombstone must be called in the transaction that deletes the
+// favorite.
+func addFavoriteTombstone(ctx context.Context, tx *pg.Tx, userID uint64, article *Article) error {
+	_, err := tx.ModelContext(ctx, &FavoriteTombstone{
+		UserID:    userID,
+		ArticleID: article.ID,
+		Slug:      article.Slug,
+		DeletedAt: rwe.Clock.Now(),
+	}).
+		OnConflict("(user_id, article_id) DO UPDATE").
+		Set("deleted_at = EXCLUDED.deleted_at").
+		Insert()
+	return err
+}
+
+// addArticleTombstones records the articles of the author as unfavorited by
+// everyone who favorited them. With an empty slug all articles of the author
+// are recorded. It must be called in the transaction that deletes the
+// articles.
+func addArticleTombstones(ctx context.Context, tx *pg.Tx, authorID uint64, slug string) error {
+	q := tx.ModelContext(ctx, (*FavoriteArticle)(nil)).
+		ColumnExpr("fa.user_id, a.id, a.slug, ?::timestamptz", rwe.Clock.Now()).
+		Join("JOIN articles AS a ON a.id = fa.article_id").
+		Where("a.author_id = ?", authorID)
+	if slug != "" {
+		q = q.Where("a.slug = ?", slug)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO favorite_tombstones (user_id, article_id, slug, deleted_at)
+		?
+		ON CONFLICT (user_id, article_id) DO UPDATE SET deleted_at = EXCLUDED.deleted_at
+	`, q)
+	return err
+}
+
+func deleteFavoriteTombstone(ctx context.Context, db orm.DB, userID, articleID uint64) error {
+	_, err := db.ModelContext(ctx, (*FavoriteTombstone)(nil)).
+		Where("user_id = ?", userID).
+		Where("article_id = ?", articleID).
+		Delete()
+	return err
+}
+
+// SelectFavoritesExport returns favorites of the user changed after since or
+// all favorites when since is zero.
+func SelectFavoritesExport(ctx context.Context, userID uint64, since time.Time) (*FavoritesExport, error) {
+	export := &FavoritesExport{
+		Favorites: make([]*SyncedFavorite, 0),
+		Removed:   make([]*RemovedFavorite, 0),
+		SyncToken: encodeSyncToken(rwe.Clock.Now()),
+	}
+
+	q := rwe.PGMain().ModelContext(ctx, (*FavoriteArticle)(nil)).
+		ColumnExpr("a.slug, fa.created_at AS favorited_at").
+		Join("JOIN articles AS a ON a.id = fa.article_id").
+		Where("fa.user_id = ?", userID).
+		Where("a.hidden_at IS NULL").
+		OrderExpr("fa.created_at ASC")
+	if !since.IsZero() {
+		q = q.Where("fa.created_at > ?", since)
+	}
+	if err := q.Select(&export.Favorites); err != nil {
+		return nil, err
+	}
+
+	if since.IsZero() {
+		return export, nil
+	}
+
+	if err := rwe.PGMain().ModelContext(ctx, (*FavoriteTombstone)(nil)).
+		ColumnExpr("ft.slug, ft.deleted_at AS removed_at").
+		Where("ft.user_id = ?", userID).
+		Where("ft.deleted_at > ?", since).
+		OrderExpr("ft.deleted_at ASC").
+		Select(&export.Removed); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// FavoritesExportBatch is how many rows the streaming export reads per query.
+var FavoritesExportBatch = 1000
+
+type syncedFavoriteRow struct {
+	ArticleID   uint64
+	Slug        string
+	FavoritedAt time.Time
+}
+
+type removedFavoriteRow struct {
+	ID        uint64
+	Slug      string
+	RemovedAt time.Time
+}
+
+// streamFavoritesExport writes favorites and then removed favorites since the
+// sync token one per line. Rows are read in keyset paginated batches instead
+// of with a cursor, so a slow client doesn't hold a connection for the whole
+// export.
+func streamFavoritesExport(
+	ctx context.Context, enc *httputil.NDJSONWriter, userID uint64, since time.Time,
+) error {
+	var lastFavorite *syncedFavoriteRow
+	for {
+		rows := make([]*syncedFavoriteRow, 0, FavoritesExportBatch)
+		q := rwe.PGMain().ModelContext(ctx, (*FavoriteArticle)(nil)).
+			ColumnExpr("fa.article_id, a.slug, fa.created_at AS favorited_at").
+			Join("JOIN articles AS a ON a.id = fa.article_id").
+			Where("fa.user_id = ?", userID).
+			Where("a.hidden_at IS NULL").
+			OrderExpr("fa.created_at ASC, fa.article_id ASC").
+			Limit(FavoritesExportBatch)
+		if !since.IsZero() {
+			q = q.Where("fa.created_at > ?", since)
+		}
+		if lastFavorite != nil {
+			q = q.Where("(fa.created_at, fa.article_id) > (?, ?)",
+				lastFavorite.FavoritedAt, lastFavorite.ArticleID)
+		}
+		if err := q.Select(&rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := enc.Encode(&SyncedFavorite{
+				Slug:        row.Slug,
+				FavoritedAt: row.FavoritedAt,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(rows) < FavoritesExportBatch {
+			break
+		}
+		lastFavorite = rows[len(rows)-1]
+	}
+
+	if since.IsZero() {
+		return nil
+	}
+
+	var lastRemoved *removedFavoriteRow
+	for {
+		rows := make([]*removedFavoriteRow, 0, FavoritesExportBatch)
+		q := rwe.PGMain().ModelContext(ctx, (*FavoriteTombstone)(nil)).
+			ColumnExpr("ft.id, ft.slug, ft.deleted_at AS removed_at").
+			Where("ft.user_id = ?", userID).
+			Where("ft.deleted_at > ?", since).
+			OrderExpr("ft.deleted_at ASC, ft.id ASC").
+			Limit(FavoritesExportBatch)
+		if lastRemoved != nil {
+			q = q.Where("(ft.deleted_at, ft.id) > (?, ?)", lastRemoved.RemovedAt, lastRemoved.ID)
+		}
+		if err := q.Select(&rows); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := enc.Encode(&RemovedFavorite{
+				Slug:      row.Slug,
+				RemovedAt: row.RemovedAt,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(rows) < FavoritesExportBatch {
+			return nil
+		}
+		lastRemoved = rows[len(rows)-1]
+	}
+}
@@ -0,0 +1,21 @@
+package blog
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// FavoritesCountFlag turns on dual writes of articles.favorites_count. Lists
+// still count favorite_articles until the articles_favorites_count backfill of
+// migrate_db is done, then they can read the column instead of the subquery.
+const FavoritesCountFlag = "articles_favorites_count"
+
+// addFavoritesCount is the shadow write of favoriting and unfavoriting, see
+// migrate.DualWrite.
+func addFavoritesCount(ctx context.Context, tx *pg.Tx, articleID uint64, delta int) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE articles SET favorites_count = favorites_count + ? WHERE id = ?
+	`, delta, articleID)
+	return err
+}
@@ -1,19 +1,91 @@
 package blog
 
 import (
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/experiment"
+	"github.com/uptrace/go-realworld-example-app/httputil"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 )
 
+var (
+	articlesQuery = httputil.Query{
+		"limit":  httputil.IntRange(1, 100),
+		"offset": httputil.IntRange(0, 1e6),
+	}
+	feedQuery = httputil.Query{
+		"limit":   httputil.IntRange(1, 100),
+		"offset":  httputil.IntRange(0, 1e6),
+		"ranking": httputil.OneOf(RankingChronological, RankingEngagement, RankingAffinity),
+	}
+	leaderboardQuery = httputil.Query{
+		"period": httputil.OneOf("week", "month", "all"),
+	}
+	commentsQuery = httputil.Query{
+		"view": httputil.OneOf("flat", "tree"),
+	}
+	participantsQuery = httputil.Query{
+		"q": httputil.Name,
+	}
+	activityQuery = httputil.Query{
+		"limit": httputil.IntRange(1, 100),
+	}
+	pollQuery = httputil.Query{
+		"timeout": httputil.IntRange(1, maxPollTimeout),
+	}
+	statsQuery = httputil.Query{
+		"days": httputil.IntRange(1, maxStatsDays),
+	}
+)
+
+// Latency budgets of the list endpoints, see rwe.LatencyBudget.
+const (
+	listBudget = 300 * time.Millisecond
+	feedBudget = 500 * time.Millisecond
+)
+
 func init() {
+	org.RegisterPendingAction(ActionFavorite, redeemFavorite)
+	rwe.RegisterJob(accountDeletionJob, runAccountDeletion)
+	experiment.Register(FeedRankingExperiment,
+		RankingChronological, RankingEngagement, RankingAffinity)
+
+	rwe.Router.GET("/articles/:slug", articlePageHandler)
+	rwe.Router.GET("/profiles/:username", profilePageHandler)
+
+	rwe.API.GET("/meta", metaHandler)
+	rwe.Internal.POST("/analytics/views", ingestViewsHandler)
+
 	g := rwe.API.WithMiddleware(org.UserMiddleware)
 
-	g.GET("/tags/", listTagsHandler)
-	g.GET("/articles", listArticlesHandler)
-	g.GET("/articles/feed", articleFeedHandler)
+	g.WithMiddleware(rwe.LatencyBudget(listBudget)).GET("/tags/", listTagsHandler)
+	g.WithMiddleware(articlesQuery.Middleware).
+		WithMiddleware(rwe.LatencyBudget(listBudget)).
+		GET("/articles", listArticlesHandler)
+	g.WithMiddleware(feedQuery.Middleware).
+		WithMiddleware(rwe.LatencyBudget(feedBudget)).
+		GET("/articles/feed", articleFeedHandler)
 	g.GET("/articles/:slug", showArticleHandler)
-	g.GET("/articles/:slug/comments", listCommentsHandler)
+	g.WithMiddleware(commentsQuery.Middleware).
+		WithMiddleware(rwe.LatencyBudget(listBudget)).
+		GET("/articles/:slug/comments", listCommentsHandler)
 	g.GET("/articles/:slug/comments/:id", showCommentHandler)
+	g.WithMiddleware(participantsQuery.Middleware).
+		WithMiddleware(rwe.LatencyBudget(listBudget)).
+		GET("/articles/:slug/participants", listParticipantsHandler)
+	g.WithMiddleware(leaderboardQuery.Middleware).
+		WithMiddleware(rwe.LatencyBudget(feedBudget)).
+		GET("/leaderboard", leaderboardHandler)
+	g.WithMiddleware(rwe.ThrottleMiddleware(rwe.ThrottleSearch)).
+		GET("/search/suggest", searchSuggestHandler)
+	g.GET("/subscriptions/rss/:token", subscriptionsRSSHandler)
+	g.WithMiddleware(rwe.ThrottleMiddleware(rwe.ThrottleImport)).
+		WithMiddleware(httputil.DecompressMiddleware).
+		POST("/users/import", importAccountHandler)
+
+	g.WithMiddleware(org.DeferMiddleware(ActionFavorite, "slug")).
+		POST("/articles/:slug/favorite", favoriteArticleHandler)
 
 	g = g.WithMiddleware(org.MustUserMiddleware)
 
@@ -21,9 +93,56 @@ func init() {
 	g.PUT("/articles/:slug", updateArticleHandler)
 	g.DELETE("/articles/:slug", deleteArticleHandler)
 
-	g.POST("/articles/:slug/favorite", favoriteArticleHandler)
 	g.DELETE("/articles/:slug/favorite", unfavoriteArticleHandler)
 
 	g.POST("/articles/:slug/comments", createCommentHandler)
 	g.DELETE("/articles/:slug/comments/:id", deleteCommentHandler)
+
+	e := g.WithMiddleware(rwe.ThrottleMiddleware(rwe.ThrottleExport))
+	e.WithMiddleware(httputil.FormatQuery.Middleware).
+		GET("/user/favorites/export", exportFavoritesHandler)
+	e.GET("/user/account/export", exportAccountHandler)
+	g.POST("/user/account/deletion", planAccountDeletionHandler)
+	g.POST("/user/account/deletion/confirm", deleteAccountHandler)
+	g.WithMiddleware(activityQuery.Middleware).
+		WithMiddleware(rwe.LatencyBudget(listBudget)).
+		GET("/user/activity", userActivityHandler)
+	g.GET("/user/activity/:activity", activityDigestHandler)
+	g.WithMiddleware(statsQuery.Middleware).GET("/user/stats", authorStatsHandler)
+	g.WithMiddleware(pollQuery.Middleware).GET("/notifications/poll", pollNotificationsHandler)
+
+	g.GET("/user/searches", listSavedSearchesHandler)
+	g.POST("/user/searches", createSavedSearchHandler)
+	g.DELETE("/user/searches/:id", deleteSavedSearchHandler)
+
+	g.GET("/subscriptions", listSubscriptionsHandler)
+	g.POST("/subscriptions", createSubscriptionHandler)
+	g.PUT("/subscriptions/:id", updateSubscriptionHandler)
+	g.DELETE("/subscriptions/:id", deleteSubscriptionHandler)
+
+	g.POST("/articles/:slug/appeal", appealArticleHandler)
+	g.POST("/articles/:slug/comments/:id/appeal", appealCommentHandler)
+
+	m := g.WithMiddleware(org.MustModeratorMiddleware)
+
+	m.PUT("/moderation/articles/:slug", hideArticleHandler)
+	m.DELETE("/moderation/articles/:slug", restoreArticleHandler)
+	m.PUT("/moderation/comments/:id", hideCommentHandler)
+	m.DELETE("/moderation/comments/:id", restoreCommentHandler)
+	m.DELETE("/moderation/articles/:slug/legal-hold", releaseArticleHoldHandler)
+	m.DELETE("/moderation/comments/:id/legal-hold", releaseCommentHoldHandler)
+	m.GET("/moderation/appeals", listAppealsHandler)
+
+	g = g.WithMiddleware(org.MustAdminMiddleware)
+
+	g.WithMiddleware(rwe.ThrottleMiddleware(rwe.ThrottleExport)).
+		WithMiddleware(httputil.FormatQuery.Middleware).
+		GET("/articles/:slug/comments/export", exportCommentsHandler)
+	g.WithMiddleware(rwe.ThrottleMiddleware(rwe.ThrottleImport)).
+		WithMiddleware(httputil.DecompressMiddleware).
+		POST("/articles/:slug/comments/import", importCommentsHandler)
+
+	g.GET("/admin/tags/rules", listTagRulesHandler)
+	g.POST("/admin/tags/rules", createTagRuleHandler)
+	g.DELETE("/admin/tags/rules/:id", deleteTagRuleHandler)
 }
@@ -0,0 +1,168 @@
+package blog
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-redis/cache/v8"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const leaderboardSize = 50
+
+// leaderboardPeriods maps the period query param to the length of the window.
+// Zero duration means all time.
+var leaderboardPeriods = map[string]time.Duration{
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+type LeaderboardEntry struct {
+	Rank           int          `json:"rank"`
+	Author         *org.Profile `json:"author"`
+	FavoritesCount int          `json:"favoritesCount"`
+	FollowersCount int          `json:"followersCount"`
+}
+
+type leaderboardRow struct {
+	ID             uint64
+	Username       string
+	Bio            string
+	Image          string
+	Verified       bool
+	FavoritesCount int
+	FollowersCount int
+}
+
+func decodeLeaderboardPeriod(period string) (time.Duration, error) {
+	if period == "" {
+		period = "week"
+	}
+	dur, ok := leaderboardPeriods[period]
+	if !ok {
+		return 0, apperr.Validation("period", "period must be one of week, month, or all")
+	}
+	return dur, nil
+}
+
+// SelectLeaderboard returns authors ranked by favorites and followers gained in
+// the period. The ranking is shared by all users and is cached for a few minutes.
+func SelectLeaderboard(ctx context.Context, period string, userID uint64) ([]*LeaderboardEntry, error) {
+	dur, err := decodeLeaderboardPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*LeaderboardEntry
+	if err := rwe.RedisCache().Once(&cache.Item{
+		Ctx:   ctx,
+		Key:   "leaderboard:" + period,
+		Value: &entries,
+		TTL:   10 * time.Minute,
+		Do: func(item *cache.Item) (interface{}, error) {
+			return selectLeaderboard(rwe.DetachedContext(ctx), dur)
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := setLeaderboardFollowing(ctx, entries, userID); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func selectLeaderboard(ctx context.Context, dur time.Duration) ([]*LeaderboardEntry, error) {
+	since := func(column string) func(*orm.Query) (*orm.Query, error) {
+		return func(q *orm.Query) (*orm.Query, error) {
+			if dur != 0 {
+				q = q.Where(column+" >= ?", rwe.Clock.Now().Add(-dur))
+			}
+			return q, nil
+		}
+	}
+
+	favorites := pg.Model((*FavoriteArticle)(nil)).
+		ColumnExpr("a.author_id, count(*) AS favorites_count").
+		Join("JOIN articles AS a ON a.id = fa.article_id").
+		Where("fa.user_id != a.author_id").
+		Where("a.hidden_at IS NULL").
+		Apply(since("fa.created_at")).
+		GroupExpr("a.author_id")
+
+	followers := pg.Model((*org.FollowUser)(nil)).
+		ColumnExpr("fu.followed_user_id, count(*) AS followers_count").
+		Apply(since("fu.created_at")).
+		GroupExpr("fu.followed_user_id")
+
+	rows := make([]leaderboardRow, 0)
+	if err := rwe.PGMain().ModelContext(ctx, (*org.User)(nil)).
+		ColumnExpr("u.id, u.username, u.bio, u.image, u.verified").
+		ColumnExpr("coalesce(fav.favorites_count, 0) AS favorites_count").
+		ColumnExpr("coalesce(fol.followers_count, 0) AS followers_count").
+		Join("LEFT JOIN (?) AS fav ON fav.author_id = u.id", favorites).
+		Join("LEFT JOIN (?) AS fol ON fol.followed_user_id = u.id", followers).
+		Where("NOT u.hide_from_leaderboard").
+		Where("fav.favorites_count > 0 OR fol.followers_count > 0").
+		OrderExpr("coalesce(fav.favorites_count, 0) + coalesce(fol.followers_count, 0) DESC").
+		OrderExpr("u.username ASC").
+		Limit(leaderboardSize).
+		Select(&rows); err != nil && err != pg.ErrNoRows {
+		return nil, err
+	}
+
+	entries := make([]*LeaderboardEntry, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		entries[i] = &LeaderboardEntry{
+			Rank: i + 1,
+			Author: &org.Profile{
+				ID:       row.ID,
+				Username: row.Username,
+				Bio:      row.Bio,
+				Image:    row.Image,
+				Verified: row.Verified,
+			},
+			FavoritesCount: row.FavoritesCount,
+			FollowersCount: row.FollowersCount,
+		}
+	}
+	return entries, nil
+}
+
+// setLeaderboardFollowing sets the following flag for the current user, which
+// can't be part of the cached ranking.
+func setLeaderboardFollowing(ctx context.Context, entries []*LeaderboardEntry, userID uint64) error {
+	if userID == 0 || len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]uint64, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Author.ID
+	}
+
+	var followed []uint64
+	if err := rwe.PGMain().ModelContext(ctx, (*org.FollowUser)(nil)).
+		Column("followed_user_id").
+		Where("user_id = ?", userID).
+		Where("followed_user_id IN (?)", pg.In(ids)).
+		Select(&followed); err != nil && err != pg.ErrNoRows {
+		return err
+	}
+
+	set := make(map[uint64]struct{}, len(followed))
+	for _, id := range followed {
+		set[id] = struct{}{}
+	}
+	for _, entry := range entries {
+		_, entry.Author.Following = set[entry.Author.ID]
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+func leaderboardHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	var userID uint64
+	if user := org.UserFromContext(ctx); user != nil {
+		userID = user.ID
+	}
+
+	entries, err := SelectLeaderboard(ctx, req.URL.Query().Get("period"), userID)
+	if err != nil {
+		return err
+	}
+
+	return rwe.JSON(w, req, treemux.H{
+		"leaderboard": entries,
+	})
+}
@@ -0,0 +1,100 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const defaultInstanceName = "Conduit"
+
+// InstanceMeta lets generic frontends configure themselves for the deployment.
+type InstanceMeta struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	SiteURL     string   `json:"siteUrl"`
+	Languages   []string `json:"languages"`
+
+	// SignupOpen is false in public mode, which is read-only and serves
+	// logged out clients with anonymous tokens instead.
+	SignupOpen bool   `json:"signupOpen"`
+	ReadOnly   bool   `json:"readOnly"`
+	JSONNaming string `json:"jsonNaming"`
+
+	Features *InstanceFeatures `json:"features"`
+	Limits   *InstanceLimits   `json:"limits"`
+}
+
+type InstanceFeatures struct {
+	FeedRanking   bool `json:"feedRanking"`
+	AccountExport bool `json:"accountExport"`
+}
+
+// InstanceLimits sizes are in bytes and lengths are in user perceived
+// characters, so an emoji counts as one character.
+type InstanceLimits struct {
+	MaxArticleSize int `json:"maxArticleSize"`
+	MaxCommentSize int `json:"maxCommentSize"`
+	MaxTags        int `json:"maxTags"`
+	MaxTagLength   int `json:"maxTagLength"`
+
+	MaxTitleLength       int `json:"maxTitleLength"`
+	MaxDescriptionLength int `json:"maxDescriptionLength"`
+	// MaxCommentDepth is the deepest reply level.
+	MaxCommentDepth int `json:"maxCommentDepth"`
+	MaxMetadataSize int `json:"maxMetadataSize"`
+}
+
+func newInstanceMeta() *InstanceMeta {
+	cfg := rwe.Config
+
+	meta := &InstanceMeta{
+		Name:        cfg.Instance.Name,
+		Description: cfg.Instance.Description,
+		SiteURL:     cfg.SiteURL,
+		Languages:   cfg.Instance.Languages,
+
+		SignupOpen: !cfg.Public.Enabled,
+		ReadOnly:   cfg.Public.Enabled,
+		JSONNaming: "camelCase",
+
+		Features: &InstanceFeatures{
+			FeedRanking:   rwe.FeatureEnabled("feed_ranking"),
+			AccountExport: cfg.AccountExportKey != "" && cfg.SigningKeys[cfg.AccountExportKey] != "",
+		},
+		Limits: &InstanceLimits{
+			MaxArticleSize: maxArticleSize,
+			MaxCommentSize: maxCommentSize,
+			MaxTags:        maxTags(),
+			MaxTagLength:   maxTagLength(),
+
+			MaxTitleLength:       maxTitleLength,
+			MaxDescriptionLength: maxDescriptionLength,
+
+			MaxCommentDepth: maxCommentDepth(),
+			MaxMetadataSize: maxMetadataSize,
+		},
+	}
+
+	if meta.Name == "" {
+		meta.Name = defaultInstanceName
+	}
+	if meta.Languages == nil {
+		meta.Languages = make([]string, 0)
+	}
+	if cfg.JSON.Naming == "snake_case" {
+		meta.JSONNaming = "snake_case"
+	}
+	return meta
+}
+
+// metaHandler doesn't require a token even in public mode so clients can
+// discover that they need an anonymous token.
+func metaHandler(w http.ResponseWriter, req treemux.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return httputil.JSON(w, treemux.H{
+		"meta": newInstanceMeta(),
+	})
+}
@@ -0,0 +1,83 @@
+package blog
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/jsonschema"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	maxMetadataSize = 8 << kb
+	// maxMetaFilters limits the number of ?meta.key=value params of lists.
+	maxMetaFilters = 5
+
+	metaParamPrefix = "meta."
+)
+
+var metadataKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateMetadata checks the keys and size of the article metadata and the
+// deployment schema if it is configured.
+func validateMetadata(metadata map[string]interface{}) error {
+	for key := range metadata {
+		if !metadataKeyRe.MatchString(key) {
+			return apperr.Validation("metadata",
+				"metadata key %q must be 1 to 64 letters, digits, dashes, or underscores", key)
+		}
+	}
+
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxMetadataSize {
+		return apperr.Validation("metadata", "metadata must be at most %d bytes", maxMetadataSize)
+	}
+
+	schema := rwe.ArticleMetadataSchema()
+	if schema == nil {
+		return nil
+	}
+
+	if err := schema.Validate("metadata", metadata); err != nil {
+		var schemaErr *jsonschema.Error
+		if errors.As(err, &schemaErr) {
+			return apperr.Validation(schemaErr.Path, "%s", schemaErr.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// decodeMetaFilters returns the ?meta.key=value params. Values are compared
+// with the text of the metadata values, so ?meta.pages=10 matches numbers too.
+func decodeMetaFilters(query url.Values) (map[string]string, error) {
+	var filters map[string]string
+	for name, values := range query {
+		if !strings.HasPrefix(name, metaParamPrefix) {
+			continue
+		}
+
+		key := strings.TrimPrefix(name, metaParamPrefix)
+		if !metadataKeyRe.MatchString(key) {
+			return nil, apperr.Validation(name, "%s is not a valid metadata key", name)
+		}
+
+		if filters == nil {
+			filters = make(map[string]string)
+		}
+		filters[key] = values[0]
+	}
+
+	if len(filters) > maxMetaFilters {
+		return nil, apperr.Validation("meta",
+			"lists can be filtered by at most %d metadata keys", maxMetaFilters)
+	}
+	return filters, nil
+}
@@ -0,0 +1,130 @@
+package blog
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const (
+	// maxPollTimeout in seconds stays below the server WriteTimeout.
+	maxPollTimeout      = 8
+	defaultPollInterval = 5 * time.Second
+
+	maxPollsPerUser = 2
+	maxPolls        = 1000
+)
+
+func pollInterval() time.Duration {
+	if d := rwe.Config.Notifications.PollInterval; d > 0 {
+		return d
+	}
+	return defaultPollInterval
+}
+
+var errTooManyPolls = apperr.New(apperr.RateLimited, "too many concurrent polls")
+
+// pollers limits concurrent long polls because each of them holds a connection
+// and queries the database when it is woken up and every pollInterval.
+var pollers = struct {
+	sync.Mutex
+	byUser map[uint64]int
+	total  int
+}{
+	byUser: make(map[uint64]int),
+}
+
+func acquirePoll(userID uint64) bool {
+	pollers.Lock()
+	defer pollers.Unlock()
+
+	if pollers.total >= maxPolls || pollers.byUser[userID] >= maxPollsPerUser {
+		return false
+	}
+	pollers.total++
+	pollers.byUser[userID]++
+	return true
+}
+
+func releasePoll(userID uint64) {
+	pollers.Lock()
+	defer pollers.Unlock()
+
+	pollers.total--
+	if pollers.byUser[userID]--; pollers.byUser[userID] == 0 {
+		delete(pollers.byUser, userID)
+	}
+}
+
+// pollNotificationsHandler waits until there is activity newer than since or
+// the timeout expires. It is a fallback for clients that can't keep streaming
+// connections open.
+func pollNotificationsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	since := rwe.Clock.Now()
+	if s := req.URL.Query().Get("since"); s != "" {
+		tm, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return apperr.Validation("since", "since must be an RFC 3339 time")
+		}
+		since = tm
+	}
+
+	timeout := time.Duration(httputil.QueryInt(req, "timeout", maxPollTimeout)) * time.Second
+
+	if !acquirePoll(user.ID) {
+		return errTooManyPolls
+	}
+	defer releasePoll(user.ID)
+
+	f := &ActivityFilter{
+		UserID: user.ID,
+		Limit:  100,
+		Since:  since,
+	}
+
+	// Subscribe before the first query so activity written in between
+	// wakes up the poll.
+	activityCh, unsubscribe := rwe.SubscribeActivity(user.ID)
+	defer unsubscribe()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(pollInterval())
+	defer ticker.Stop()
+
+	for {
+		activity, _, err := selectActivity(ctx, f)
+		if err != nil {
+			return err
+		}
+		if len(activity) > 0 {
+			since = activity[0].CreatedAt
+			return httputil.JSON(w, treemux.H{
+				"activity": activity,
+				"since":    since.Format(time.RFC3339Nano),
+			})
+		}
+
+		select {
+		case <-activityCh:
+		case <-ticker.C:
+		case <-deadline.C:
+			return httputil.JSON(w, treemux.H{
+				"activity": activity,
+				"since":    since.Format(time.RFC3339Nano),
+			})
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
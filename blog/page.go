@@ -0,0 +1,126 @@
+package blog
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+// page is the data passed to HTML templates. The pages are rendered on the
+// server so crawlers and link previews work without running the frontend.
+type page struct {
+	SiteURL     string
+	URL         string
+	Type        string
+	Title       string
+	Description string
+	Image       string
+
+	Article  *Article
+	Comments []*Comment
+
+	Profile  *org.Profile
+	Articles []*Article
+}
+
+func newPage(req treemux.Request) *page {
+	siteURL := rwe.SiteURL(req.Request)
+	return &page{
+		SiteURL: siteURL,
+		URL:     siteURL + req.URL.Path,
+		Type:    "website",
+	}
+}
+
+func renderPage(w http.ResponseWriter, status int, name string, p *page) error {
+	t := rwe.Templates()
+	if t == nil {
+		return errors.New("templates are not parsed, see rwe.ParseTemplates")
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, p); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func renderNotFound(w http.ResponseWriter, p *page) error {
+	p.Title = "Not found"
+	return renderPage(w, http.StatusNotFound, "not_found.html", p)
+}
+
+func articlePageHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	p := newPage(req)
+
+	article, err := selectArticleByFilter(ctx, &ArticleFilter{
+		Slug: req.Param("slug"),
+	})
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return renderNotFound(w, p)
+		}
+		return err
+	}
+
+	comments := make([]*Comment, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &comments).
+		Relation("Author").
+		Where("article_id = ?", article.ID).
+		Where("c.hidden_at IS NULL").
+		OrderExpr("c.created_at ASC").
+		Select(); err != nil {
+		return err
+	}
+
+	p.Type = "article"
+	p.Title = article.Title
+	p.Description = article.Description
+	p.Image = article.Author.Image
+	p.Article = article
+	p.Comments = comments
+
+	return renderPage(w, http.StatusOK, "article.html", p)
+}
+
+func profilePageHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	p := newPage(req)
+
+	user, err := org.SelectUserByUsername(ctx, req.Param("username"))
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return renderNotFound(w, p)
+		}
+		return err
+	}
+
+	articles := make([]*Article, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &articles).
+		Where("author_id = ?", user.ID).
+		Where("hidden_at IS NULL").
+		OrderExpr("created_at DESC").
+		Limit(20).
+		Select(); err != nil {
+		return err
+	}
+
+	p.Type = "profile"
+	p.Title = user.Username
+	p.Description = user.Bio
+	p.Image = user.Image
+	p.Profile = org.NewProfile(user)
+	p.Articles = articles
+
+	return renderPage(w, http.StatusOK, "profile.html", p)
+}
@@ -0,0 +1,109 @@
+package blog
+
+import (
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/org"
+)
+
+// ArticleResponse is the JSON representation of an article. Handlers
+// serialize articles only with NewArticleResponse so the shape is defined here.
+type ArticleResponse struct {
+	Slug        string                 `json:"slug"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Body        string                 `json:"body"`
+	Language    string                 `json:"language"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	Author      *org.ProfileResponse   `json:"author"`
+	TagList     []string               `json:"tagList"`
+
+	Favorited      bool `json:"favorited"`
+	FavoritesCount int  `json:"favoritesCount"`
+
+	CommentsCount   int             `json:"commentsCount"`
+	LatestComment   *CommentPreview `json:"latestComment"`
+	CommentPolicy   string          `json:"commentPolicy"`
+	CommentsEnabled bool            `json:"commentsEnabled"`
+	ViewsCount      int             `json:"viewsCount"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func NewArticleResponse(article *Article) *ArticleResponse {
+	tags := article.TagList
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	metadata := article.Metadata
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	return &ArticleResponse{
+		Slug:        article.Slug,
+		Title:       article.Title,
+		Description: article.Description,
+		Body:        article.Body,
+		Language:    article.Language,
+		Metadata:    metadata,
+		Author:      org.NewProfileResponse(article.Author),
+		TagList:     tags,
+
+		Favorited:      article.Favorited,
+		FavoritesCount: article.FavoritesCount,
+
+		CommentsCount:   article.CommentsCount,
+		LatestComment:   article.LatestComment,
+		CommentPolicy:   article.CommentPolicy,
+		CommentsEnabled: article.CommentsEnabled,
+		ViewsCount:      article.ViewsCount,
+
+		CreatedAt: article.CreatedAt,
+		UpdatedAt: article.UpdatedAt,
+	}
+}
+
+func NewArticleResponses(articles []*Article) []*ArticleResponse {
+	resp := make([]*ArticleResponse, len(articles))
+	for i, article := range articles {
+		resp[i] = NewArticleResponse(article)
+	}
+	return resp
+}
+
+// CommentResponse is the JSON representation of a comment.
+type CommentResponse struct {
+	ID     uint64               `json:"id"`
+	Body   string               `json:"body"`
+	Author *org.ProfileResponse `json:"author"`
+
+	// ParentID is omitted for top-level comments.
+	ParentID uint64 `json:"parentId,omitempty"`
+	// Replies are returned only by the tree view of the comment list.
+	Replies []*CommentResponse `json:"replies,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func NewCommentResponse(comment *Comment) *CommentResponse {
+	return &CommentResponse{
+		ID:       comment.ID,
+		Body:     comment.Body,
+		Author:   org.NewProfileResponse(comment.Author),
+		ParentID: comment.ParentID,
+
+		CreatedAt: comment.CreatedAt,
+		UpdatedAt: comment.UpdatedAt,
+	}
+}
+
+func NewCommentResponses(comments []*Comment) []*CommentResponse {
+	resp := make([]*CommentResponse, len(comments))
+	for i, comment := range comments {
+		resp[i] = NewCommentResponse(comment)
+	}
+	return resp
+}
@@ -0,0 +1,130 @@
+package blog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/org"
+)
+
+func compactJSON(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestArticleResponse(t *testing.T) {
+	tm := time.Date(2020, time.January, 1, 2, 3, 4, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		article *Article
+		want    string
+	}{
+		{
+			name:    "empty",
+			article: &Article{},
+			want: `{
+				"slug": "", "title": "", "description": "", "body": "", "language": "",
+				"metadata": {}, "author": null, "tagList": [],
+				"favorited": false, "favoritesCount": 0,
+				"commentsCount": 0, "latestComment": null, "commentPolicy": "", "commentsEnabled": false,
+				"viewsCount": 0,
+				"createdAt": "0001-01-01T00:00:00Z", "updatedAt": "0001-01-01T00:00:00Z"
+			}`,
+		},
+		{
+			name: "full",
+			article: &Article{
+				ID:          1,
+				Slug:        "hello-world",
+				Title:       "Hello world",
+				Description: "Hello world article description!",
+				Body:        "Hello world article body.",
+				Language:    "en",
+				Metadata:    map[string]interface{}{"series": "go"},
+				Author:      &org.Profile{ID: 2, Username: "CurrentUser", Verified: true},
+				AuthorID:    2,
+				TagList:     []string{"go"},
+
+				Favorited:      true,
+				FavoritesCount: 3,
+
+				CommentsCount:   1,
+				LatestComment:   &CommentPreview{ID: 4, Body: "First comment.", Author: "FollowedUser", CreatedAt: tm},
+				CommentPolicy:   "everyone",
+				CommentsEnabled: true,
+				ViewsCount:      5,
+
+				CreatedAt: tm,
+				UpdatedAt: tm,
+			},
+			want: `{
+				"slug": "hello-world", "title": "Hello world",
+				"description": "Hello world article description!", "body": "Hello world article body.",
+				"language": "en", "metadata": {"series": "go"},
+				"author": {"username": "CurrentUser", "bio": "", "image": "", "verified": true, "following": false},
+				"tagList": ["go"],
+				"favorited": true, "favoritesCount": 3,
+				"commentsCount": 1,
+				"latestComment": {"id": 4, "body": "First comment.", "author": "FollowedUser", "createdAt": "2020-01-01T02:03:04Z"},
+				"commentPolicy": "everyone", "commentsEnabled": true,
+				"viewsCount": 5,
+				"createdAt": "2020-01-01T02:03:04Z", "updatedAt": "2020-01-01T02:03:04Z"
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		b, err := json.Marshal(NewArticleResponse(test.article))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), compactJSON(t, test.want); got != want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.name, got, want)
+		}
+	}
+}
+
+func TestCommentResponse(t *testing.T) {
+	tm := time.Date(2020, time.January, 1, 2, 3, 4, 0, time.UTC)
+	author := &org.Profile{Username: "FollowedUser"}
+
+	tests := []struct {
+		name    string
+		comment *Comment
+		want    string
+	}{
+		{
+			name:    "top level",
+			comment: &Comment{ID: 1, Body: "First comment.", Author: author, CreatedAt: tm, UpdatedAt: tm},
+			want: `{
+				"id": 1, "body": "First comment.",
+				"author": {"username": "FollowedUser", "bio": "", "image": "", "verified": false, "following": false},
+				"createdAt": "2020-01-01T02:03:04Z", "updatedAt": "2020-01-01T02:03:04Z"
+			}`,
+		},
+		{
+			name:    "reply",
+			comment: &Comment{ID: 2, Body: "Reply.", ParentID: 1, Depth: 1, CreatedAt: tm, UpdatedAt: tm},
+			want: `{
+				"id": 2, "body": "Reply.", "author": null, "parentId": 1,
+				"createdAt": "2020-01-01T02:03:04Z", "updatedAt": "2020-01-01T02:03:04Z"
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		b, err := json.Marshal(NewCommentResponse(test.comment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), compactJSON(t, test.want); got != want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package blog
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
+)
+
+// maxSavedSearches limits saved searches per user because every search is
+// matched against new articles when the user reads activity.
+const maxSavedSearches = 20
+
+var errTooManySavedSearches = apperr.Validation("search",
+	"at most %d searches can be saved", maxSavedSearches)
+
+// SavedSearch matches articles published after it was saved by title or tag.
+// Matches are reported as search activity, see ActivityFilter.searchDigests.
+type SavedSearch struct {
+	tableName struct{} `pg:"saved_searches,alias:ss"`
+
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"-"`
+
+	Query string `json:"query"`
+	// Pattern is the ILIKE pattern for article titles and Tag is the query
+	// normalized as a tag with synonyms replaced.
+	Pattern string `json:"-"`
+	Tag     string `json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *SavedSearch) normalize(ctx context.Context) error {
+	s.Query = strings.ToLower(strings.TrimSpace(textutil.NormalizeLine(s.Query)))
+	if n := textutil.Len(s.Query); n < suggestMinLen || n > suggestMaxLen {
+		return apperr.Validation("query",
+			"query must be from %d to %d characters long", suggestMinLen, suggestMaxLen)
+	}
+
+	s.Pattern = "%" + likeEscaper.Replace(s.Query) + "%"
+	tag, err := canonicalTag(ctx, s.Query)
+	if err != nil {
+		return err
+	}
+	s.Tag = tag
+	return nil
+}
+
+func SelectSavedSearches(ctx context.Context, userID uint64) ([]*SavedSearch, error) {
+	searches := make([]*SavedSearch, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &searches).
+		Where("ss.user_id = ?", userID).
+		OrderExpr("ss.id ASC").
+		Select(); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+// insertSavedSearch saves the search or returns the one saved with the same
+// query.
+func insertSavedSearch(ctx context.Context, search *SavedSearch) error {
+	return rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Serializes saves of the user so the limit holds.
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(?)", search.UserID); err != nil {
+			return err
+		}
+
+		count, err := tx.ModelContext(ctx, (*SavedSearch)(nil)).
+			Where("user_id = ?", search.UserID).
+			Where("query != ?", search.Query).
+			Count()
+		if err != nil {
+			return err
+		}
+		if count >= maxSavedSearches {
+			return errTooManySavedSearches
+		}
+
+		_, err = tx.ModelContext(ctx, search).
+			OnConflict("(user_id, query) DO UPDATE").
+			Set("query = EXCLUDED.query").
+			Returning("id, created_at").
+			Insert()
+		return err
+	})
+}
+
+//------------------------------------------------------------------------------
+
+// searchMatches joins saved searches of the user with matching articles
+// published after the search was saved.
+func (f *ActivityFilter) searchMatches() *orm.Query {
+	return pg.Model((*SavedSearch)(nil)).
+		Join("JOIN articles AS a ON a.created_at > ss.created_at").
+		Where("ss.user_id = ?", f.UserID).
+		Where("a.author_id != ?", f.UserID).
+		Where("a.hidden_at IS NULL").
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			tags := pg.Model((*ArticleTag)(nil)).
+				Where("t.article_id = a.id").
+				Where("t.tag IN (?)", tagsImplying(pg.Ident("ss.tag")))
+
+			q = q.Where("a.title ILIKE ss.pattern").
+				WhereOr("EXISTS (?)", tags)
+			return q, nil
+		})
+}
+
+func (f *ActivityFilter) searchEvents() *orm.Query {
+	return f.searchMatches().
+		ColumnExpr("'search:' || ss.id || ':' || a.id AS id").
+		ColumnExpr("?::text AS type", activitySearch).
+		Apply(f.actorColumns).
+		ColumnExpr("a.slug AS article_slug, a.title AS article_title").
+		ColumnExpr("NULL::int8 AS comment_id, NULL::text AS comment_body").
+		ColumnExpr("a.created_at, 1::int8 AS actors_count").
+		ColumnExpr("ss.query::text AS search_query").
+		Join("JOIN users AS u ON u.id = a.author_id")
+}
+
+// searchDigests returns one event per saved search and digest window with the
+// latest matching article.
+func (f *ActivityFilter) searchDigests() *orm.Query {
+	bucket := digestBucket("a.created_at")
+	ranked := f.searchMatches().
+		ColumnExpr("ss.id AS search_id, ss.query, a.id AS article_id, a.author_id, a.created_at").
+		ColumnExpr("? AS bucket", bucket).
+		ColumnExpr("count(*) OVER (PARTITION BY ss.id, ?) AS actors_count", bucket).
+		ColumnExpr("row_number() OVER (PARTITION BY ss.id, ? "+
+			"ORDER BY a.created_at DESC, a.id DESC) AS digest_rank", bucket)
+
+	return pg.Model().
+		TableExpr("(?) AS sm", ranked).
+		ColumnExpr("'search:' || sm.search_id || ':' || sm.bucket AS id").
+		ColumnExpr("?::text AS type", activitySearch).
+		Apply(f.actorColumns).
+		ColumnExpr("a.slug AS article_slug, a.title AS article_title").
+		ColumnExpr("NULL::int8 AS comment_id, NULL::text AS comment_body").
+		ColumnExpr("sm.created_at, sm.actors_count").
+		ColumnExpr("sm.query::text AS search_query").
+		Join("JOIN articles AS a ON a.id = sm.article_id").
+		Join("JOIN users AS u ON u.id = sm.author_id").
+		Where("sm.digest_rank = 1")
+}
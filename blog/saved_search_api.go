@@ -0,0 +1,79 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+func listSavedSearchesHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	searches, err := SelectSavedSearches(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"searches": searches,
+	})
+}
+
+func createSavedSearchHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	var in struct {
+		Search *SavedSearch `json:"search"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Search == nil {
+		return apperr.Required("search")
+	}
+
+	search := in.Search
+	if err := search.normalize(ctx); err != nil {
+		return err
+	}
+
+	search.ID = 0
+	search.UserID = user.ID
+	search.CreatedAt = rwe.Clock.Now()
+
+	if err := insertSavedSearch(ctx, search); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"search": search,
+	})
+}
+
+func deleteSavedSearchHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, (*SavedSearch)(nil)).
+		Where("user_id = ?", user.ID).
+		Where("id = ?", id).
+		Delete(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package blog
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-redis/cache/v8"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
+)
+
+const (
+	suggestMinLen   = 2
+	suggestMaxLen   = 100
+	suggestPerType  = 5
+	suggestMaxTotal = 10
+)
+
+type Suggestion struct {
+	tableName struct{} `pg:"_,alias:s"`
+
+	Type  string  `json:"type"`
+	Text  string  `json:"text"`
+	Slug  string  `json:"slug,omitempty"`
+	Score float64 `json:"-"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SelectSuggestions returns article titles, tags, and usernames matching the
+// query either by prefix or by trigram similarity. Prefix matches rank first.
+func SelectSuggestions(ctx context.Context, q string) ([]*Suggestion, error) {
+	q = strings.ToLower(strings.TrimSpace(textutil.NormalizeLine(q)))
+	if n := textutil.Len(q); n < suggestMinLen || n > suggestMaxLen {
+		return nil, apperr.Validation("q",
+			"query must be from %d to %d characters long", suggestMinLen, suggestMaxLen)
+	}
+
+	suggestions := make([]*Suggestion, 0)
+	if err := rwe.RedisCache().Once(&cache.Item{
+		Ctx:   ctx,
+		Key:   "suggest:" + q,
+		Value: &suggestions,
+		TTL:   time.Minute,
+		Do: func(item *cache.Item) (interface{}, error) {
+			return selectSuggestions(rwe.DetachedContext(ctx), q)
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+func selectSuggestions(ctx context.Context, q string) ([]*Suggestion, error) {
+	prefix := likeEscaper.Replace(q) + "%"
+
+	match := func(column string) func(*orm.Query) (*orm.Query, error) {
+		return func(sq *orm.Query) (*orm.Query, error) {
+			sq = sq.ColumnExpr("similarity(?0, ?1) + CASE WHEN ?0 ILIKE ?2 THEN 1 ELSE 0 END AS score",
+				pg.Safe(column), q, prefix).
+				WhereGroup(func(sq *orm.Query) (*orm.Query, error) {
+					sq = sq.Where("? ILIKE ?", pg.Safe(column), prefix).
+						WhereOr("? % ?", pg.Safe(column), q)
+					return sq, nil
+				}).
+				OrderExpr("score DESC").
+				Limit(suggestPerType)
+			return sq, nil
+		}
+	}
+
+	articles := pg.Model((*Article)(nil)).
+		ColumnExpr("'article'::text AS type, a.title::text AS text, a.slug::text AS slug").
+		Where("a.hidden_at IS NULL").
+		Apply(match("a.title"))
+
+	tags := pg.Model((*ArticleTag)(nil)).
+		ColumnExpr("'tag'::text AS type, t.tag::text AS text, NULL::text AS slug").
+		Join("JOIN articles AS a ON a.id = t.article_id").
+		Where("a.hidden_at IS NULL").
+		Apply(match("t.tag")).
+		GroupExpr("t.tag")
+
+	users := pg.Model((*org.User)(nil)).
+		ColumnExpr("'user'::text AS type, u.username::text AS text, NULL::text AS slug").
+		Apply(match("u.username"))
+
+	suggestions := make([]*Suggestion, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &suggestions).
+		ColumnExpr("s.*").
+		TableExpr("(?)", articles.UnionAll(tags).UnionAll(users)).
+		OrderExpr("s.score DESC, s.text ASC").
+		Limit(suggestMaxTotal).
+		Select(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,21 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/vmihailenco/treemux"
+)
+
+func searchSuggestHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	suggestions, err := SelectSuggestions(ctx, req.URL.Query().Get("q"))
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,187 @@
+package blog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	SubscriptionTag    = "tag"
+	SubscriptionAuthor = "author"
+)
+
+const (
+	ChannelRSS   = "rss"
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+var subscriptionChannels = map[string]bool{
+	ChannelRSS:   true,
+	ChannelEmail: true,
+	ChannelPush:  true,
+}
+
+type Subscription struct {
+	tableName struct{} `pg:"subscriptions,alias:s"`
+
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"-"`
+
+	Kind   string `json:"kind"`
+	Target string `json:"target" pg:"-"`
+
+	AuthorID uint64 `json:"-"`
+	Tag      string `json:"-"`
+
+	Channels []string `json:"channels" pg:",array"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *Subscription) validate() error {
+	switch s.Kind {
+	case SubscriptionTag, SubscriptionAuthor:
+	default:
+		return apperr.Validation("kind", "subscription kind must be tag or author")
+	}
+
+	if s.Target == "" {
+		return apperr.Validation("target", "subscription target is required")
+	}
+
+	if err := validateChannels(s.Channels); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateChannels(channels []string) error {
+	if len(channels) == 0 {
+		return apperr.Validation("channels", "at least one channel is required")
+	}
+	for _, ch := range channels {
+		if !subscriptionChannels[ch] {
+			return apperr.Validation("channels", "unsupported channel: %q", ch)
+		}
+	}
+	return nil
+}
+
+func (s *Subscription) hasChannel(channel string) bool {
+	for _, ch := range s.Channels {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTarget sets AuthorID or Tag from the user supplied target.
+func (s *Subscription) resolveTarget(ctx context.Context) error {
+	switch s.Kind {
+	case SubscriptionAuthor:
+		author, err := org.SelectUserByUsername(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		s.AuthorID = author.ID
+	case SubscriptionTag:
+		tag, err := canonicalTag(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		s.Tag = tag
+		if s.Tag == "" {
+			return apperr.New(apperr.InvalidTag, "tag %q must contain letters or digits", s.Target)
+		}
+	}
+	return nil
+}
+
+func subscriptionTargetColumn(q *orm.Query) (*orm.Query, error) {
+	q = q.ColumnExpr("s.*").
+		ColumnExpr("coalesce(u.username, s.tag) AS target").
+		Join("LEFT JOIN users AS u ON u.id = s.author_id")
+	return q, nil
+}
+
+func SelectSubscriptions(ctx context.Context, userID uint64) ([]*Subscription, error) {
+	subs := make([]*Subscription, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &subs).
+		Apply(subscriptionTargetColumn).
+		Where("s.user_id = ?", userID).
+		OrderExpr("s.id ASC").
+		Select(); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func selectSubscription(ctx context.Context, userID, id uint64) (*Subscription, error) {
+	sub := new(Subscription)
+	if err := rwe.PGMain().ModelContext(ctx, sub).
+		Apply(subscriptionTargetColumn).
+		Where("s.user_id = ?", userID).
+		Where("s.id = ?", id).
+		Select(); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+//------------------------------------------------------------------------------
+
+// rssToken returns the token that identifies the user in RSS feed URLs,
+// generating one on first use.
+func rssToken(ctx context.Context, userID uint64) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := rwe.PGMain().ModelContext(ctx, (*org.User)(nil)).
+		Set("rss_token = ?", token).
+		Where("id = ?", userID).
+		Where("rss_token IS NULL").
+		Update(); err != nil {
+		return "", err
+	}
+
+	if err := rwe.PGMain().ModelContext(ctx, (*org.User)(nil)).
+		Column("rss_token").
+		Where("id = ?", userID).
+		Select(pg.Scan(&token)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func selectUserIDByRSSToken(ctx context.Context, token string) (uint64, error) {
+	var userID uint64
+	if err := rwe.PGMain().ModelContext(ctx, (*org.User)(nil)).
+		Column("id").
+		Where("rss_token = ?", token).
+		Select(pg.Scan(&userID)); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,243 @@
+package blog
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+func listSubscriptionsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	subs, err := SelectSubscriptions(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var rssURL string
+	for _, sub := range subs {
+		if !sub.hasChannel(ChannelRSS) {
+			continue
+		}
+
+		token, err := rssToken(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		rssURL = rwe.SiteURL(req.Request) + "/api/subscriptions/rss/" + token
+		break
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"subscriptions": subs,
+		"rssUrl":        rssURL,
+	})
+}
+
+func createSubscriptionHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	var in struct {
+		Subscription *Subscription `json:"subscription"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Subscription == nil {
+		return apperr.Required("subscription")
+	}
+
+	sub := in.Subscription
+	if err := sub.validate(); err != nil {
+		return err
+	}
+	if err := sub.resolveTarget(ctx); err != nil {
+		return err
+	}
+
+	sub.ID = 0
+	sub.UserID = user.ID
+	sub.CreatedAt = rwe.Clock.Now()
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, sub).
+		OnConflict("(user_id, kind, coalesce(author_id, 0), coalesce(tag, '')) DO UPDATE").
+		Set("channels = EXCLUDED.channels").
+		Returning("id, created_at").
+		Insert(); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"subscription": sub,
+	})
+}
+
+func updateSubscriptionHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	var in struct {
+		Subscription *struct {
+			Channels []string `json:"channels"`
+		} `json:"subscription"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Subscription == nil {
+		return apperr.Required("subscription")
+	}
+
+	if err := validateChannels(in.Subscription.Channels); err != nil {
+		return err
+	}
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, (*Subscription)(nil)).
+		Set("channels = ?", pg.Array(in.Subscription.Channels)).
+		Where("user_id = ?", user.ID).
+		Where("id = ?", id).
+		Update(); err != nil {
+		return err
+	}
+
+	sub, err := selectSubscription(ctx, user.ID, id)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"subscription": sub,
+	})
+}
+
+func deleteSubscriptionHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, (*Subscription)(nil)).
+		Where("user_id = ?", user.ID).
+		Where("id = ?", id).
+		Delete(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	Author      string `xml:"author"`
+	PubDate     string `xml:"pubDate"`
+}
+
+// subscriptionsRSSHandler renders articles matching the RSS subscriptions of the
+// user identified by the token. Feed readers can't send auth headers.
+func subscriptionsRSSHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	userID, err := selectUserIDByRSSToken(ctx, req.Param("token"))
+	if err != nil {
+		return err
+	}
+
+	subq := rwe.PGMain().Model((*Subscription)(nil)).
+		Where("s.user_id = ?", userID).
+		Where("? = ANY(s.channels)", ChannelRSS)
+
+	articles := make([]*Article, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &articles).
+		ColumnExpr("?TableColumns").
+		Relation("Author").
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			authors := subq.Clone().
+				ColumnExpr("s.author_id").
+				Where("s.kind = ?", SubscriptionAuthor)
+			tags := subq.Clone().
+				ColumnExpr("t.article_id").
+				Join("JOIN article_tags AS t ON t.tag = s.tag").
+				Where("s.kind = ?", SubscriptionTag)
+
+			q = q.Where("a.author_id IN (?)", authors).
+				WhereOr("a.id IN (?)", tags)
+			return q, nil
+		}).
+		Where("a.hidden_at IS NULL").
+		OrderExpr("a.created_at DESC").
+		Limit(50).
+		Select(); err != nil {
+		return err
+	}
+
+	siteURL := rwe.SiteURL(req.Request)
+	feed := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "Subscriptions",
+			Link:        siteURL,
+			Description: "Articles from your subscriptions",
+			Items:       make([]rssItem, len(articles)),
+		},
+	}
+	for i, article := range articles {
+		link := siteURL + "/articles/" + article.Slug
+		feed.Channel.Items[i] = rssItem{
+			Title:       article.Title,
+			Link:        link,
+			GUID:        link,
+			Description: article.Description,
+			Author:      article.Author.Username,
+			PubDate:     article.CreatedAt.Format(time.RFC1123Z),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(feed)
+}
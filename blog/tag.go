@@ -0,0 +1,104 @@
+package blog
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	defaultMaxTags      = 10
+	defaultMaxTagLength = 50
+)
+
+func maxTags() int {
+	if n := rwe.Config.Tags.MaxCount; n > 0 {
+		return n
+	}
+	return defaultMaxTags
+}
+
+func maxTagLength() int {
+	if n := rwe.Config.Tags.MaxLength; n > 0 {
+		return n
+	}
+	return defaultMaxTagLength
+}
+
+// NormalizeTag returns the canonical form of the tag so "Go", "go", and " go "
+// are the same tag. The tag is lowercased and converted to NFC, and it keeps
+// letters and digits of any script together with '+' and '#', so "C++", "C#",
+// and "C" stay different tags. Runs of spaces, '-', and '_' become a single
+// '-' and other characters are removed.
+//
+// Migration 10_normalize_tags has its own copy of the function, so changes
+// here don't apply to the tags that were normalized then.
+func NormalizeTag(tag string) string {
+	tag = norm.NFC.String(strings.ToLower(tag))
+
+	var b strings.Builder
+	sep := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r), unicode.IsDigit(r), r == '+', r == '#':
+			if sep && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			sep = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r), r == '-', r == '_':
+			sep = true
+		}
+	}
+	return b.String()
+}
+
+// normalizeTags normalizes and dedupes tags keeping their order and replaces
+// tags with their synonyms, see TagRule. Changed and removed tags are
+// reported to warnings.
+func normalizeTags(ctx context.Context, tags []string, warnings *apperr.Warnings) ([]string, error) {
+	norms := make([]string, len(tags))
+	for i, tag := range tags {
+		norms[i] = NormalizeTag(tag)
+	}
+
+	synonyms, err := selectTagSynonyms(ctx, norms)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		norm := norms[i]
+		if norm == "" {
+			return nil, apperr.New(apperr.InvalidTag, "tag %q must contain letters or digits", tag)
+		}
+		if textutil.Len(norm) > maxTagLength() {
+			return nil, apperr.New(apperr.InvalidTag,
+				"tag %q must be at most %d characters long", tag, maxTagLength())
+		}
+		if synonym, ok := synonyms[norm]; ok {
+			norm = synonym
+		}
+		if seen[norm] {
+			warnings.Add("tagList", apperr.TagDuplicate, "duplicate tag %q removed", tag)
+			continue
+		}
+		if norm != tag {
+			warnings.Add("tagList", apperr.TagNormalized, "tag %q normalized to %q", tag, norm)
+		}
+		seen[norm] = true
+		normalized = append(normalized, norm)
+	}
+
+	if len(normalized) > maxTags() {
+		return nil, apperr.New(apperr.TooManyTags, "article can have at most %d tags", maxTags())
+	}
+	return normalized, nil
+}
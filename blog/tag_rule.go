@@ -0,0 +1,155 @@
+package blog
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	TagRuleSynonym = "synonym"
+	TagRuleImplies = "implies"
+)
+
+var errTagRuleExists = apperr.Validation("tag", "rule already exists or the tag already has a synonym")
+
+// TagRule is an admin managed rule for a tag. Synonym rules replace the tag
+// with the target when tags are normalized, e.g. js with javascript. Implies
+// rules list articles with the tag under the target too, e.g. react articles
+// are listed under javascript.
+type TagRule struct {
+	tableName struct{} `pg:"tag_rules,alias:tr"`
+
+	ID     uint64 `json:"id"`
+	Kind   string `json:"kind"`
+	Tag    string `json:"tag"`
+	Target string `json:"target"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (r *TagRule) normalize() error {
+	switch r.Kind {
+	case TagRuleSynonym, TagRuleImplies:
+	default:
+		return apperr.Validation("kind", "kind must be %s or %s", TagRuleSynonym, TagRuleImplies)
+	}
+
+	r.Tag = NormalizeTag(r.Tag)
+	if r.Tag == "" {
+		return apperr.Validation("tag", "tag must contain letters or digits")
+	}
+	r.Target = NormalizeTag(r.Target)
+	if r.Target == "" {
+		return apperr.Validation("target", "target must contain letters or digits")
+	}
+	if r.Tag == r.Target {
+		return apperr.Validation("target", "target must differ from tag")
+	}
+	return nil
+}
+
+func SelectTagRules(ctx context.Context) ([]*TagRule, error) {
+	rules := make([]*TagRule, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &rules).
+		OrderExpr("tr.kind ASC, tr.tag ASC, tr.target ASC").
+		Select(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// insertTagRule saves the rule. Synonyms are not chained, so replacing a tag
+// with its synonym once gives the canonical tag.
+func insertTagRule(ctx context.Context, rule *TagRule) error {
+	return rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		// Serializes rule changes so concurrent synonyms don't form a chain.
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE tag_rules IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+
+		if rule.Kind == TagRuleSynonym {
+			exists, err := tx.ModelContext(ctx, (*TagRule)(nil)).
+				Where("kind = ?", TagRuleSynonym).
+				WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+					q = q.Where("tag = ?", rule.Target).
+						WhereOr("target = ?", rule.Tag)
+					return q, nil
+				}).
+				Exists()
+			if err != nil {
+				return err
+			}
+			if exists {
+				return apperr.Validation("target",
+					"synonyms can't be chained, %q or %q is already part of a synonym", rule.Tag, rule.Target)
+			}
+		}
+
+		res, err := tx.ModelContext(ctx, rule).
+			OnConflict("DO NOTHING").
+			Returning("id, created_at").
+			Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return errTagRuleExists
+		}
+		return nil
+	})
+}
+
+// selectTagSynonyms returns the synonyms of the normalized tags by tag.
+func selectTagSynonyms(ctx context.Context, tags []string) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	var rules []*TagRule
+	if err := rwe.PGMain().ModelContext(ctx, &rules).
+		Column("tag", "target").
+		Where("kind = ?", TagRuleSynonym).
+		Where("tag IN (?)", pg.In(tags)).
+		Select(); err != nil {
+		return nil, err
+	}
+
+	synonyms := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		synonyms[rule.Tag] = rule.Target
+	}
+	return synonyms, nil
+}
+
+// canonicalTag normalizes the tag and replaces it with its synonym.
+func canonicalTag(ctx context.Context, tag string) (string, error) {
+	tag = NormalizeTag(tag)
+	if tag == "" {
+		return "", nil
+	}
+
+	synonyms, err := selectTagSynonyms(ctx, []string{tag})
+	if err != nil {
+		return "", err
+	}
+	if synonym, ok := synonyms[tag]; ok {
+		return synonym, nil
+	}
+	return tag, nil
+}
+
+// tagsImplying returns the query for the tag and the tags that imply it
+// directly or through other tags. Synonyms are included for articles that
+// were tagged before the synonym was added. UNION stops at cycles.
+func tagsImplying(tag interface{}) *orm.SafeQueryAppender {
+	return pg.SafeQuery(`WITH RECURSIVE implied (tag) AS (
+		SELECT ?::text
+		UNION
+		SELECT tr.tag::text FROM tag_rules AS tr JOIN implied ON tr.target = implied.tag
+	) SELECT tag FROM implied`, tag)
+}
@@ -0,0 +1,74 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+func listTagRulesHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	rules, err := SelectTagRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"rules": rules,
+	})
+}
+
+// createTagRuleHandler adds the rule. Synonyms apply to tags written after
+// the rule is added, and lists include articles tagged with the old tag.
+func createTagRuleHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	var in struct {
+		Rule *TagRule `json:"rule"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Rule == nil {
+		return apperr.Required("rule")
+	}
+
+	rule := in.Rule
+	if err := rule.normalize(); err != nil {
+		return err
+	}
+	rule.ID = 0
+	rule.CreatedAt = rwe.Clock.Now()
+
+	if err := insertTagRule(ctx, rule); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"rule": rule,
+	})
+}
+
+func deleteTagRuleHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, (*TagRule)(nil)).
+		Where("id = ?", id).
+		Delete(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package blog
+
+import "testing"
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Go", "go"},
+		{"  go  ", "go"},
+		{"Go Lang", "go-lang"},
+		{"go \t -- lang", "go-lang"},
+		{"go_lang", "go-lang"},
+		{"node.js", "nodejs"},
+		{"C", "c"},
+		{"C++", "c++"},
+		{"C#", "c#"},
+		{"F# / .NET", "f#-net"},
+		{"日本語", "日本語"},
+		{"Русский Язык", "русский-язык"},
+		{"Café", "café"},
+		{"Café", "café"}, // decomposed é
+		{"ÉCOLE", "école"},
+		{"हिन्दी", "हिन्दी"}, // combining marks are kept
+		{"2021", "2021"},
+		{"!!!", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeTag(test.in); got != test.want {
+			t.Errorf("NormalizeTag(%q) = %q, wanted %q", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package blog
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	ReasonSpam      = "spam"
+	ReasonAbuse     = "abuse"
+	ReasonCopyright = "copyright"
+	ReasonIllegal   = "illegal"
+	ReasonOther     = "other"
+)
+
+var takedownReasons = map[string]bool{
+	ReasonSpam:      true,
+	ReasonAbuse:     true,
+	ReasonCopyright: true,
+	ReasonIllegal:   true,
+	ReasonOther:     true,
+}
+
+var errLegalHold = apperr.New(apperr.LegalHold,
+	"content is under legal hold and can't be deleted")
+
+// Takedown describes why an article or comment was hidden by a moderator.
+// Legal hold additionally prevents the author from deleting the content. It is
+// independent of visibility: hiding again or restoring the content keeps the
+// hold until a moderator releases it.
+type Takedown struct {
+	Reason    string    `json:"reason"`
+	LegalHold bool      `json:"legalHold"`
+	HiddenAt  time.Time `json:"hiddenAt"`
+}
+
+func (t *Takedown) validate() error {
+	if !takedownReasons[t.Reason] {
+		return apperr.Validation("reason",
+			"reason must be one of spam, abuse, copyright, illegal, or other")
+	}
+	return nil
+}
+
+func takedownSet(t *Takedown) func(*orm.Query) (*orm.Query, error) {
+	return func(q *orm.Query) (*orm.Query, error) {
+		q = q.Set("hidden_at = ?", t.HiddenAt).
+			Set("hidden_reason = ?", t.Reason).
+			Set("legal_hold = legal_hold OR ?", t.LegalHold).
+			Returning("legal_hold")
+		return q, nil
+	}
+}
+
+func restoreSet(q *orm.Query) (*orm.Query, error) {
+	q = q.Set("hidden_at = NULL").
+		Set("hidden_reason = NULL")
+	return q, nil
+}
+
+// checkArticleLegalHold fails when the author's article or any of its comments
+// is under legal hold. Comments are removed together with the article.
+func checkArticleLegalHold(ctx context.Context, authorID uint64, slug string) error {
+	held, err := rwe.PGMain().ModelContext(ctx, (*Article)(nil)).
+		Where("a.author_id = ?", authorID).
+		Where("a.slug = ?", slug).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			subq := rwe.PGMain().Model((*Comment)(nil)).
+				Where("c.article_id = a.id").
+				Where("c.legal_hold")
+
+			q = q.Where("a.legal_hold").
+				WhereOr("EXISTS (?)", subq)
+			return q, nil
+		}).
+		Exists()
+	if err != nil {
+		return err
+	}
+	if held {
+		return errLegalHold
+	}
+	return nil
+}
+
+func checkCommentsLegalHold(ctx context.Context, authorID, articleID uint64) error {
+	held, err := rwe.PGMain().ModelContext(ctx, (*Comment)(nil)).
+		Where("c.author_id = ?", authorID).
+		Where("c.article_id = ?", articleID).
+		Where("c.legal_hold").
+		Exists()
+	if err != nil {
+		return err
+	}
+	if held {
+		return errLegalHold
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// Appeal is the author's request to restore hidden content.
+type Appeal struct {
+	tableName struct{} `pg:"appeals,alias:ap"`
+
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"-"`
+
+	ArticleID uint64 `json:"-"`
+	CommentID uint64 `json:"commentId,omitempty"`
+
+	Body string `json:"body"`
+
+	Author       string `json:"author" pg:"-"`
+	ArticleSlug  string `json:"articleSlug" pg:"-"`
+	HiddenReason string `json:"hiddenReason" pg:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func SelectAppeals(ctx context.Context) ([]*Appeal, error) {
+	appeals := make([]*Appeal, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &appeals).
+		ColumnExpr("ap.*").
+		ColumnExpr("u.username AS author, a.slug AS article_slug").
+		ColumnExpr("coalesce(c.hidden_reason, a.hidden_reason) AS hidden_reason").
+		Join("JOIN users AS u ON u.id = ap.user_id").
+		Join("JOIN articles AS a ON a.id = ap.article_id").
+		Join("LEFT JOIN comments AS c ON c.id = ap.comment_id").
+		OrderExpr("ap.created_at DESC, ap.id DESC").
+		Limit(100).
+		Select(); err != nil {
+		return nil, err
+	}
+	return appeals, nil
+}
@@ -0,0 +1,269 @@
+package blog
+
+import (
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
+	"github.com/vmihailenco/treemux"
+)
+
+func decodeTakedown(w http.ResponseWriter, req treemux.Request) (*Takedown, error) {
+	var in struct {
+		Takedown *Takedown `json:"takedown"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return nil, err
+	}
+
+	if in.Takedown == nil {
+		return nil, apperr.Required("takedown")
+	}
+
+	t := in.Takedown
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	t.HiddenAt = rwe.Clock.Now()
+
+	return t, nil
+}
+
+func hideArticleHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	t, err := decodeTakedown(w, req)
+	if err != nil {
+		return err
+	}
+
+	res, err := rwe.PGMain().
+		ModelContext(ctx, (*Article)(nil)).
+		Apply(takedownSet(t)).
+		Where("slug = ?", req.Param("slug")).
+		Update(&t.LegalHold)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"takedown": t,
+	})
+}
+
+func restoreArticleHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, (*Article)(nil)).
+		Apply(restoreSet).
+		Where("slug = ?", req.Param("slug")).
+		Update(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func hideCommentHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	t, err := decodeTakedown(w, req)
+	if err != nil {
+		return err
+	}
+
+	res, err := rwe.PGMain().
+		ModelContext(ctx, (*Comment)(nil)).
+		Apply(takedownSet(t)).
+		Where("id = ?", id).
+		Update(&t.LegalHold)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"takedown": t,
+	})
+}
+
+func restoreCommentHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, (*Comment)(nil)).
+		Apply(restoreSet).
+		Where("id = ?", id).
+		Update(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// releaseArticleHoldHandler lifts the legal hold, so the author can delete
+// the article again. Visibility is not changed.
+func releaseArticleHoldHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	res, err := rwe.PGMain().
+		ModelContext(ctx, (*Article)(nil)).
+		Set("legal_hold = false").
+		Where("slug = ?", req.Param("slug")).
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+func releaseCommentHoldHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	res, err := rwe.PGMain().
+		ModelContext(ctx, (*Comment)(nil)).
+		Set("legal_hold = false").
+		Where("id = ?", id).
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+func listAppealsHandler(w http.ResponseWriter, req treemux.Request) error {
+	appeals, err := SelectAppeals(req.Context())
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"appeals": appeals,
+	})
+}
+
+//------------------------------------------------------------------------------
+
+func appealArticleHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	article := new(Article)
+	if err := rwe.PGMain().ModelContext(ctx, article).
+		Column("id", "slug", "hidden_reason").
+		Where("slug = ?", req.Param("slug")).
+		Where("author_id = ?", user.ID).
+		Where("hidden_at IS NOT NULL").
+		Select(); err != nil {
+		return err
+	}
+
+	appeal := &Appeal{
+		ArticleID:    article.ID,
+		ArticleSlug:  article.Slug,
+		HiddenReason: article.HiddenReason,
+	}
+	return createAppeal(w, req, appeal)
+}
+
+func appealCommentHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	comment := new(Comment)
+	if err := rwe.PGMain().ModelContext(ctx, comment).
+		Column("c.id", "c.article_id", "c.hidden_reason").
+		Join("JOIN articles AS a ON a.id = c.article_id").
+		Where("a.slug = ?", req.Param("slug")).
+		Where("c.id = ?", id).
+		Where("c.author_id = ?", user.ID).
+		Where("c.hidden_at IS NOT NULL").
+		Select(); err != nil {
+		return err
+	}
+
+	appeal := &Appeal{
+		ArticleID:    comment.ArticleID,
+		CommentID:    comment.ID,
+		ArticleSlug:  req.Param("slug"),
+		HiddenReason: comment.HiddenReason,
+	}
+	return createAppeal(w, req, appeal)
+}
+
+func createAppeal(w http.ResponseWriter, req treemux.Request, appeal *Appeal) error {
+	ctx := req.Context()
+	user := org.UserFromContext(ctx)
+
+	var in struct {
+		Appeal *struct {
+			Body string `json:"body"`
+		} `json:"appeal"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Appeal == nil {
+		return apperr.Required("appeal")
+	}
+	if err := textutil.Text("body", &in.Appeal.Body, 0); err != nil {
+		return err
+	}
+	if in.Appeal.Body == "" {
+		return apperr.Validation("body", "appeal body is required")
+	}
+
+	appeal.UserID = user.ID
+	appeal.Author = user.Username
+	appeal.Body = in.Appeal.Body
+	appeal.CreatedAt = rwe.Clock.Now()
+
+	if _, err := rwe.PGMain().
+		ModelContext(ctx, appeal).
+		Insert(); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"appeal": appeal,
+	})
+}
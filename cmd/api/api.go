@@ -9,7 +9,9 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	_ "github.com/uptrace/go-realworld-example-app/admin"
 	_ "github.com/uptrace/go-realworld-example-app/blog"
+	_ "github.com/uptrace/go-realworld-example-app/experiment"
 	"github.com/uptrace/go-realworld-example-app/httputil"
 	_ "github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
@@ -31,6 +33,12 @@ func main() {
 	ctx = rwe.Init(ctx, cfg)
 	defer rwe.Exit(ctx)
 
+	if err := rwe.ParseTemplates(); err != nil {
+		logrus.WithContext(ctx).WithError(err).Fatal("ParseTemplates failed")
+	}
+
+	rwe.StartJobWorker(ctx)
+
 	var handler http.Handler
 	handler = rwe.Router
 	handler = httputil.PanicHandler{Next: handler}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-pg/migrations/v8"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The migration normalizes existing tags like blog.NormalizeTag, which has no
+// SQL equivalent. Original tag spelling is not preserved, so there is nothing
+// to migrate down.
+func init() {
+	migrations.MustRegisterTx(normalizeTags, func(db migrations.DB) error {
+		return nil
+	})
+}
+
+func normalizeTags(db migrations.DB) error {
+	var tags []string
+	if _, err := db.Query(&tags, `
+		SELECT tag FROM article_tags WHERE tag IS NOT NULL
+		UNION
+		SELECT tag FROM subscriptions WHERE tag IS NOT NULL
+	`); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		norm := normalizeTag(tag)
+		if norm == tag {
+			continue
+		}
+		if err := normalizeArticleTag(db, tag, norm); err != nil {
+			return err
+		}
+		if err := normalizeSubscriptionTag(db, tag, norm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeTag is a copy of blog.NormalizeTag at the time of the migration.
+// Don't change it: the migration must keep doing what it did when it was
+// applied.
+func normalizeTag(tag string) string {
+	tag = norm.NFC.String(strings.ToLower(tag))
+
+	var b strings.Builder
+	sep := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r), unicode.IsDigit(r), r == '+', r == '#':
+			if sep && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			sep = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r), r == '-', r == '_':
+			sep = true
+		}
+	}
+	return b.String()
+}
+
+// normalizeArticleTag renames the tag and drops it from articles that already
+// have the normalized tag. Tags without letters or digits are deleted.
+func normalizeArticleTag(db migrations.DB, tag, norm string) error {
+	if norm == "" {
+		_, err := db.Exec(`DELETE FROM article_tags WHERE tag = ?`, tag)
+		return err
+	}
+
+	if _, err := db.Exec(`
+		DELETE FROM article_tags AS t
+		WHERE t.tag = ?0
+		  AND EXISTS (
+		    SELECT 1 FROM article_tags AS dup
+		    WHERE dup.article_id = t.article_id AND dup.tag = ?1
+		  )
+	`, tag, norm); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`UPDATE article_tags SET tag = ?0 WHERE tag = ?1`, norm, tag)
+	return err
+}
+
+// normalizeSubscriptionTag is like normalizeArticleTag for tag subscriptions.
+func normalizeSubscriptionTag(db migrations.DB, tag, norm string) error {
+	if norm == "" {
+		_, err := db.Exec(`DELETE FROM subscriptions WHERE tag = ?`, tag)
+		return err
+	}
+
+	if _, err := db.Exec(`
+		DELETE FROM subscriptions AS s
+		WHERE s.tag = ?0
+		  AND EXISTS (
+		    SELECT 1 FROM subscriptions AS dup
+		    WHERE dup.user_id = s.user_id
+		      AND dup.kind = s.kind
+		      AND coalesce(dup.author_id, 0) = coalesce(s.author_id, 0)
+		      AND dup.tag = ?1
+		  )
+	`, tag, norm); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`UPDATE subscriptions SET tag = ?0 WHERE tag = ?1`, norm, tag)
+	return err
+}
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN languages;
+
+--gopg:split
+
+ALTER TABLE articles DROP COLUMN language;
@@ -0,0 +1,5 @@
+ALTER TABLE articles ADD COLUMN language varchar(3);
+
+--gopg:split
+
+ALTER TABLE users ADD COLUMN languages varchar(3)[];
@@ -0,0 +1,13 @@
+CREATE TABLE favorite_tombstones (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  user_id int8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  article_id int8 NOT NULL,
+  slug varchar(500) NOT NULL,
+  deleted_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX favorite_tombstones_user_id_article_id_idx
+ON favorite_tombstones (user_id, article_id);
+
+CREATE INDEX favorite_tombstones_deleted_at_idx
+ON favorite_tombstones (deleted_at);
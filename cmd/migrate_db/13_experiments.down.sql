@@ -0,0 +1,2 @@
+DROP TABLE experiment_exposures;
+DROP TABLE experiments;
@@ -0,0 +1,17 @@
+CREATE TABLE experiments (
+  name varchar(100) PRIMARY KEY,
+  variants varchar(100)[] NOT NULL,
+  started_at timestamptz NOT NULL DEFAULT now(),
+  stopped_at timestamptz
+);
+
+--gopg:split
+
+CREATE TABLE experiment_exposures (
+  experiment varchar(100) NOT NULL REFERENCES experiments (name) ON DELETE CASCADE,
+  user_id int8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  variant varchar(100) NOT NULL,
+  exposed_at timestamptz NOT NULL DEFAULT now(),
+
+  PRIMARY KEY (experiment, user_id)
+);
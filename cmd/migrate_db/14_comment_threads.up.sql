@@ -0,0 +1,7 @@
+ALTER TABLE comments
+  ADD COLUMN parent_id int8 REFERENCES comments (id) ON DELETE SET NULL,
+  ADD COLUMN depth int2 NOT NULL DEFAULT 0;
+
+--gopg:split
+
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
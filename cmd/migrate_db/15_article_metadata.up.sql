@@ -0,0 +1 @@
+ALTER TABLE articles ADD COLUMN metadata jsonb NOT NULL DEFAULT '{}';
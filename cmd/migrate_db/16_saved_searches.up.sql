@@ -0,0 +1,11 @@
+CREATE TABLE saved_searches (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  user_id int8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  query varchar(100) NOT NULL,
+  pattern varchar(500) NOT NULL,
+  tag varchar(500) NOT NULL,
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX saved_searches_user_id_query_idx ON saved_searches (user_id, query);
@@ -0,0 +1,8 @@
+ALTER TABLE users
+ALTER COLUMN bio TYPE varchar(500);
+
+--gopg:split
+
+ALTER TABLE articles
+ALTER COLUMN title TYPE varchar(500),
+ALTER COLUMN description TYPE varchar(500);
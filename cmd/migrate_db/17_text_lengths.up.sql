@@ -0,0 +1,10 @@
+-- Lengths are checked in user perceived characters, which can take several
+-- code points each, so the columns can't limit them.
+ALTER TABLE articles
+ALTER COLUMN title TYPE text,
+ALTER COLUMN description TYPE text;
+
+--gopg:split
+
+ALTER TABLE users
+ALTER COLUMN bio TYPE text;
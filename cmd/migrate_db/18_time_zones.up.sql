@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN time_zone varchar(64);
@@ -0,0 +1,21 @@
+CREATE TABLE tag_rules (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  kind varchar(20) NOT NULL,
+  tag varchar(500) NOT NULL,
+  target varchar(500) NOT NULL,
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+--gopg:split
+
+CREATE UNIQUE INDEX tag_rules_kind_tag_target_idx ON tag_rules (kind, tag, target);
+
+--gopg:split
+
+-- A tag has at most one synonym.
+CREATE UNIQUE INDEX tag_rules_synonym_idx ON tag_rules (tag) WHERE kind = 'synonym';
+
+--gopg:split
+
+CREATE INDEX tag_rules_target_idx ON tag_rules (target);
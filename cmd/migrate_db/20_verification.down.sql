@@ -0,0 +1,5 @@
+DROP TABLE verification_requests;
+
+--gopg:split
+
+ALTER TABLE users DROP COLUMN verified;
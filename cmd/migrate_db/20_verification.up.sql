@@ -0,0 +1,26 @@
+ALTER TABLE users
+ADD COLUMN verified boolean NOT NULL DEFAULT false;
+
+--gopg:split
+
+CREATE TABLE verification_requests (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  user_id int8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  evidence text NOT NULL,
+  status varchar(20) NOT NULL DEFAULT 'pending',
+  note text NOT NULL DEFAULT '',
+  reviewer_id int8 REFERENCES users (id) ON DELETE SET NULL,
+
+  created_at timestamptz NOT NULL DEFAULT now(),
+  reviewed_at timestamptz
+);
+
+--gopg:split
+
+-- A user has at most one request waiting for review.
+CREATE UNIQUE INDEX verification_requests_pending_idx ON verification_requests (user_id)
+WHERE status = 'pending';
+
+--gopg:split
+
+CREATE INDEX verification_requests_user_id_idx ON verification_requests (user_id, created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE users
+ADD COLUMN ghost boolean NOT NULL DEFAULT false;
+
+--gopg:split
+
+-- There is a single ghost user, see org.GhostUser.
+CREATE UNIQUE INDEX users_ghost_idx ON users (ghost) WHERE ghost;
@@ -0,0 +1,3 @@
+-- Views are reported in batches by the analytics pipeline.
+ALTER TABLE articles
+ADD COLUMN views_count int8 NOT NULL DEFAULT 0;
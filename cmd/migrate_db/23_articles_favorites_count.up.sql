@@ -0,0 +1,4 @@
+-- Existing articles are counted by the articles_favorites_count backfill, see
+-- blog/favorites_count.go.
+ALTER TABLE articles
+ADD COLUMN favorites_count int4 NOT NULL DEFAULT 0;
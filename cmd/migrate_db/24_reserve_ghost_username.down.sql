@@ -0,0 +1,4 @@
+UPDATE users
+SET username = 'ghost'
+WHERE username = 'ghost-' || id AND NOT ghost
+AND NOT EXISTS (SELECT 1 FROM users WHERE username = 'ghost');
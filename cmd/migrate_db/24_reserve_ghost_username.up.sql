@@ -0,0 +1,6 @@
+-- Accounts that registered the ghost username before it was reserved are
+-- renamed, so org.GhostUser can create the ghost user. Their owners keep the
+-- email and password and can choose another username.
+UPDATE users
+SET username = 'ghost-' || id
+WHERE username = 'ghost' AND NOT ghost;
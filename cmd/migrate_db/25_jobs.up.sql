@@ -0,0 +1,17 @@
+CREATE TABLE jobs (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  name varchar(500) NOT NULL,
+  args jsonb NOT NULL,
+  attempts int4 NOT NULL DEFAULT 0,
+  last_error text,
+
+  run_at timestamptz NOT NULL DEFAULT now(),
+  locked_until timestamptz,
+  failed_at timestamptz,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+--gopg:split
+
+-- Due jobs are claimed in run_at order, see rwe.RunJobs.
+CREATE INDEX jobs_run_at_idx ON jobs (run_at) WHERE failed_at IS NULL;
@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS articles_author_id_idx;
+
+--gopg:split
+
+DROP INDEX IF EXISTS comments_article_id_created_at_idx;
+
+--gopg:split
+
+DROP INDEX IF EXISTS follow_users_followed_user_id_created_at_idx;
+
+--gopg:split
+
+ALTER TABLE follow_users DROP COLUMN created_at;
+
+--gopg:split
+
+ALTER TABLE favorite_articles DROP COLUMN created_at;
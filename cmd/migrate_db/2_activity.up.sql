@@ -0,0 +1,21 @@
+ALTER TABLE favorite_articles
+ADD COLUMN created_at timestamptz NOT NULL DEFAULT now();
+
+--gopg:split
+
+ALTER TABLE follow_users
+ADD COLUMN created_at timestamptz NOT NULL DEFAULT now();
+
+--gopg:split
+
+CREATE INDEX follow_users_followed_user_id_created_at_idx
+ON follow_users (followed_user_id, created_at);
+
+--gopg:split
+
+CREATE INDEX comments_article_id_created_at_idx
+ON comments (article_id, created_at);
+
+--gopg:split
+
+CREATE INDEX articles_author_id_idx ON articles (author_id);
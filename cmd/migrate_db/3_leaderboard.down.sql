@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS follow_users_created_at_idx;
+
+--gopg:split
+
+DROP INDEX IF EXISTS favorite_articles_created_at_idx;
+
+--gopg:split
+
+ALTER TABLE users DROP COLUMN hide_from_leaderboard;
@@ -0,0 +1,10 @@
+ALTER TABLE users
+ADD COLUMN hide_from_leaderboard boolean NOT NULL DEFAULT false;
+
+--gopg:split
+
+CREATE INDEX favorite_articles_created_at_idx ON favorite_articles (created_at);
+
+--gopg:split
+
+CREATE INDEX follow_users_created_at_idx ON follow_users (created_at);
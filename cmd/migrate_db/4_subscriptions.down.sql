@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN rss_token;
+
+--gopg:split
+
+DROP TABLE IF EXISTS subscriptions;
@@ -0,0 +1,25 @@
+CREATE TABLE subscriptions (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  user_id int8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  kind varchar(50) NOT NULL,
+  author_id int8 REFERENCES users (id) ON DELETE CASCADE,
+  tag varchar(500),
+  channels varchar(50)[] NOT NULL DEFAULT '{}',
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX subscriptions_user_id_target_idx
+ON subscriptions (user_id, kind, coalesce(author_id, 0), coalesce(tag, ''));
+
+CREATE INDEX subscriptions_author_id_idx ON subscriptions (author_id)
+WHERE author_id IS NOT NULL;
+
+CREATE INDEX subscriptions_tag_idx ON subscriptions (tag)
+WHERE tag IS NOT NULL;
+
+--gopg:split
+
+ALTER TABLE users ADD COLUMN rss_token varchar(100);
+
+CREATE UNIQUE INDEX users_rss_token_idx ON users (rss_token);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS users_username_trgm_idx;
+
+--gopg:split
+
+DROP INDEX IF EXISTS article_tags_tag_trgm_idx;
+
+--gopg:split
+
+DROP INDEX IF EXISTS articles_title_trgm_idx;
@@ -0,0 +1,16 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+--gopg:split
+
+CREATE INDEX articles_title_trgm_idx
+ON articles USING gin (title gin_trgm_ops);
+
+--gopg:split
+
+CREATE INDEX article_tags_tag_trgm_idx
+ON article_tags USING gin (tag gin_trgm_ops);
+
+--gopg:split
+
+CREATE INDEX users_username_trgm_idx
+ON users USING gin (username gin_trgm_ops);
@@ -0,0 +1,2 @@
+ALTER TABLE users
+ADD COLUMN role varchar(50) NOT NULL DEFAULT 'user';
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS appeals;
+
+--gopg:split
+
+ALTER TABLE comments
+DROP COLUMN legal_hold,
+DROP COLUMN hidden_reason,
+DROP COLUMN hidden_at;
+
+--gopg:split
+
+ALTER TABLE articles
+DROP COLUMN legal_hold,
+DROP COLUMN hidden_reason,
+DROP COLUMN hidden_at;
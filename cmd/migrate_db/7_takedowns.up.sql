@@ -0,0 +1,26 @@
+ALTER TABLE articles
+ADD COLUMN hidden_at timestamptz,
+ADD COLUMN hidden_reason varchar(50),
+ADD COLUMN legal_hold boolean NOT NULL DEFAULT false;
+
+--gopg:split
+
+ALTER TABLE comments
+ADD COLUMN hidden_at timestamptz,
+ADD COLUMN hidden_reason varchar(50),
+ADD COLUMN legal_hold boolean NOT NULL DEFAULT false;
+
+--gopg:split
+
+CREATE TABLE appeals (
+  id int8 PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+  user_id int8 NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  article_id int8 REFERENCES articles (id) ON DELETE CASCADE,
+  comment_id int8 REFERENCES comments (id) ON DELETE CASCADE,
+
+  body text NOT NULL,
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX appeals_created_at_idx ON appeals (created_at);
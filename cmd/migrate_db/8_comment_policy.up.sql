@@ -0,0 +1,2 @@
+ALTER TABLE articles
+ADD COLUMN comment_policy varchar(50) NOT NULL DEFAULT 'everyone';
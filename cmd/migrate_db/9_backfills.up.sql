@@ -0,0 +1,10 @@
+CREATE TABLE backfills (
+  name varchar(500) PRIMARY KEY,
+  last_id int8 NOT NULL DEFAULT 0,
+  max_id int8 NOT NULL DEFAULT 0,
+  rows_updated int8 NOT NULL DEFAULT 0,
+
+  started_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  finished_at timestamptz
+);
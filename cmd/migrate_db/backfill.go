@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+)
+
+func init() {
+	// Counts favorites of the articles that existed when the backfill started.
+	// Turn on the articles_favorites_count feature first, so articles created
+	// later are kept in sync by the dual writes, see blog/favorites_count.go.
+	migrate.RegisterBackfill(&migrate.Backfill{
+		Name:  "articles_favorites_count",
+		Table: "articles",
+		Set: `favorites_count = (
+			SELECT count(*) FROM favorite_articles AS fa WHERE fa.article_id = articles.id
+		)`,
+		Pause: 100 * time.Millisecond,
+	})
+}
+
+// runBackfill handles the backfill command:
+//
+//	migrate_db backfill             lists backfills and their progress
+//	migrate_db backfill NAME        runs or resumes the backfill
+//	migrate_db backfill reset NAME  discards the progress
+func runBackfill(ctx context.Context, args []string) error {
+	switch len(args) {
+	case 0:
+		return listBackfills(ctx)
+	case 1:
+		b, err := lookupBackfill(args[0])
+		if err != nil {
+			return err
+		}
+		return b.Run(ctx)
+	case 2:
+		if args[0] != "reset" {
+			break
+		}
+		b, err := lookupBackfill(args[1])
+		if err != nil {
+			return err
+		}
+		return b.Reset(ctx)
+	}
+	return fmt.Errorf("usage: migrate_db backfill [reset] [NAME]")
+}
+
+func lookupBackfill(name string) (*migrate.Backfill, error) {
+	b, ok := migrate.LookupBackfill(name)
+	if !ok {
+		return nil, fmt.Errorf("backfill %q is not registered", name)
+	}
+	return b, nil
+}
+
+func listBackfills(ctx context.Context) error {
+	list := migrate.Backfills()
+	if len(list) == 0 {
+		fmt.Println("no backfills registered")
+		return nil
+	}
+
+	for _, b := range list {
+		p, err := migrate.SelectBackfillProgress(ctx, b.Name)
+		switch {
+		case err == pg.ErrNoRows:
+			fmt.Printf("%s\tnot started\n", b.Name)
+		case err != nil:
+			return err
+		case !p.FinishedAt.IsZero():
+			fmt.Printf("%s\tfinished at %s, %d rows updated\n",
+				b.Name, p.FinishedAt.Format("2006-01-02 15:04:05"), p.RowsUpdated)
+		default:
+			fmt.Printf("%s\t%.1f%% done, %d rows updated\n",
+				b.Name, p.Percent(), p.RowsUpdated)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	. "github.com/uptrace/go-realworld-example-app/testbed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("articles_favorites_count backfill", func() {
+	var articleID int64
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+
+		var userID int64
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&userID), `
+			INSERT INTO users (username, email, password_hash)
+			VALUES ('backfill', 'backfill@example.com', '#1')
+			RETURNING id
+		`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = rwe.PGMain().QueryOneContext(ctx, pg.Scan(&articleID), `
+			INSERT INTO articles (slug, title, description, body, author_id)
+			VALUES ('favorited', 'title', 'description', 'body', ?)
+			RETURNING id
+		`, userID)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = rwe.PGMain().ExecContext(ctx, `
+			INSERT INTO favorite_articles (user_id, article_id) VALUES (?, ?)
+		`, userID, articleID)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("counts existing favorites", func() {
+		b, ok := migrate.LookupBackfill("articles_favorites_count")
+		Expect(ok).To(BeTrue())
+		Expect(b.Run(ctx)).To(Succeed())
+
+		var n int
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&n),
+			"SELECT favorites_count FROM articles WHERE id = ?", articleID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+	})
+})
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/go-pg/migrations/v8"
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	// minPGVersion is PostgreSQL 10, which added identity columns.
+	minPGVersion = 100000
+
+	minSecretLength = 32
+
+	// sampleSecretKey is the secret published in app/config/dev.yml.default.
+	sampleSecretKey = "JeFvgCrMuvkoAJjkHgyaMDxku"
+)
+
+// requiredExtensions are the extensions the migrations create.
+var requiredExtensions = []string{"pg_trgm"}
+
+type checkResult struct {
+	name string
+	err  error
+	info string
+}
+
+// runDoctor handles the doctor command that checks the deployment before the
+// first boot or an upgrade:
+//
+//	migrate_db doctor
+func runDoctor(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: migrate_db doctor")
+	}
+
+	var results []checkResult
+	check := func(name string, fn func() (string, error)) bool {
+		info, err := fn()
+		results = append(results, checkResult{name: name, info: info, err: err})
+		return err == nil
+	}
+
+	db := rwe.PGMain().WithContext(ctx)
+	if check("postgres", func() (string, error) { return checkPostgres(db) }) {
+		check("migrations", func() (string, error) { return checkMigrations(db) })
+		for _, ext := range requiredExtensions {
+			ext := ext
+			check("extension "+ext, func() (string, error) { return checkExtension(db, ext) })
+		}
+	}
+	check("redis", func() (string, error) { return checkRedis(ctx) })
+	check("secret_key", checkSecretKey)
+	check("site_url", checkSiteURL)
+	check("signing_keys", checkSigningKeys)
+
+	var failed int
+	for _, res := range results {
+		if res.err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s\t%s\n", res.name, res.err)
+			continue
+		}
+		fmt.Printf("ok\t%s\t%s\n", res.name, res.info)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+func checkPostgres(db *pg.DB) (string, error) {
+	var version string
+	var versionNum int
+	if _, err := db.QueryOne(pg.Scan(&version, &versionNum),
+		"SELECT current_setting('server_version'), current_setting('server_version_num')::int"); err != nil {
+		return "", fmt.Errorf("can't connect: %w; check pg_main in the config", err)
+	}
+	if versionNum < minPGVersion {
+		return "", fmt.Errorf("PostgreSQL %s is not supported; upgrade to 10 or later", version)
+	}
+	return "PostgreSQL " + version, nil
+}
+
+func checkMigrations(db *pg.DB) (string, error) {
+	var latest int64
+	for _, m := range migrations.DefaultCollection.Migrations() {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+
+	exists, err := db.Model().
+		Table("pg_tables").
+		Where("tablename = 'gopg_migrations'").
+		Exists()
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("database is not initialized; run migrate_db init and migrate_db")
+	}
+
+	version, err := migrations.Version(db)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case version < latest:
+		return "", fmt.Errorf("version is %d, latest is %d; run migrate_db", version, latest)
+	case version > latest:
+		return "", fmt.Errorf("version is %d, but this build knows only %d; deploy a newer build",
+			version, latest)
+	}
+	return fmt.Sprintf("version is %d", version), nil
+}
+
+func checkExtension(db *pg.DB, name string) (string, error) {
+	var installed, available bool
+	if _, err := db.QueryOne(pg.Scan(&installed, &available), `
+		SELECT
+			EXISTS (SELECT 1 FROM pg_extension WHERE extname = ?0),
+			EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = ?0)
+	`, name); err != nil {
+		return "", err
+	}
+	switch {
+	case installed:
+		return "installed", nil
+	case available:
+		return "", fmt.Errorf("not installed; run migrate_db or CREATE EXTENSION %s as a superuser", name)
+	default:
+		return "", fmt.Errorf("not available; install the postgresql-contrib package")
+	}
+}
+
+func checkRedis(ctx context.Context) (string, error) {
+	if err := rwe.RedisRing().Ping(ctx).Err(); err != nil {
+		return "", fmt.Errorf("can't connect: %w; check redis_cache in the config", err)
+	}
+	return "ping succeeded", nil
+}
+
+func checkSecretKey() (string, error) {
+	switch key := rwe.Config.SecretKey; {
+	case key == sampleSecretKey:
+		return "", fmt.Errorf("is the sample key from dev.yml.default; generate a new one")
+	case len(key) < minSecretLength:
+		return "", fmt.Errorf("is %d bytes long; use at least %d random bytes", len(key), minSecretLength)
+	}
+	return "strong enough", nil
+}
+
+func checkSiteURL() (string, error) {
+	if rwe.Config.SiteURL == "" {
+		return "", fmt.Errorf("is empty; links to the site can't be generated")
+	}
+	u, err := url.Parse(rwe.Config.SiteURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", rwe.Config.SiteURL)
+	}
+	return rwe.Config.SiteURL, nil
+}
+
+func checkSigningKeys() (string, error) {
+	for id, secret := range rwe.Config.SigningKeys {
+		if len(secret) < minSecretLength {
+			return "", fmt.Errorf("secret of %q is %d bytes long; use at least %d random bytes",
+				id, len(secret), minSecretLength)
+		}
+	}
+	return fmt.Sprintf("%d keys", len(rwe.Config.SigningKeys)), nil
+}
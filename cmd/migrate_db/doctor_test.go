@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/migrations/v8"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDoctorConfigChecks(t *testing.T) {
+	saved := *rwe.Config
+	defer func() { *rwe.Config = saved }()
+
+	strong := strings.Repeat("k", minSecretLength)
+
+	tests := []struct {
+		name  string
+		check func() (string, error)
+		setup func()
+		err   string
+	}{
+		{"secret_key", checkSecretKey, func() { rwe.Config.SecretKey = strong }, ""},
+		{"secret_key", checkSecretKey, func() { rwe.Config.SecretKey = sampleSecretKey }, "is the sample key"},
+		{"secret_key", checkSecretKey, func() { rwe.Config.SecretKey = "short" }, "is 5 bytes long"},
+		{"site_url", checkSiteURL, func() { rwe.Config.SiteURL = "https://example.com" }, ""},
+		{"site_url", checkSiteURL, func() { rwe.Config.SiteURL = "" }, "is empty"},
+		{"site_url", checkSiteURL, func() { rwe.Config.SiteURL = "example.com" }, "is not an absolute URL"},
+		{"signing_keys", checkSigningKeys, func() { rwe.Config.SigningKeys = nil }, ""},
+		{"signing_keys", checkSigningKeys, func() {
+			rwe.Config.SigningKeys = map[string]string{"analytics": strong, "webhooks": "short"}
+		}, `secret of "webhooks" is 5 bytes long`},
+	}
+
+	for _, test := range tests {
+		test.setup()
+		_, err := test.check()
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: %s", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, wanted %q", test.name, err, test.err)
+		}
+	}
+}
+
+var _ = Describe("doctor", func() {
+	var version int64
+
+	BeforeEach(func() {
+		var err error
+		version, err = migrations.Version(rwe.PGMain())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(migrations.SetVersion(rwe.PGMain(), version)).To(Succeed())
+	})
+
+	It("passes on a migrated database", func() {
+		info, err := checkMigrations(rwe.PGMain())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(fmt.Sprintf("version is %d", version)))
+
+		info, err = checkExtension(rwe.PGMain(), "pg_trgm")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal("installed"))
+	})
+
+	It("reports a pending migration", func() {
+		Expect(migrations.SetVersion(rwe.PGMain(), version-1)).To(Succeed())
+
+		_, err := checkMigrations(rwe.PGMain())
+		Expect(err).To(MatchError(fmt.Sprintf(
+			"version is %d, latest is %d; run migrate_db", version-1, version)))
+	})
+
+	It("reports a database migrated by a newer build", func() {
+		Expect(migrations.SetVersion(rwe.PGMain(), version+1)).To(Succeed())
+
+		_, err := checkMigrations(rwe.PGMain())
+		Expect(err).To(MatchError(fmt.Sprintf(
+			"version is %d, but this build knows only %d; deploy a newer build", version+1, version)))
+	})
+
+	It("reports a missing extension", func() {
+		_, err := checkExtension(rwe.PGMain(), "no_such_extension")
+		Expect(err).To(MatchError("not available; install the postgresql-contrib package"))
+	})
+
+	It("fails when any check fails", func() {
+		saved := *rwe.Config
+		defer func() { *rwe.Config = saved }()
+		rwe.Config.SecretKey = strings.Repeat("k", minSecretLength)
+		rwe.Config.SiteURL = "https://example.com"
+		rwe.Config.SigningKeys = nil
+
+		Expect(runDoctor(ctx, nil)).To(Succeed())
+
+		extensions := requiredExtensions
+		requiredExtensions = append([]string{"no_such_extension"}, extensions...)
+		defer func() { requiredExtensions = extensions }()
+
+		// postgres, migrations, 2 extensions, redis, and 3 config checks.
+		Expect(runDoctor(ctx, nil)).To(MatchError("1 of 8 checks failed"))
+
+		Expect(migrations.SetVersion(rwe.PGMain(), version-1)).To(Succeed())
+		Expect(runDoctor(ctx, nil)).To(MatchError("2 of 8 checks failed"))
+	})
+
+	It("rejects arguments", func() {
+		Expect(runDoctor(ctx, []string{"extra"})).To(MatchError("usage: migrate_db doctor"))
+	})
+})
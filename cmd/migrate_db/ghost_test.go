@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	. "github.com/uptrace/go-realworld-example-app/testbed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("reserve_ghost_username migration", func() {
+	var userID uint64
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+
+		// The account was registered before the username was reserved.
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&userID), `
+			INSERT INTO users (username, email, password_hash)
+			VALUES (?, 'ghost@example.com', '#1')
+			RETURNING id
+		`, org.GhostUsername)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("renames the account so the ghost user can be created", func() {
+		_, err := org.GhostUser(ctx, rwe.PGMain())
+		Expect(err).To(HaveOccurred())
+
+		up, err := ioutil.ReadFile("24_reserve_ghost_username.up.sql")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = rwe.PGMain().ExecContext(ctx, string(up))
+		Expect(err).NotTo(HaveOccurred())
+
+		ghost, err := org.GhostUser(ctx, rwe.PGMain())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ghost.Username).To(Equal(org.GhostUsername))
+		Expect(ghost.Ghost).To(BeTrue())
+		Expect(ghost.ID).NotTo(Equal(userID))
+
+		var username string
+		_, err = rwe.PGMain().QueryOneContext(ctx, pg.Scan(&username),
+			"SELECT username FROM users WHERE id = ?", userID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(username).To(Equal(fmt.Sprintf("ghost-%d", userID)))
+	})
+})
@@ -29,7 +29,35 @@ func main() {
 	defer rwe.Exit(ctx)
 
 	args := flag.Args()
-	oldVersion, newVersion, err := migrations.Run(rwe.PGMain(), args...)
+	if len(args) > 0 && args[0] == "backfill" {
+		if err := runBackfill(ctx, args[1:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "purge" {
+		if err := runPurge(ctx, args[1:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "search" {
+		if err := runSearch(ctx, args[1:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "doctor" {
+		if err := runDoctor(ctx, args[1:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	oldVersion, newVersion, err := migrations.Run(rwe.PGMain().WithContext(ctx), args...)
 	if err != nil {
 		logrus.Fatalf("migration %d -> %d failed: %s",
 			oldVersion, newVersion, err)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/xconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMigrateDB(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "migrate_db")
+}
+
+var ctx context.Context
+
+func init() {
+	ctx = context.Background()
+
+	cfg, err := xconfig.LoadConfig("test")
+	if err != nil {
+		panic(err)
+	}
+
+	ctx = rwe.Init(ctx, cfg)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Go Lang", "go-lang"},
+		{"C", "c"},
+		{"C++", "c++"},
+		{"C#", "c#"},
+		{"日本語", "日本語"},
+		{"Café", "café"},
+		{"!!!", ""},
+	}
+
+	for _, test := range tests {
+		if got := normalizeTag(test.in); got != test.want {
+			t.Errorf("normalizeTag(%q) = %q, wanted %q", test.in, got, test.want)
+		}
+	}
+}
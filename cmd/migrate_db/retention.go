@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/migrate"
+)
+
+const day = 24 * time.Hour
+
+func init() {
+	// Appeals keep hidden content from being purged while moderators review it.
+	migrate.RegisterRetention(&migrate.Retention{
+		Name:   "appeals",
+		Table:  "appeals",
+		Column: "created_at",
+		TTL:    90 * day,
+	})
+
+	// Tombstones outlive favorites sync tokens, which expire after 30 days.
+	migrate.RegisterRetention(&migrate.Retention{
+		Name:   "favorite_tombstones",
+		Table:  "favorite_tombstones",
+		Column: "deleted_at",
+		TTL:    90 * day,
+	})
+
+	migrate.RegisterRetention(&migrate.Retention{
+		Name:   "hidden_comments",
+		Table:  "comments",
+		Column: "hidden_at",
+		Where: "NOT comments.legal_hold AND NOT EXISTS (" +
+			"SELECT 1 FROM appeals WHERE appeals.comment_id = comments.id)",
+		TTL: 30 * day,
+	})
+
+	migrate.RegisterRetention(&migrate.Retention{
+		Name:   "hidden_articles",
+		Table:  "articles",
+		Column: "hidden_at",
+		// Appeals of comments are matched through the comments, so they keep
+		// the article even without the article id.
+		Where: "NOT articles.legal_hold AND NOT EXISTS (" +
+			"SELECT 1 FROM appeals WHERE appeals.article_id = articles.id) AND NOT EXISTS (" +
+			"SELECT 1 FROM appeals JOIN comments ON comments.id = appeals.comment_id " +
+			"WHERE comments.article_id = articles.id) AND NOT EXISTS (" +
+			"SELECT 1 FROM comments WHERE comments.article_id = articles.id AND comments.legal_hold)",
+		TTL: 30 * day,
+	})
+}
+
+// runPurge handles the purge command:
+//
+//	migrate_db purge       deletes expired rows of all tables
+//	migrate_db purge NAME  applies only the named retention
+func runPurge(ctx context.Context, args []string) error {
+	list := migrate.Retentions()
+	switch len(args) {
+	case 0:
+	case 1:
+		r, ok := migrate.LookupRetention(args[0])
+		if !ok {
+			return fmt.Errorf("retention %q is not registered", args[0])
+		}
+		list = []*migrate.Retention{r}
+	default:
+		return fmt.Errorf("usage: migrate_db purge [NAME]")
+	}
+
+	for _, r := range list {
+		n, err := r.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("retention %s: %w", r.Name, err)
+		}
+		fmt.Printf("%s\t%d rows older than %s deleted\n", r.Name, n, r.Period())
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	. "github.com/uptrace/go-realworld-example-app/testbed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("hidden_articles retention", func() {
+	var userID, articleID, commentID int64
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&userID), `
+			INSERT INTO users (username, email, password_hash)
+			VALUES ('purge', 'purge@example.com', '#1')
+			RETURNING id
+		`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = rwe.PGMain().QueryOneContext(ctx, pg.Scan(&articleID), `
+			INSERT INTO articles (slug, title, description, body, author_id, hidden_at)
+			VALUES ('hidden', 'title', 'description', 'body', ?, ?)
+			RETURNING id
+		`, userID, rwe.Clock.Now().Add(-60*day))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = rwe.PGMain().QueryOneContext(ctx, pg.Scan(&commentID), `
+			INSERT INTO comments (author_id, article_id, body)
+			VALUES (?, ?, 'body')
+			RETURNING id
+		`, userID, articleID)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	run := func() int64 {
+		r, ok := migrate.LookupRetention("hidden_articles")
+		Expect(ok).To(BeTrue())
+
+		n, err := r.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return n
+	}
+
+	It("deletes expired hidden articles", func() {
+		Expect(run()).To(Equal(int64(1)))
+	})
+
+	It("keeps articles with an appealed comment", func() {
+		_, err := rwe.PGMain().ExecContext(ctx, `
+			INSERT INTO appeals (user_id, comment_id, body, created_at) VALUES (?, ?, 'appeal', ?)
+		`, userID, commentID, rwe.Clock.Now().Add(-time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(run()).To(Equal(int64(0)))
+	})
+})
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+// searchIndexes are the trigram indexes created by 5_search_suggest that serve
+// search suggestions. Postgres keeps them up to date with the tables, so there
+// is no indexing lag, but a failed or interrupted build leaves them invalid.
+var searchIndexes = []*migrate.Index{
+	{
+		Name:  "articles_title_trgm_idx",
+		Table: "articles",
+		Using: "gin",
+		Expr:  "title gin_trgm_ops",
+	},
+	{
+		Name:  "article_tags_tag_trgm_idx",
+		Table: "article_tags",
+		Using: "gin",
+		Expr:  "tag gin_trgm_ops",
+	},
+	{
+		Name:  "users_username_trgm_idx",
+		Table: "users",
+		Using: "gin",
+		Expr:  "username gin_trgm_ops",
+	},
+}
+
+// runSearch handles the search command:
+//
+//	migrate_db search verify        reports missing and invalid search indexes
+//	migrate_db search reindex       rebuilds all search indexes without locking writes
+//	migrate_db search reindex NAME  rebuilds the named index
+func runSearch(ctx context.Context, args []string) error {
+	db := rwe.PGMain().WithContext(ctx)
+
+	switch {
+	case len(args) == 1 && args[0] == "verify":
+		return verifySearchIndexes(db)
+	case len(args) >= 1 && len(args) <= 2 && args[0] == "reindex":
+		list := searchIndexes
+		if len(args) == 2 {
+			idx, err := lookupSearchIndex(args[1])
+			if err != nil {
+				return err
+			}
+			list = []*migrate.Index{idx}
+		}
+		return reindexSearch(db, list)
+	}
+	return fmt.Errorf("usage: migrate_db search verify|reindex [NAME]")
+}
+
+func lookupSearchIndex(name string) (*migrate.Index, error) {
+	for _, idx := range searchIndexes {
+		if idx.Name == name {
+			return idx, nil
+		}
+	}
+	return nil, fmt.Errorf("search index %q does not exist", name)
+}
+
+func verifySearchIndexes(db *pg.DB) error {
+	var broken int
+	for _, idx := range searchIndexes {
+		valid, exists, err := migrate.IndexState(db, idx.Name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !exists:
+			broken++
+			fmt.Printf("%s\tmissing\n", idx.Name)
+		case !valid:
+			broken++
+			fmt.Printf("%s\tinvalid\n", idx.Name)
+		default:
+			fmt.Printf("%s\tok\n", idx.Name)
+		}
+	}
+
+	if broken > 0 {
+		return fmt.Errorf("%d search indexes need migrate_db search reindex", broken)
+	}
+	return nil
+}
+
+func reindexSearch(db *pg.DB, list []*migrate.Index) error {
+	for _, idx := range list {
+		if err := migrate.RebuildIndexConcurrently(db, idx); err != nil {
+			return fmt.Errorf("search index %s: %w", idx.Name, err)
+		}
+		fmt.Printf("%s\trebuilt\n", idx.Name)
+	}
+	return nil
+}
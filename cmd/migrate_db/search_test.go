@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	. "github.com/uptrace/go-realworld-example-app/testbed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRunSearchArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{nil, "usage: migrate_db search verify|reindex [NAME]"},
+		{[]string{"verify", "extra"}, "usage: migrate_db search verify|reindex [NAME]"},
+		{[]string{"reindex", "a", "b"}, "usage: migrate_db search verify|reindex [NAME]"},
+		{[]string{"reindex", "missing_idx"}, `search index "missing_idx" does not exist`},
+	}
+
+	for _, test := range tests {
+		err := runSearch(ctx, test.args)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, wanted %q", test.args, err, test.err)
+		}
+	}
+}
+
+var _ = Describe("search reindex", func() {
+	const titleIndex = "articles_title_trgm_idx"
+
+	// searchTitles returns the slugs of articles matching the query and the
+	// plan, which must use the title index.
+	searchTitles := func(query string) ([]string, string) {
+		var slugs []string
+		var plan []string
+		err := rwe.PGMain().RunInTransaction(ctx, func(tx *pg.Tx) error {
+			if _, err := tx.ExecContext(ctx, "SET LOCAL enable_seqscan = off"); err != nil {
+				return err
+			}
+			q := "SELECT slug FROM articles WHERE title ILIKE ?"
+			if _, err := tx.QueryContext(ctx, &slugs, q, "%"+query+"%"); err != nil {
+				return err
+			}
+			_, err := tx.QueryContext(ctx, &plan, "EXPLAIN "+q, "%"+query+"%")
+			return err
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return slugs, strings.Join(plan, "\n")
+	}
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+
+		var userID int64
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&userID), `
+			INSERT INTO users (username, email, password_hash)
+			VALUES ('search', 'search@example.com', '#1')
+			RETURNING id
+		`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = rwe.PGMain().ExecContext(ctx, `
+			INSERT INTO articles (slug, title, description, body, author_id)
+			VALUES ('reindexed', 'Existing article', 'description', 'body', ?)
+		`, userID)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("indexes existing articles", func() {
+		Expect(migrate.DropIndexConcurrently(rwe.PGMain(), titleIndex)).To(Succeed())
+		Expect(verifySearchIndexes(rwe.PGMain())).
+			To(MatchError("1 search indexes need migrate_db search reindex"))
+
+		Expect(runSearch(ctx, []string{"reindex", titleIndex})).To(Succeed())
+		Expect(verifySearchIndexes(rwe.PGMain())).To(Succeed())
+
+		slugs, plan := searchTitles("existing")
+		Expect(slugs).To(Equal([]string{"reindexed"}))
+		Expect(plan).To(ContainSubstring(titleIndex))
+	})
+
+	It("is safe to run twice", func() {
+		Expect(runSearch(ctx, []string{"reindex"})).To(Succeed())
+		Expect(runSearch(ctx, []string{"reindex"})).To(Succeed())
+		Expect(verifySearchIndexes(rwe.PGMain())).To(Succeed())
+
+		for _, idx := range searchIndexes {
+			_, exists, err := migrate.IndexState(rwe.PGMain(), idx.Name+"_rebuild")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(exists).To(BeFalse())
+		}
+
+		slugs, plan := searchTitles("existing")
+		Expect(slugs).To(Equal([]string{"reindexed"}))
+		Expect(plan).To(ContainSubstring(titleIndex))
+	})
+})
@@ -0,0 +1,152 @@
+// Package experiment runs A/B experiments on top of feature flags.
+// Experiments and their variants are registered in code and admins start and
+// stop them at runtime. Users are bucketed by a hash of the experiment name
+// and user id, so they get the same variant on every request and instance.
+package experiment
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-redis/cache/v8"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+// Header lists the variants assigned to the user, e.g. "feed_ranking=engagement".
+const Header = "X-Experiments"
+
+// exposureTTL is how often the exposure of the same user is checked against
+// the database. Only the first exposure is stored.
+const exposureTTL = 24 * time.Hour
+
+var registry = make(map[string][]string)
+
+// Register makes the experiment with the variants available to admins.
+// It must be called from init functions.
+func Register(name string, variants ...string) {
+	if _, ok := registry[name]; ok {
+		panic("experiment: " + name + " is already registered")
+	}
+	registry[name] = variants
+}
+
+func registered() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type Experiment struct {
+	tableName struct{} `pg:"experiments,alias:e"`
+
+	Name string `pg:",pk"`
+	// Variants are the registered variants that users are bucketed into.
+	Variants  []string `pg:",array"`
+	StartedAt time.Time
+	StoppedAt time.Time
+}
+
+func (e *Experiment) Running() bool {
+	return !e.StartedAt.IsZero() && e.StoppedAt.IsZero() && len(e.Variants) > 0
+}
+
+func (e *Experiment) bucket(userID uint64) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Name + ":" + strconv.FormatUint(userID, 10)))
+	return e.Variants[h.Sum32()%uint32(len(e.Variants))]
+}
+
+type Exposure struct {
+	tableName struct{} `pg:"experiment_exposures,alias:ee"`
+
+	Experiment string
+	UserID     uint64
+	Variant    string
+	ExposedAt  time.Time
+}
+
+func experimentKey(name string) string {
+	return "experiment:" + name
+}
+
+// selectExperiment returns the experiment with zero StartedAt if it was never
+// started, so stopped experiments are cached too.
+func selectExperiment(ctx context.Context, name string) (*Experiment, error) {
+	e := new(Experiment)
+	if err := rwe.RedisCache().Once(&cache.Item{
+		Ctx:   ctx,
+		Key:   experimentKey(name),
+		Value: e,
+		TTL:   time.Minute,
+		Do: func(item *cache.Item) (interface{}, error) {
+			return loadExperiment(rwe.DetachedContext(ctx), name)
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func loadExperiment(ctx context.Context, name string) (*Experiment, error) {
+	e := &Experiment{Name: name}
+	if err := rwe.PGMain().ModelContext(ctx, e).WherePK().Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return &Experiment{Name: name}, nil
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+// Assign returns the variant of the running experiment for the user, adds it
+// to the Header of the response, and records the exposure for analysis.
+// It returns false for stopped experiments and logged out users, who should
+// get the default behavior.
+func Assign(
+	ctx context.Context, w http.ResponseWriter, name string, userID uint64,
+) (string, bool, error) {
+	if userID == 0 {
+		return "", false, nil
+	}
+
+	e, err := selectExperiment(ctx, name)
+	if err != nil {
+		return "", false, err
+	}
+	if !e.Running() {
+		return "", false, nil
+	}
+
+	variant := e.bucket(userID)
+	if err := recordExposure(ctx, e, userID, variant); err != nil {
+		return "", false, err
+	}
+
+	w.Header().Add(Header, name+"="+variant)
+	return variant, true, nil
+}
+
+func recordExposure(ctx context.Context, e *Experiment, userID uint64, variant string) error {
+	key := "exposure:" + e.Name + ":" + strconv.FormatInt(e.StartedAt.Unix(), 10) +
+		":" + strconv.FormatUint(userID, 10)
+	fresh, err := rwe.RedisRing().SetNX(ctx, key, 1, exposureTTL).Result()
+	if err != nil || !fresh {
+		return err
+	}
+
+	_, err = rwe.PGMain().ModelContext(ctx, &Exposure{
+		Experiment: e.Name,
+		UserID:     userID,
+		Variant:    variant,
+		ExposedAt:  rwe.Clock.Now(),
+	}).OnConflict("DO NOTHING").Insert()
+	return err
+}
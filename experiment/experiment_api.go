@@ -0,0 +1,196 @@
+package experiment
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/org"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const kb = 10
+
+func init() {
+	g := rwe.API.WithMiddleware(org.UserMiddleware).
+		WithMiddleware(org.MustUserMiddleware).
+		WithMiddleware(org.MustAdminMiddleware)
+
+	g.GET("/admin/experiments", listExperimentsHandler)
+	g.PUT("/admin/experiments/:experiment", startExperimentHandler)
+	g.DELETE("/admin/experiments/:experiment", stopExperimentHandler)
+}
+
+// Status is the experiment as shown to admins. Exposures are the numbers of
+// users that saw each variant since the experiment was started.
+type Status struct {
+	Name      string         `json:"name"`
+	Variants  []string       `json:"variants"`
+	Running   bool           `json:"running"`
+	StartedAt *time.Time     `json:"startedAt"`
+	StoppedAt *time.Time     `json:"stoppedAt"`
+	Exposures map[string]int `json:"exposures"`
+}
+
+func selectStatus(ctx context.Context, name string) (*Status, error) {
+	e, err := loadExperiment(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Name:      name,
+		Variants:  registry[name],
+		Running:   e.Running(),
+		Exposures: make(map[string]int),
+	}
+	if !e.StartedAt.IsZero() {
+		status.Variants = e.Variants
+		status.StartedAt = &e.StartedAt
+	}
+	if !e.StoppedAt.IsZero() {
+		status.StoppedAt = &e.StoppedAt
+	}
+
+	var counts []struct {
+		Variant string
+		Count   int
+	}
+	if err := rwe.PGMain().ModelContext(ctx, (*Exposure)(nil)).
+		ColumnExpr("variant, count(*) AS count").
+		Where("experiment = ?", name).
+		Group("variant").
+		Select(&counts); err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		status.Exposures[c.Variant] = c.Count
+	}
+
+	return status, nil
+}
+
+func listExperimentsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	statuses := make([]*Status, 0, len(registry))
+	for _, name := range registered() {
+		status, err := selectStatus(ctx, name)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"experiments": statuses,
+	})
+}
+
+// startExperimentHandler (re)starts the experiment with the chosen variants
+// or all registered variants. Exposures of the previous run are discarded.
+func startExperimentHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	name := req.Param("experiment")
+	known, ok := registry[name]
+	if !ok {
+		return apperr.New(apperr.NotFound, "experiment %q is not registered", name)
+	}
+
+	var in struct {
+		Experiment *struct {
+			Variants []string `json:"variants"`
+		} `json:"experiment"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	variants := known
+	if in.Experiment != nil && len(in.Experiment.Variants) > 0 {
+		variants = in.Experiment.Variants
+		for _, v := range variants {
+			if !contains(known, v) {
+				return apperr.Validation("variants", "variant %q is not registered", v)
+			}
+		}
+	}
+
+	e := &Experiment{
+		Name:      name,
+		Variants:  variants,
+		StartedAt: rwe.Clock.Now(),
+	}
+
+	if err := rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.ModelContext(ctx, e).
+			OnConflict("(name) DO UPDATE").
+			Set("variants = EXCLUDED.variants").
+			Set("started_at = EXCLUDED.started_at").
+			Set("stopped_at = NULL").
+			Insert(); err != nil {
+			return err
+		}
+
+		_, err := tx.ModelContext(ctx, (*Exposure)(nil)).
+			Where("experiment = ?", name).
+			Delete()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return respondWithStatus(w, req, name)
+}
+
+func stopExperimentHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	name := req.Param("experiment")
+	if _, ok := registry[name]; !ok {
+		return apperr.New(apperr.NotFound, "experiment %q is not registered", name)
+	}
+
+	if _, err := rwe.PGMain().ModelContext(ctx, (*Experiment)(nil)).
+		Set("stopped_at = ?", rwe.Clock.Now()).
+		Where("name = ?", name).
+		Where("stopped_at IS NULL").
+		Update(); err != nil {
+		return err
+	}
+
+	return respondWithStatus(w, req, name)
+}
+
+func respondWithStatus(w http.ResponseWriter, req treemux.Request, name string) error {
+	ctx := req.Context()
+
+	// Other instances pick up the change when their cache expires.
+	if err := rwe.RedisCache().Delete(ctx, experimentKey(name)); err != nil {
+		return err
+	}
+
+	status, err := selectStatus(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"experiment": status,
+	})
+}
+
+func contains(ss []string, s string) bool {
+	for _, el := range ss {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,6 @@
 module github.com/uptrace/go-realworld-example-app
 
-go 1.15
+go 1.16
 
 require (
 	github.com/benbjohnson/clock v1.1.0
@@ -15,9 +15,11 @@ require (
 	github.com/go-redis/redis/v8 v8.6.0
 	github.com/go-redis/redis_rate/v9 v9.1.1
 	github.com/gosimple/slug v1.9.0
+	github.com/klauspost/compress v1.11.7
 	github.com/magefile/mage v1.11.0 // indirect
 	github.com/onsi/ginkgo v1.15.0
 	github.com/onsi/gomega v1.10.5
+	github.com/rivo/uniseg v0.2.0
 	github.com/sirupsen/logrus v1.8.0
 	github.com/uptrace/uptrace-go v0.8.2
 	github.com/vmihailenco/treemux v0.5.3
@@ -25,12 +27,14 @@ require (
 	github.com/vmihailenco/treemux/extra/treemuxgzip v0.5.3
 	github.com/vmihailenco/treemux/extra/treemuxotel v0.5.3
 	go.opentelemetry.io/otel v0.17.0
+	go.opentelemetry.io/otel/metric v0.17.0
 	go.opentelemetry.io/otel/sdk v0.17.0
+	go.opentelemetry.io/otel/trace v0.17.0
 	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 	golang.org/x/exp v0.0.0-20210220032938-85be41e4509f
 	golang.org/x/net v0.0.0-20210222171744-9060382bd457 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.0.0-20210223095934-7937bea0104d // indirect
-	golang.org/x/text v0.3.5 // indirect
+	golang.org/x/text v0.3.5
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,208 @@
+package httputil
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/vmihailenco/treemux"
+)
+
+// compressibleTypes are response content types worth compressing with zstd.
+var compressibleTypes = []string{
+	"application/json",
+	NDJSONContentType,
+	"text/",
+}
+
+var zstdEncoders = sync.Pool{
+	New: func() interface{} {
+		enc, err := zstd.NewWriter(nil,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(1<<20),
+		)
+		if err != nil {
+			panic(err)
+		}
+		return enc
+	},
+}
+
+// ZstdMiddleware compresses responses with zstd when the client accepts it.
+// It must wrap the gzip middleware, which is skipped for such requests so
+// clients that accept both get zstd.
+func ZstdMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		if !acceptsEncoding(req.Header.Get("Accept-Encoding"), "zstd") {
+			return next(w, req)
+		}
+
+		req.Header.Set("Accept-Encoding", "identity")
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		zw := &zstdResponseWriter{ResponseWriter: w}
+		defer zw.Close()
+
+		return next(zw, req)
+	}
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header lists the coding
+// without q=0.
+func acceptsEncoding(header, coding string) bool {
+	for _, s := range strings.Split(header, ",") {
+		params := strings.Split(s, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), coding) {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type zstdResponseWriter struct {
+	http.ResponseWriter
+	enc         *zstd.Encoder
+	wroteHeader bool
+}
+
+var _ http.Flusher = (*zstdResponseWriter)(nil)
+
+func (w *zstdResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if status != http.StatusNoContent &&
+		status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" &&
+		isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", "zstd")
+		h.Del("Content-Length")
+
+		w.enc = zstdEncoders.Get().(*zstd.Encoder)
+		w.enc.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *zstdResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.enc.Write(b)
+}
+
+// Flush sends the data compressed so far, so streamed rows reach the client.
+func (w *zstdResponseWriter) Flush() {
+	if w.enc != nil {
+		_ = w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *zstdResponseWriter) Close() {
+	if w.enc == nil {
+		return
+	}
+	_ = w.enc.Close()
+	w.enc.Reset(nil)
+	zstdEncoders.Put(w.enc)
+	w.enc = nil
+}
+
+func isCompressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+//------------------------------------------------------------------------------
+
+// maxDecoderMemory caps the zstd window so a small body can't make the decoder
+// allocate a lot of memory.
+const maxDecoderMemory = 8 << 20
+
+// DecompressMiddleware accepts request bodies compressed with gzip or zstd as
+// announced in the Content-Encoding header. UnmarshalJSON limits the size of
+// the decompressed body, so compressed bodies can't expand past the limit.
+func DecompressMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		coding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+
+		var body io.ReadCloser
+		switch coding {
+		case "", "identity":
+			return next(w, req)
+		case "gzip":
+			zr, err := gzip.NewReader(req.Body)
+			if err != nil {
+				return apperr.Validation("", "gzip request body is malformed: %s", err)
+			}
+			body = zr
+		case "zstd":
+			zr, err := zstd.NewReader(req.Body,
+				zstd.WithDecoderConcurrency(1),
+				zstd.WithDecoderMaxMemory(maxDecoderMemory),
+			)
+			if err != nil {
+				return err
+			}
+			body = zr.IOReadCloser()
+		default:
+			return apperr.New(apperr.UnsupportedEncoding,
+				"Content-Encoding %q is not supported, use gzip or zstd", coding)
+		}
+		defer body.Close()
+
+		req.Header.Del("Content-Encoding")
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		req.Body = decompressReader{ReadCloser: body, coding: coding}
+
+		return next(w, req)
+	}
+}
+
+// decompressReader reports corrupted data as a validation error instead of
+// an internal one.
+type decompressReader struct {
+	io.ReadCloser
+	coding string
+}
+
+func (r decompressReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if err != nil && err != io.EOF {
+		err = apperr.Validation("", "%s request body is malformed: %s", r.coding, err)
+	}
+	return n, err
+}
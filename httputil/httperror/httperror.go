@@ -2,19 +2,46 @@ package httperror
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
 )
 
 var (
-	errEOF      = BadRequest("eof", "EOF reading HTTP request body")
-	ErrNotFound = NotFound("not found")
-	ErrInternal = New(http.StatusInternalServerError, "internal", "internal server error")
+	errEOF      = New(http.StatusBadRequest, apperr.ValidationFailed, "EOF reading HTTP request body")
+	ErrNotFound = New(http.StatusNotFound, apperr.NotFound, "not found")
+	ErrInternal = New(http.StatusInternalServerError, apperr.Internal, "internal server error")
 )
 
+// statuses maps error codes to HTTP statuses. Codes missing here are
+// reported as 500 Internal Server Error.
+var statuses = map[apperr.Code]int{
+	apperr.NotFound:         http.StatusNotFound,
+	apperr.ValidationFailed: http.StatusBadRequest,
+	apperr.RequestTooLarge:  http.StatusRequestEntityTooLarge,
+	apperr.Unauthorized:     http.StatusUnauthorized,
+	apperr.Forbidden:        http.StatusForbidden,
+	apperr.RateLimited:      http.StatusTooManyRequests,
+	apperr.ReadOnly:         http.StatusForbidden,
+	apperr.Overloaded:       http.StatusServiceUnavailable,
+
+	apperr.UnsupportedEncoding: http.StatusUnsupportedMediaType,
+
+	apperr.UserNotFound:  http.StatusUnprocessableEntity,
+	apperr.EmailTaken:    http.StatusConflict,
+	apperr.UsernameTaken: http.StatusConflict,
+
+	apperr.ArticleForbidden: http.StatusForbidden,
+	apperr.InvalidTag:       http.StatusUnprocessableEntity,
+	apperr.TooManyTags:      http.StatusUnprocessableEntity,
+	apperr.CommentsDisabled: http.StatusForbidden,
+	apperr.LegalHold:        http.StatusConflict,
+}
+
 func From(err error) Error {
 	switch err {
 	case io.EOF:
@@ -23,33 +50,40 @@ func From(err error) Error {
 		return ErrNotFound
 	}
 
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		status, ok := statuses[appErr.Code]
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		return Error{
+			Status:  status,
+			Code:    appErr.Code,
+			Message: appErr.Message,
+			Field:   appErr.Field,
+		}
+	}
+
 	switch err := err.(type) {
 	case Error:
 		return err
 	case *json.SyntaxError:
-		return BadRequest("json_syntax", err.Error())
+		return From(apperr.Validation("", err.Error()))
 	}
 
 	return ErrInternal
 }
 
-func NotFound(msg string, args ...interface{}) Error {
-	return New(http.StatusNotFound, "not_found", msg, args...)
-}
-
-func BadRequest(code, msg string, args ...interface{}) Error {
-	return New(http.StatusBadRequest, code, msg, args...)
-}
-
 //------------------------------------------------------------------------------
 
 type Error struct {
-	Status  int    `json:"status"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Status  int         `json:"status"`
+	Code    apperr.Code `json:"code"`
+	Message string      `json:"message"`
+	Field   string      `json:"field,omitempty"`
 }
 
-func New(status int, code, msg string, args ...interface{}) Error {
+func New(status int, code apperr.Code, msg string, args ...interface{}) Error {
 	if len(args) > 0 {
 		msg = fmt.Sprintf(msg, args...)
 	}
@@ -1,9 +1,14 @@
 package httputil
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/vmihailenco/treemux"
 )
 
@@ -14,7 +19,48 @@ func UnmarshalJSON(
 	maxBytes int64,
 ) error {
 	req.Body = http.MaxBytesReader(w, req.Body, maxBytes)
-	dec := json.NewDecoder(req.Body)
+
+	var r io.Reader = req.Body
+	if jsonOptions.SnakeCase {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return decodeError(err)
+		}
+		if len(b) != 0 {
+			b, err = decodeSnakeCase(b, dst)
+			if err != nil {
+				return decodeError(err)
+			}
+		}
+		r = bytes.NewReader(b)
+	}
+
+	dec := json.NewDecoder(r)
 	dec.DisallowUnknownFields()
-	return dec.Decode(dst)
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
+
+// decodeError reports malformed input with error codes.
+func decodeError(err error) error {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		return apperr.Validation("", "JSON is malformed: %s", err)
+	case *json.UnmarshalTypeError:
+		return apperr.Validation(err.Field, "JSON field %q must be %s", err.Field, err.Type)
+	}
+
+	msg := err.Error()
+	switch {
+	case err == io.EOF:
+		return err
+	case strings.HasPrefix(msg, "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`)
+		return apperr.Validation(field, "JSON field %q is not supported", field)
+	case msg == "http: request body too large":
+		return apperr.New(apperr.RequestTooLarge, "request body is too large")
+	}
+	return err
 }
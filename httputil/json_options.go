@@ -0,0 +1,344 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/vmihailenco/treemux"
+)
+
+// JSONOptions control the JSON accepted and returned by the API. Handlers
+// always work with camelCase field names from struct tags and the options are
+// applied on top of that.
+type JSONOptions struct {
+	// SnakeCase renames fields to snake_case in responses and accepts
+	// snake_case fields in requests.
+	SnakeCase bool
+	// OmitNulls removes object fields with null values from responses.
+	OmitNulls bool
+}
+
+func (o JSONOptions) enabled() bool {
+	return o.SnakeCase || o.OmitNulls
+}
+
+var jsonOptions JSONOptions
+
+// SetJSONOptions must be called before serving requests.
+func SetJSONOptions(opt JSONOptions) {
+	jsonOptions = opt
+}
+
+// JSON is like treemux.JSON, but applies the JSON options. Handlers must use it
+// instead of treemux.JSON, because the options depend on the type of the
+// value, see transform.
+func JSON(w http.ResponseWriter, value interface{}) error {
+	if !jsonOptions.enabled() {
+		return treemux.JSON(w, value)
+	}
+	if value == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	b, err = jsonOptions.rewrite(b, value)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// JSONStatus is JSON with a status other than 200, e.g. 202 for work that
+// continues in the background.
+func JSONStatus(w http.ResponseWriter, status int, value interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return JSON(w, value)
+}
+
+// rewrite applies the options to b, which is the encoded value.
+func (o JSONOptions) rewrite(b []byte, value interface{}) ([]byte, error) {
+	v, err := decodeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v = o.transform(v, reflect.ValueOf(value))
+	return json.Marshal(v)
+}
+
+// transform renames object keys and drops nulls recursively. Only keys that
+// come from struct tags and treemux.H are changed. Other maps, like article
+// metadata, are user data and their keys and nulls are kept as is.
+func (o JSONOptions) transform(v interface{}, rv reflect.Value) interface{} {
+	rv = indirectValue(rv)
+	if !rv.IsValid() || isJSONMarshaler(rv.Type()) {
+		return v
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch {
+		case rv.Kind() == reflect.Struct:
+			fields := jsonFields(rv.Type())
+			m := make(map[string]interface{}, len(v))
+			for key, value := range v {
+				index, ok := fields[key]
+				if !ok {
+					m[key] = value
+					continue
+				}
+				if value == nil && o.OmitNulls {
+					continue
+				}
+				m[o.rename(key)] = o.transform(value, fieldByIndex(rv, index))
+			}
+			return m
+		case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+			envelope := rv.Type() == hType
+			m := make(map[string]interface{}, len(v))
+			for key, value := range v {
+				el := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+				if !envelope {
+					m[key] = o.transform(value, el)
+					continue
+				}
+				if value == nil && o.OmitNulls {
+					continue
+				}
+				m[o.rename(key)] = o.transform(value, el)
+			}
+			return m
+		}
+	case []interface{}:
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			for i, el := range v {
+				if i < rv.Len() {
+					v[i] = o.transform(el, rv.Index(i))
+				}
+			}
+		}
+	}
+	return v
+}
+
+func (o JSONOptions) rename(key string) string {
+	if o.SnakeCase {
+		return camelToSnake(key)
+	}
+	return key
+}
+
+// decodeSnakeCase converts snake_case request fields of dst to camelCase,
+// keeping the keys of maps, e.g. article metadata.
+func decodeSnakeCase(b []byte, dst interface{}) ([]byte, error) {
+	v, err := decodeJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v = decodeSnakeCaseType(v, reflect.TypeOf(dst))
+	return json.Marshal(v)
+}
+
+func decodeSnakeCaseType(v interface{}, typ reflect.Type) interface{} {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || reflect.PtrTo(typ).Implements(unmarshalerType) {
+		return v
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch typ.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(typ)
+			m := make(map[string]interface{}, len(v))
+			for key, value := range v {
+				name := key
+				if _, ok := fields[name]; !ok {
+					name = snakeToCamel(key)
+				}
+				index, ok := fields[name]
+				if !ok {
+					// Left for DisallowUnknownFields to report.
+					m[key] = value
+					continue
+				}
+				m[name] = decodeSnakeCaseType(value, typ.FieldByIndex(index).Type)
+			}
+			return m
+		case reflect.Map:
+			for key, value := range v {
+				v[key] = decodeSnakeCaseType(value, typ.Elem())
+			}
+		}
+	case []interface{}:
+		if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+			for i, el := range v {
+				v[i] = decodeSnakeCaseType(el, typ.Elem())
+			}
+		}
+	}
+	return v
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+//------------------------------------------------------------------------------
+
+var (
+	hType           = reflect.TypeOf(treemux.H(nil))
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textType        = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func isJSONMarshaler(typ reflect.Type) bool {
+	ptr := reflect.PtrTo(typ)
+	return typ.Implements(marshalerType) || ptr.Implements(marshalerType) ||
+		typ.Implements(textType) || ptr.Implements(textType)
+}
+
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but returns the zero value
+// for fields of nil embedded structs.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			v = indirectValue(v)
+			if !v.IsValid() {
+				return v
+			}
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var jsonFieldsCache sync.Map
+
+// jsonFields returns the indexes of struct fields by their JSON names,
+// including the fields of embedded structs like encoding/json does.
+func jsonFields(typ reflect.Type) map[string][]int {
+	if v, ok := jsonFieldsCache.Load(typ); ok {
+		return v.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	collectJSONFields(fields, typ, nil)
+	jsonFieldsCache.Store(typ, fields)
+	return fields
+}
+
+func collectJSONFields(fields map[string][]int, typ reflect.Type, index []int) {
+	var embedded []reflect.StructField
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := tag
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name = tag[:i]
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, f)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := fields[name]; !ok {
+			fields[name] = append(append([]int(nil), index...), i)
+		}
+	}
+
+	// Fields of embedded structs are shadowed by the outer fields.
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		collectJSONFields(fields, ft, append(append([]int(nil), index...), f.Index...))
+	}
+}
+
+func camelToSnake(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 4)
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func snakeToCamel(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	upper := false
+	for _, r := range s {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
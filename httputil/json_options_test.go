@@ -0,0 +1,82 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/treemux"
+)
+
+type testAuthor struct {
+	Username string `json:"username"`
+}
+
+type testArticle struct {
+	*testAuthor
+	TagList   []string               `json:"tagList"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Comment   *testAuthor            `json:"latestComment"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+func TestSnakeCaseMetadata(t *testing.T) {
+	SetJSONOptions(JSONOptions{SnakeCase: true, OmitNulls: true})
+	defer SetJSONOptions(JSONOptions{})
+
+	var in struct {
+		Article *testArticle `json:"article"`
+	}
+	body := `{"article": {"tag_list": ["go"], "metadata": {"release_date": "2020", "camelKey": null}}}`
+	b, err := decodeSnakeCase([]byte(body), &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &in); err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := map[string]interface{}{"release_date": "2020", "camelKey": nil}
+	if !reflect.DeepEqual(in.Article.Metadata, wanted) {
+		t.Fatalf("got metadata %v, wanted %v", in.Article.Metadata, wanted)
+	}
+	if !reflect.DeepEqual(in.Article.TagList, []string{"go"}) {
+		t.Fatalf("got tags %v", in.Article.TagList)
+	}
+
+	in.Article.testAuthor = &testAuthor{Username: "john"}
+	resp := httptest.NewRecorder()
+	if err := JSON(resp, treemux.H{
+		"article":       in.Article,
+		"articlesCount": 1,
+		"budgets":       map[string]*testAuthor{"GET /api/articles": {Username: "x"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	article := out["article"].(map[string]interface{})
+	if !reflect.DeepEqual(article["metadata"], wanted) {
+		t.Fatalf("got metadata %v, wanted %v", article["metadata"], wanted)
+	}
+	for _, key := range []string{"username", "tag_list", "created_at"} {
+		if _, ok := article[key]; !ok {
+			t.Fatalf("article has no %s: %v", key, article)
+		}
+	}
+	if _, ok := article["latest_comment"]; ok {
+		t.Fatal("null latest_comment is not omitted")
+	}
+	if _, ok := out["articles_count"]; !ok {
+		t.Fatalf("response has no articles_count: %v", out)
+	}
+	if _, ok := out["budgets"].(map[string]interface{})["GET /api/articles"]; !ok {
+		t.Fatalf("map key is renamed: %v", out["budgets"])
+	}
+}
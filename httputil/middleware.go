@@ -14,6 +14,11 @@ type PanicHandler struct {
 func (h PanicHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	defer func() {
 		if err := recover(); err != nil {
+			if err == http.ErrAbortHandler {
+				// Let net/http abort the response and close the connection.
+				panic(err)
+			}
+
 			buf := make([]byte, 1<<20)
 			n := runtime.Stack(buf, true)
 			fmt.Fprintf(os.Stderr, "panic: %v\n\n%s", err, buf[:n])
@@ -0,0 +1,89 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/xcontext"
+	"github.com/vmihailenco/treemux"
+)
+
+const NDJSONContentType = "application/x-ndjson"
+
+// FormatQuery validates the format param of endpoints that can stream.
+var FormatQuery = Query{
+	"format": OneOf("json", "ndjson"),
+}
+
+// WantsNDJSON reports whether the client asked for newline delimited JSON with
+// ?format=ndjson.
+func WantsNDJSON(req treemux.Request) bool {
+	return req.URL.Query().Get("format") == "ndjson"
+}
+
+var flusherKey = xcontext.NewKey("flusher")
+
+// FlushMiddleware remembers the flusher of the response writer because other
+// middlewares, e.g. reqlog, wrap the writer without implementing http.Flusher.
+// It must be placed right after the compression middleware, which flushes the
+// compressed data too.
+func FlushMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		if f, ok := w.(http.Flusher); ok {
+			req = req.WithContext(flusherKey.With(req.Context(), f))
+		}
+		return next(w, req)
+	}
+}
+
+// NDJSONWriter streams a list one row per line so handlers don't buffer whole
+// datasets in memory. Every row is flushed, so writes block while the client
+// is slow to read and the handler stops reading rows from the database.
+//
+// Headers are sent with the first row. Errors after that can't change the
+// status and are reported as the last line by the error handler.
+type NDJSONWriter struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	flusher http.Flusher
+	buf     bytes.Buffer
+}
+
+func NewNDJSONWriter(w http.ResponseWriter, req treemux.Request) *NDJSONWriter {
+	w.Header().Set("Content-Type", NDJSONContentType)
+	flusher, _ := flusherKey.Value(req.Context()).(http.Flusher)
+	return &NDJSONWriter{
+		ctx:     req.Context(),
+		w:       w,
+		flusher: flusher,
+	}
+}
+
+// Encode writes the row and flushes it. It fails once the client goes away.
+func (w *NDJSONWriter) Encode(v interface{}) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	w.buf.Reset()
+	if err := json.NewEncoder(&w.buf).Encode(v); err != nil {
+		return err
+	}
+
+	b := w.buf.Bytes()
+	if jsonOptions.enabled() {
+		if rewritten, err := jsonOptions.rewrite(b, v); err == nil {
+			b = append(rewritten, '\n')
+		}
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return nil
+}
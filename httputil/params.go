@@ -0,0 +1,134 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/vmihailenco/treemux"
+)
+
+// Validator checks a single route or query param value.
+type Validator func(value string) error
+
+var slugRe = regexp.MustCompile(`^[a-z0-9-]{1,500}$`)
+
+// Slug accepts slugs generated for article titles.
+func Slug(value string) error {
+	if !slugRe.MatchString(value) {
+		return fmt.Errorf("must be a slug of lowercase letters, digits, and dashes")
+	}
+	return nil
+}
+
+// ID accepts positive integer ids.
+func ID(value string) error {
+	if n, err := strconv.ParseUint(value, 10, 64); err != nil || n == 0 {
+		return fmt.Errorf("must be a positive integer")
+	}
+	return nil
+}
+
+// Name accepts user chosen names such as usernames and tags.
+func Name(value string) error {
+	if value == "" || len(value) > 500 {
+		return fmt.Errorf("must be from 1 to 500 bytes long")
+	}
+	if strings.IndexFunc(value, unicode.IsControl) != -1 {
+		return fmt.Errorf("must not contain control characters")
+	}
+	return nil
+}
+
+var tokenRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+// Token accepts opaque URL safe tokens.
+func Token(value string) error {
+	if !tokenRe.MatchString(value) {
+		return fmt.Errorf("must be a token")
+	}
+	return nil
+}
+
+// IntRange accepts integers in the range [min, max].
+func IntRange(min, max int) Validator {
+	return func(value string) error {
+		if n, err := strconv.Atoi(value); err != nil || n < min || n > max {
+			return fmt.Errorf("must be an integer in range [%d, %d]", min, max)
+		}
+		return nil
+	}
+}
+
+// OneOf accepts only the listed values.
+func OneOf(values ...string) Validator {
+	return func(value string) error {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
+
+func reportParam(name string, err error) error {
+	return apperr.Validation(name, "%s %s", name, err)
+}
+
+//------------------------------------------------------------------------------
+
+// RouteParams maps route param names to validators. Routes name their params
+// consistently, so :slug is always an article slug and :id is always an id.
+type RouteParams map[string]Validator
+
+// Middleware rejects requests with invalid route params before the handler runs.
+func (rules RouteParams) Middleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		for _, param := range req.Params {
+			validate, ok := rules[param.Name]
+			if !ok {
+				continue
+			}
+			if err := validate(param.Value); err != nil {
+				return reportParam(param.Name, err)
+			}
+		}
+		return next(w, req)
+	}
+}
+
+// Query maps query param names of an endpoint to validators. Missing or empty
+// params are not validated so handlers can apply defaults.
+type Query map[string]Validator
+
+// Middleware rejects requests with invalid query params before the handler runs.
+func (rules Query) Middleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		query := req.URL.Query()
+		for name, validate := range rules {
+			value := query.Get(name)
+			if value == "" {
+				continue
+			}
+			if err := validate(value); err != nil {
+				return reportParam(name, err)
+			}
+		}
+		return next(w, req)
+	}
+}
+
+// QueryInt returns the query param as an integer or the default when the param
+// is missing. The param must be validated with IntRange.
+func QueryInt(req treemux.Request, name string, defaultValue int) int {
+	n, err := strconv.Atoi(req.URL.Query().Get(name))
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
@@ -0,0 +1,255 @@
+// Package jsonschema validates decoded JSON values against a subset of JSON
+// Schema: type, enum, properties, required, additionalProperties, items,
+// minLength, maxLength, pattern, minimum, maximum, and maxItems.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type Schema struct {
+	Type types         `json:"type"`
+	Enum []interface{} `json:"enum"`
+
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+
+	Items    *Schema `json:"items"`
+	MaxItems *int    `json:"maxItems"`
+
+	MinLength *int   `json:"minLength"`
+	MaxLength *int   `json:"maxLength"`
+	Pattern   string `json:"pattern"`
+
+	Minimum *float64 `json:"minimum"`
+	Maximum *float64 `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+// Parse parses the schema and compiles its patterns.
+func Parse(b []byte) (*Schema, error) {
+	s := new(Schema)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("jsonschema: %w", err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load parses the schema file.
+func Load(path string) (*Schema, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("jsonschema: %w", err)
+		}
+		s.pattern = re
+	}
+
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		if err := s.AdditionalProperties.Schema.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// types is a single type name or a list of them.
+type types []string
+
+func (t *types) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = types{name}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(t))
+}
+
+// additional is either a boolean or a schema for properties that are not
+// listed in properties.
+type additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *additional) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(b, &a.Schema)
+}
+
+//------------------------------------------------------------------------------
+
+// Error reports the first value that doesn't match the schema. Path is the
+// dotted path of the value, e.g. metadata.links[0].
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Path + " " + e.Message
+}
+
+// Validate checks the value decoded with encoding/json. Path names the
+// value in errors.
+func (s *Schema) Validate(path string, v interface{}) error {
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		return errorf(path, "must be %s", strings.Join(s.Type, " or "))
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return errorf(path, "must be one of the allowed values")
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return errorf(path, "must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return errorf(path, "must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return errorf(path, "must match %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return errorf(path, "must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return errorf(path, "must be at most %v", *s.Maximum)
+		}
+	case []interface{}:
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return errorf(path, "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.Validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		return s.validateObject(path, v)
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(path string, m map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := m[name]; !ok {
+			return errorf(path+"."+name, "is required")
+		}
+	}
+
+	// Sort keys so the same input always reports the same error.
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		prop := s.Properties[key]
+		if prop == nil && s.AdditionalProperties != nil {
+			if !s.AdditionalProperties.Allowed {
+				return errorf(path+"."+key, "is not allowed")
+			}
+			prop = s.AdditionalProperties.Schema
+		}
+		if prop == nil {
+			continue
+		}
+		if err := prop.Validate(path+"."+key, m[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	for _, typ := range s.Type {
+		switch typ {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == float64(int64(f)) {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Schema) inEnum(v interface{}) bool {
+	for _, allowed := range s.Enum {
+		if reflect.DeepEqual(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func errorf(path, msg string, args ...interface{}) *Error {
+	return &Error{
+		Path:    path,
+		Message: fmt.Sprintf(msg, args...),
+	}
+}
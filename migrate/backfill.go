@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const defaultBatchSize = 1000
+
+// Backfill updates existing rows of a large table in small batches ordered by
+// id so no statement holds row locks for long. Progress is stored in the
+// backfills table and an interrupted backfill continues where it stopped.
+type Backfill struct {
+	Name  string
+	Table string // table with an int8 id primary key
+	Set   string // SET clause, e.g. "favorites_count = (SELECT ...)"
+	Where string // optional condition for rows that need the update
+
+	BatchSize int
+	Pause     time.Duration // wait between batches to let replicas catch up
+}
+
+type BackfillProgress struct {
+	tableName struct{} `pg:"backfills,alias:b"`
+
+	Name        string `pg:",pk"`
+	LastID      int64  `pg:",use_zero"`
+	MaxID       int64  `pg:",use_zero"`
+	RowsUpdated int64  `pg:",use_zero"`
+
+	StartedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt time.Time
+}
+
+func (p *BackfillProgress) Percent() float64 {
+	if p.MaxID == 0 {
+		return 100
+	}
+	return 100 * float64(p.LastID) / float64(p.MaxID)
+}
+
+var backfills = make(map[string]*Backfill)
+
+// RegisterBackfill makes the backfill available to the migrate_db backfill
+// command.
+func RegisterBackfill(b *Backfill) {
+	if _, ok := backfills[b.Name]; ok {
+		panic(fmt.Errorf("backfill %q is already registered", b.Name))
+	}
+	backfills[b.Name] = b
+}
+
+func Backfills() []*Backfill {
+	list := make([]*Backfill, 0, len(backfills))
+	for _, b := range backfills {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func LookupBackfill(name string) (*Backfill, bool) {
+	b, ok := backfills[name]
+	return b, ok
+}
+
+func SelectBackfillProgress(ctx context.Context, name string) (*BackfillProgress, error) {
+	p := &BackfillProgress{Name: name}
+	if err := rwe.PGMain().ModelContext(ctx, p).WherePK().Select(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run processes remaining batches. Rows inserted after the backfill started
+// are not visited and must be written by the application, see DualWrite.
+func (b *Backfill) Run(ctx context.Context) error {
+	p, err := b.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	batchSize := b.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+
+	for p.FinishedAt.IsZero() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		endID := p.LastID + int64(batchSize)
+		n, err := b.runBatch(ctx, p.LastID, endID)
+		if err != nil {
+			return err
+		}
+
+		p.LastID = endID
+		p.RowsUpdated += int64(n)
+		p.UpdatedAt = rwe.Clock.Now()
+		if p.LastID >= p.MaxID {
+			p.LastID = p.MaxID
+			p.FinishedAt = p.UpdatedAt
+		}
+
+		if _, err := rwe.PGMain().ModelContext(ctx, p).WherePK().Update(); err != nil {
+			return err
+		}
+
+		logrus.WithContext(ctx).Infof("backfill %s: %d rows updated, %.1f%% done",
+			b.Name, p.RowsUpdated, p.Percent())
+
+		if b.Pause > 0 && p.FinishedAt.IsZero() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(b.Pause):
+			}
+		}
+	}
+
+	return nil
+}
+
+// start loads the saved progress or records the id range for a new backfill.
+func (b *Backfill) start(ctx context.Context) (*BackfillProgress, error) {
+	p, err := SelectBackfillProgress(ctx, b.Name)
+	if err == nil {
+		return p, nil
+	}
+	if err != pg.ErrNoRows {
+		return nil, err
+	}
+
+	p = &BackfillProgress{
+		Name:      b.Name,
+		StartedAt: rwe.Clock.Now(),
+		UpdatedAt: rwe.Clock.Now(),
+	}
+	if _, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&p.LastID, &p.MaxID),
+		"SELECT coalesce(min(id) - 1, 0), coalesce(max(id), 0) FROM ?", pg.Ident(b.Table)); err != nil {
+		return nil, err
+	}
+	if p.MaxID == 0 {
+		p.FinishedAt = p.StartedAt
+	}
+
+	if _, err := rwe.PGMain().ModelContext(ctx, p).Insert(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (b *Backfill) runBatch(ctx context.Context, startID, endID int64) (int, error) {
+	q := "UPDATE ? SET ? WHERE id > ? AND id <= ?"
+	args := []interface{}{pg.Ident(b.Table), pg.Safe(b.Set), startID, endID}
+	if b.Where != "" {
+		q += " AND (?)"
+		args = append(args, pg.Safe(b.Where))
+	}
+
+	res, err := rwe.PGMain().ExecContext(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// Reset deletes the saved progress so the next Run starts from the beginning.
+func (b *Backfill) Reset(ctx context.Context) error {
+	_, err := rwe.PGMain().ModelContext(ctx, &BackfillProgress{Name: b.Name}).
+		WherePK().
+		Delete()
+	return err
+}
@@ -0,0 +1,85 @@
+package migrate_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	. "github.com/uptrace/go-realworld-example-app/testbed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backfill", func() {
+	var ids []int64
+	var backfill *migrate.Backfill
+
+	selectUpdated := func() []int64 {
+		var updated []int64
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(pg.Array(&updated)), `
+			SELECT coalesce(array_agg(id ORDER BY id), '{}') FROM articles WHERE description = 'backfilled'
+		`)
+		Expect(err).NotTo(HaveOccurred())
+		return updated
+	}
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+
+		ids = insertArticles(5)
+		backfill = &migrate.Backfill{
+			Name:      "test_description",
+			Table:     "articles",
+			Set:       "description = 'backfilled'",
+			BatchSize: 2,
+		}
+	})
+
+	It("updates rows in batches", func() {
+		Expect(backfill.Run(ctx)).To(Succeed())
+		Expect(selectUpdated()).To(Equal(ids))
+
+		p, err := migrate.SelectBackfillProgress(ctx, backfill.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.MaxID).To(Equal(ids[4]))
+		Expect(p.LastID).To(Equal(p.MaxID))
+		Expect(p.RowsUpdated).To(Equal(int64(5)))
+		Expect(p.FinishedAt.IsZero()).To(BeFalse())
+	})
+
+	It("resumes where it stopped", func() {
+		_, err := rwe.PGMain().ModelContext(ctx, &migrate.BackfillProgress{
+			Name:        backfill.Name,
+			LastID:      ids[2],
+			MaxID:       ids[4],
+			RowsUpdated: 3,
+			StartedAt:   rwe.Clock.Now(),
+			UpdatedAt:   rwe.Clock.Now(),
+		}).Insert()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(backfill.Run(ctx)).To(Succeed())
+		Expect(selectUpdated()).To(Equal(ids[3:]))
+
+		p, err := migrate.SelectBackfillProgress(ctx, backfill.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.RowsUpdated).To(Equal(int64(5)))
+	})
+
+	It("stops during the pause when the context is canceled", func() {
+		backfill.Pause = time.Hour
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		err := backfill.Run(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(selectUpdated()).To(Equal(ids[:2]))
+
+		Expect(backfill.Run(context.Background())).To(Succeed())
+		Expect(selectUpdated()).To(Equal(ids))
+	})
+})
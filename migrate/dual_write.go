@@ -0,0 +1,23 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+// DualWrite runs write and, while the feature flag is on, shadow in the same
+// transaction. It keeps the old and the new schema in sync while a backfill
+// copies existing rows, so reads can be switched over once the backfill is done.
+func DualWrite(ctx context.Context, flag string, write, shadow func(tx *pg.Tx) error) error {
+	return rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+		if !rwe.FeatureEnabled(flag) {
+			return nil
+		}
+		return shadow(tx)
+	})
+}
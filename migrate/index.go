@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"github.com/go-pg/migrations/v8"
+	"github.com/go-pg/pg/v10"
+)
+
+// Index describes an index that is built without blocking writes.
+type Index struct {
+	Name   string
+	Table  string
+	Expr   string // indexed columns or expressions, e.g. "author_id, created_at"
+	Unique bool
+	Using  string // optional index method, e.g. "gin"
+	Where  string // optional predicate of a partial index
+}
+
+// CreateIndexConcurrently builds the index with CREATE INDEX CONCURRENTLY. A
+// failed concurrent build leaves an invalid index behind, so it is dropped and
+// built again. It can't be used in a transactional migration.
+func CreateIndexConcurrently(db migrations.DB, idx *Index) error {
+	valid, exists, err := IndexState(db, idx.Name)
+	if err != nil {
+		return err
+	}
+	if exists && valid {
+		return nil
+	}
+	if exists {
+		if err := DropIndexConcurrently(db, idx.Name); err != nil {
+			return err
+		}
+	}
+
+	q := "CREATE INDEX CONCURRENTLY ?name ON ?table"
+	if idx.Unique {
+		q = "CREATE UNIQUE INDEX CONCURRENTLY ?name ON ?table"
+	}
+	if idx.Using != "" {
+		q += " USING ?using"
+	}
+	q += " (?expr)"
+	if idx.Where != "" {
+		q += " WHERE ?where"
+	}
+
+	_, err = db.Exec(q, &indexParams{
+		Name:  pg.Ident(idx.Name),
+		Table: pg.Ident(idx.Table),
+		Using: pg.Safe(idx.Using),
+		Expr:  pg.Safe(idx.Expr),
+		Where: pg.Safe(idx.Where),
+	})
+	return err
+}
+
+type indexParams struct {
+	Name  pg.Ident
+	Table pg.Ident
+	Using pg.Safe
+	Expr  pg.Safe
+	Where pg.Safe
+}
+
+// RebuildIndexConcurrently builds a fresh copy of the index next to the old one
+// and swaps them, so queries can use an index during the whole rebuild.
+func RebuildIndexConcurrently(db migrations.DB, idx *Index) error {
+	tmp := *idx
+	tmp.Name = idx.Name + "_rebuild"
+
+	if err := CreateIndexConcurrently(db, &tmp); err != nil {
+		return err
+	}
+	if err := DropIndexConcurrently(db, idx.Name); err != nil {
+		return err
+	}
+	_, err := db.Exec("ALTER INDEX ? RENAME TO ?", pg.Ident(tmp.Name), pg.Ident(idx.Name))
+	return err
+}
+
+func DropIndexConcurrently(db migrations.DB, name string) error {
+	_, err := db.Exec("DROP INDEX CONCURRENTLY IF EXISTS ?", pg.Ident(name))
+	return err
+}
+
+// IndexState reports whether the index exists and is valid, i.e. its build
+// did not fail halfway.
+func IndexState(db migrations.DB, name string) (valid, exists bool, _ error) {
+	if _, err := db.QueryOne(pg.Scan(&valid), `
+		SELECT i.indisvalid FROM pg_index AS i
+		JOIN pg_class AS c ON c.oid = i.indexrelid
+		WHERE c.relname = ? AND pg_table_is_visible(c.oid)
+	`, name); err != nil {
+		if err == pg.ErrNoRows {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return valid, true, nil
+}
@@ -0,0 +1,54 @@
+package migrate_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/xconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMigrate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "migrate")
+}
+
+var ctx context.Context
+
+func init() {
+	ctx = context.Background()
+
+	cfg, err := xconfig.LoadConfig("test")
+	if err != nil {
+		panic(err)
+	}
+
+	ctx = rwe.Init(ctx, cfg)
+}
+
+// insertArticles inserts n articles of a new user and returns their ids.
+func insertArticles(n int) []int64 {
+	var userID int64
+	_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&userID), `
+		INSERT INTO users (username, email, password_hash)
+		VALUES ('migrate', 'migrate@example.com', '#1')
+		RETURNING id
+	`)
+	Expect(err).NotTo(HaveOccurred())
+
+	ids := make([]int64, n)
+	for i := range ids {
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(&ids[i]), `
+			INSERT INTO articles (slug, title, description, body, author_id)
+			VALUES (?, 'title', 'description', 'body', ?)
+			RETURNING id
+		`, fmt.Sprintf("article-%d", i), userID)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	return ids
+}
@@ -0,0 +1,129 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+)
+
+var retentionDeleted = metric.Must(global.Meter("github.com/uptrace/go-treemux-realworld-example-app")).
+	NewInt64Counter("retention.rows_deleted",
+		metric.WithDescription("Expired rows deleted by the retention policy"))
+
+// Retention deletes rows of a table that are older than TTL in small batches
+// so the database does not grow unbounded. It is run periodically, for example,
+// by cron, with the migrate_db purge command.
+type Retention struct {
+	Name   string
+	Table  string // table with an int8 id primary key
+	Column string // timestamp column compared with TTL, e.g. created_at
+	Where  string // optional condition for rows that may be deleted
+
+	// TTL is the default retention period. It can be changed with the
+	// retention section of the config.
+	TTL       time.Duration
+	BatchSize int
+	Pause     time.Duration
+}
+
+var retentions = make(map[string]*Retention)
+
+func RegisterRetention(r *Retention) {
+	if _, ok := retentions[r.Name]; ok {
+		panic(fmt.Errorf("retention %q is already registered", r.Name))
+	}
+	retentions[r.Name] = r
+}
+
+func Retentions() []*Retention {
+	list := make([]*Retention, 0, len(retentions))
+	for _, r := range retentions {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func LookupRetention(name string) (*Retention, bool) {
+	r, ok := retentions[name]
+	return r, ok
+}
+
+// Period returns the configured retention period.
+func (r *Retention) Period() time.Duration {
+	if d, ok := rwe.Config.Retention[r.Name]; ok && d > 0 {
+		return d
+	}
+	return r.TTL
+}
+
+// Run deletes expired rows and returns their number.
+func (r *Retention) Run(ctx context.Context) (int64, error) {
+	batchSize := r.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+
+	cutoff := rwe.Clock.Now().Add(-r.Period())
+
+	var deleted int64
+	for {
+		select {
+		case <-ctx.Done():
+			return deleted, ctx.Err()
+		default:
+		}
+
+		n, err := r.runBatch(ctx, cutoff, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		if n == 0 {
+			break
+		}
+
+		deleted += int64(n)
+		retentionDeleted.Add(ctx, int64(n), label.String("retention", r.Name))
+		logrus.WithContext(ctx).Infof("retention %s: %d rows deleted", r.Name, deleted)
+
+		if n < batchSize {
+			break
+		}
+		if r.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return deleted, ctx.Err()
+			case <-time.After(r.Pause):
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *Retention) runBatch(ctx context.Context, cutoff time.Time, batchSize int) (int, error) {
+	subq := "SELECT id FROM ? WHERE ? < ?"
+	args := []interface{}{pg.Ident(r.Table), pg.Ident(r.Table), pg.Ident(r.Column), cutoff}
+	if r.Where != "" {
+		subq += " AND (?)"
+		args = append(args, pg.Safe(r.Where))
+	}
+	subq += " ORDER BY id LIMIT ?"
+	args = append(args, batchSize)
+
+	res, err := rwe.PGMain().ExecContext(ctx, "DELETE FROM ? WHERE id IN ("+subq+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
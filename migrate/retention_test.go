@@ -0,0 +1,96 @@
+package migrate_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/migrate"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	. "github.com/uptrace/go-realworld-example-app/testbed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retention", func() {
+	var ids []int64
+	var retention *migrate.Retention
+
+	hide := func(id int64, ago time.Duration) {
+		_, err := rwe.PGMain().ExecContext(ctx,
+			"UPDATE articles SET hidden_at = ? WHERE id = ?", rwe.Clock.Now().Add(-ago), id)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	selectRemaining := func() []int64 {
+		var remaining []int64
+		_, err := rwe.PGMain().QueryOneContext(ctx, pg.Scan(pg.Array(&remaining)), `
+			SELECT coalesce(array_agg(id ORDER BY id), '{}') FROM articles
+		`)
+		Expect(err).NotTo(HaveOccurred())
+		return remaining
+	}
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+
+		ids = insertArticles(5)
+		for _, id := range ids[:3] {
+			hide(id, 48*time.Hour)
+		}
+		hide(ids[3], time.Hour)
+
+		retention = &migrate.Retention{
+			Name:      "test_hidden_articles",
+			Table:     "articles",
+			Column:    "hidden_at",
+			TTL:       24 * time.Hour,
+			BatchSize: 2,
+		}
+	})
+
+	It("deletes expired rows in batches", func() {
+		n, err := retention.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(3)))
+		Expect(selectRemaining()).To(Equal(ids[3:]))
+	})
+
+	It("keeps rows that don't match the condition", func() {
+		_, err := rwe.PGMain().ExecContext(ctx,
+			"UPDATE articles SET legal_hold = true WHERE id = ?", ids[0])
+		Expect(err).NotTo(HaveOccurred())
+		retention.Where = "NOT articles.legal_hold"
+
+		n, err := retention.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(2)))
+		Expect(selectRemaining()).To(Equal([]int64{ids[0], ids[3], ids[4]}))
+	})
+
+	It("uses the period from the config", func() {
+		periods := rwe.Config.Retention
+		rwe.Config.Retention = map[string]time.Duration{retention.Name: 30 * time.Minute}
+		defer func() { rwe.Config.Retention = periods }()
+
+		Expect(retention.Period()).To(Equal(30 * time.Minute))
+
+		n, err := retention.Run(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(4)))
+		Expect(selectRemaining()).To(Equal(ids[4:]))
+	})
+
+	It("stops during the pause when the context is canceled", func() {
+		retention.Pause = time.Hour
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		n, err := retention.Run(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(n).To(Equal(int64(2)))
+		Expect(selectRemaining()).To(Equal(ids[2:]))
+	})
+})
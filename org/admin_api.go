@@ -0,0 +1,113 @@
+package org
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const adminUsersLimit = 50
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// AdminUser is the user as shown to admins.
+type AdminUser struct {
+	tableName struct{} `pg:"users,alias:u"`
+
+	ID       uint64 `json:"-"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+// listUsersHandler returns users ordered by username, optionally filtered by
+// the ?username prefix. Pages continue after the ?after username.
+func listUsersHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	query := req.URL.Query()
+
+	var users []*AdminUser
+	q := rwe.PGMain().ModelContext(ctx, &users).
+		OrderExpr("u.username ASC").
+		Limit(adminUsersLimit)
+
+	if prefix := query.Get("username"); prefix != "" {
+		q = q.Where("u.username LIKE ?", likeEscaper.Replace(prefix)+"%")
+	}
+	if after := query.Get("after"); after != "" {
+		q = q.Where("u.username > ?", after)
+	}
+
+	if err := q.Select(); err != nil {
+		return err
+	}
+
+	var next string
+	if len(users) == adminUsersLimit {
+		next = users[len(users)-1].Username
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"users":     users,
+		"nextAfter": next,
+	})
+}
+
+func updateUserRoleHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	authUser := UserFromContext(ctx)
+
+	var in struct {
+		User *struct {
+			Role string `json:"role"`
+		} `json:"user"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.User == nil {
+		return apperr.Required("user")
+	}
+
+	switch in.User.Role {
+	case RoleUser, RoleModerator, RoleAdmin:
+	default:
+		return apperr.Validation("role", "role must be %s, %s, or %s",
+			RoleUser, RoleModerator, RoleAdmin)
+	}
+
+	username := req.Param("username")
+	if username == authUser.Username && in.User.Role != RoleAdmin {
+		return apperr.Validation("role", "admins can't remove their own admin role")
+	}
+
+	user := new(AdminUser)
+	res, err := rwe.PGMain().
+		ModelContext(ctx, user).
+		Set("role = ?", in.User.Role).
+		Where("username = ?", username).
+		Returning("*").
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return apperr.New(apperr.NotFound, "user %q does not exist", username)
+	}
+
+	// Role checks use the cached user.
+	if err := rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID)); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"user": user,
+	})
+}
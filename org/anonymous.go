@@ -0,0 +1,157 @@
+package org
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis_rate/v9"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+// anonymousSubject is the subject of anonymous tokens. It is not a user id so
+// anonymous tokens are rejected where a user is required.
+const anonymousSubject = "anonymous"
+
+const anonymousTokenTTL = 24 * time.Hour
+
+// anonymousTokensPerHour limits how many anonymous tokens a client IP gets.
+const anonymousTokensPerHour = 10
+
+var (
+	errReadOnly = apperr.New(apperr.ReadOnly, "the site is read-only")
+
+	errAnonymousTokenRequired = apperr.New(apperr.Unauthorized,
+		"anonymous token is required, get one with POST /api/tokens/anonymous")
+)
+
+// publicWrites are the POST endpoints that stay available in public mode
+// because they don't change data.
+var publicWrites = map[string]bool{
+	"/api/tokens/anonymous": true,
+	"/api/users/login":      true,
+}
+
+func CreateAnonymousToken(ttl time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	claims := &jwt.StandardClaims{
+		Id:        hex.EncodeToString(b),
+		Subject:   anonymousSubject,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	key := []byte(rwe.Config.SecretKey)
+	return token.SignedString(key)
+}
+
+// verifyAnonymousToken checks that the token is a valid anonymous token.
+func verifyAnonymousToken(jwtToken string) error {
+	if len(jwtToken) == 0 {
+		return errAnonymousTokenRequired
+	}
+
+	token, err := jwt.ParseWithClaims(jwtToken, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(rwe.Config.SecretKey), nil
+	})
+	if err != nil {
+		return apperr.New(apperr.Unauthorized, "invalid token: %s", err)
+	}
+
+	claims := token.Claims.(*jwt.StandardClaims)
+	if !token.Valid || claims.Subject != anonymousSubject || claims.Id == "" {
+		return errAnonymousTokenRequired
+	}
+
+	return nil
+}
+
+func anonymousLimit() int {
+	if n := rwe.Config.Public.AnonymousLimit; n > 0 {
+		return n
+	}
+	return 30
+}
+
+// publicModeMiddleware must be used after the user is loaded.
+func publicModeMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		if !rwe.Config.Public.Enabled {
+			return next(w, req)
+		}
+
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !publicWrites[req.URL.Path] {
+				return errReadOnly
+			}
+			return next(w, req)
+		}
+
+		ctx := req.Context()
+
+		if UserFromContext(ctx) != nil {
+			return next(w, req)
+		}
+
+		if err := verifyAnonymousToken(authToken(req)); err != nil {
+			return err
+		}
+
+		// The quota is shared by all tokens of the client, so a new token
+		// doesn't reset it.
+		host, err := rwe.ClientIP(req.Request)
+		if err != nil {
+			return err
+		}
+
+		limit := redis_rate.PerMinute(anonymousLimit())
+		res, err := rwe.RateLimiter().Allow(ctx, "rl:anon:"+host, limit)
+		if err != nil {
+			return err
+		}
+		rwe.SetRateLimitHeaders(w.Header(), res)
+		if res.Allowed == 0 {
+			return apperr.New(apperr.RateLimited, "anonymous token is rate limited")
+		}
+
+		return next(w, req)
+	}
+}
+
+func createAnonymousTokenHandler(w http.ResponseWriter, req treemux.Request) error {
+	host, err := rwe.ClientIP(req.Request)
+	if err != nil {
+		return err
+	}
+
+	res, err := rwe.RateLimiter().Allow(req.Context(), "rl:anon-token:"+host,
+		redis_rate.PerHour(anonymousTokensPerHour))
+	if err != nil {
+		return err
+	}
+	rwe.SetRateLimitHeaders(w.Header(), res)
+	if res.Allowed == 0 {
+		return apperr.New(apperr.RateLimited, "too many anonymous tokens")
+	}
+
+	token, err := CreateAnonymousToken(anonymousTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"token":     token,
+		"expiresIn": int(anonymousTokenTTL / time.Second),
+	})
+}
@@ -6,19 +6,43 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/xcontext"
 	"github.com/vmihailenco/treemux"
 )
 
-type (
-	userCtxKey    struct{}
-	userErrCtxKey struct{}
+var (
+	errAdminRequired     = apperr.New(apperr.Forbidden, "admin role is required")
+	errModeratorRequired = apperr.New(apperr.Forbidden, "moderator role is required")
 )
 
+var (
+	userKey    = xcontext.NewKey("user")
+	userErrKey = xcontext.NewKey("user_err")
+)
+
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	return userKey.With(ctx, user)
+}
+
 func UserFromContext(ctx context.Context) *User {
-	user, _ := ctx.Value(userCtxKey{}).(*User)
+	user, _ := userKey.Value(ctx).(*User)
 	return user
 }
 
+// contextWithUserErr remembers why the user could not be authenticated so
+// MustUserMiddleware can report it.
+func contextWithUserErr(ctx context.Context, err error) context.Context {
+	return userErrKey.With(ctx, err)
+}
+
+func userErrFromContext(ctx context.Context) error {
+	err, _ := userErrKey.Value(ctx).(error)
+	return err
+}
+
 func authToken(req treemux.Request) string {
 	const prefix = "Token "
 	v := req.Header.Get("Authorization")
@@ -26,39 +50,67 @@ func authToken(req treemux.Request) string {
 	return v
 }
 
-func UserMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+// UserMiddleware loads the user from the auth token. In public mode it also
+// rejects writes and requires anonymous tokens from logged out clients.
+var UserMiddleware = rwe.TimedMiddleware(rwe.PhaseAuth, userMiddleware)
+
+func userMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	next = publicModeMiddleware(next)
 	return func(w http.ResponseWriter, req treemux.Request) error {
 		ctx := req.Context()
 
 		token := authToken(req)
 		userID, err := decodeUserToken(token)
 		if err != nil {
-			ctx = context.WithValue(ctx, userErrCtxKey{}, err)
+			ctx = contextWithUserErr(ctx, err)
 			return next(w, req.WithContext(ctx))
 		}
 
 		user, err := SelectUser(ctx, userID)
 		if err != nil {
-			ctx = context.WithValue(ctx, userErrCtxKey{}, err)
+			if err == pg.ErrNoRows {
+				err = apperr.New(apperr.Unauthorized, "user does not exist")
+			}
+			ctx = contextWithUserErr(ctx, err)
 			return next(w, req.WithContext(ctx))
 		}
 
 		user.Token, err = CreateUserToken(user.ID, 24*time.Hour)
 		if err != nil {
-			ctx = context.WithValue(ctx, userErrCtxKey{}, err)
+			ctx = contextWithUserErr(ctx, err)
 			return next(w, req.WithContext(ctx))
 		}
 
-		ctx = context.WithValue(ctx, userCtxKey{}, user)
+		ctx = ContextWithUser(ctx, user)
 		return next(w, req.WithContext(ctx))
 	}
 }
 
 func MustUserMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
 	return func(w http.ResponseWriter, req treemux.Request) error {
-		if err, ok := req.Context().Value(userErrCtxKey{}).(error); ok {
+		if err := userErrFromContext(req.Context()); err != nil {
 			return err
 		}
 		return next(w, req)
 	}
 }
+
+// MustAdminMiddleware must be used after MustUserMiddleware.
+func MustAdminMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		if !UserFromContext(req.Context()).IsAdmin() {
+			return errAdminRequired
+		}
+		return next(w, req)
+	}
+}
+
+// MustModeratorMiddleware must be used after MustUserMiddleware.
+func MustModeratorMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		if !UserFromContext(req.Context()).IsModerator() {
+			return errModeratorRequired
+		}
+		return next(w, req)
+	}
+}
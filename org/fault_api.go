@@ -0,0 +1,87 @@
+package org
+
+import (
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+func listFaultsHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"faults": rwe.Faults(),
+	})
+}
+
+// updateFaultsHandler replaces the faults injected into API requests. An empty
+// list disables fault injection.
+func updateFaultsHandler(w http.ResponseWriter, req treemux.Request) error {
+	var in struct {
+		Faults []*rwe.Fault `json:"faults"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	for _, f := range in.Faults {
+		if f == nil {
+			return apperr.Required("faults")
+		}
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+
+	rwe.SetFaults(in.Faults)
+
+	return httputil.JSON(w, treemux.H{
+		"faults": rwe.Faults(),
+	})
+}
+
+func sloHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"objectives": rwe.SLOStatuses(),
+	})
+}
+
+// shadowHandler reports queries mirrored to the shadow database. Shadow is
+// null when shadow mode is disabled.
+func shadowHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"shadow": rwe.ShadowStatuses(),
+	})
+}
+
+// poolsHandler reports the database pools and how often they were replaced
+// because the database failed over.
+func poolsHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"pools": rwe.PoolStatuses(),
+	})
+}
+
+// throttlesHandler reports the load of expensive endpoint classes.
+func throttlesHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"throttles": rwe.ThrottleStatuses(),
+	})
+}
+
+// featuresHandler reports the feature flags. Flags are read from the config,
+// so they are changed by editing it and restarting the instances.
+func featuresHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"features": rwe.FeatureFlags(),
+	})
+}
+
+// budgetsHandler reports how well routes keep their latency budgets.
+func budgetsHandler(w http.ResponseWriter, req treemux.Request) error {
+	return httputil.JSON(w, treemux.H{
+		"budgets": rwe.BudgetStatuses(),
+	})
+}
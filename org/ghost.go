@@ -0,0 +1,57 @@
+package org
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+)
+
+// GhostUsername is reserved for the ghost user and can't be chosen by users.
+const GhostUsername = "ghost"
+
+var errGhostUsername = apperr.New(apperr.UsernameTaken, "username is reserved")
+
+// GhostUser returns the author of articles and comments that users kept when
+// they deleted their accounts. The user is created on first use.
+func GhostUser(ctx context.Context, db orm.DB) (*User, error) {
+	ghost := new(User)
+	err := db.ModelContext(ctx, ghost).Where("ghost").Select()
+	if err != pg.ErrNoRows {
+		return ghost, err
+	}
+
+	ghost = &User{
+		Username: GhostUsername,
+		// The .invalid domain never resolves, see RFC 2606.
+		Email: GhostUsername + "@ghost.invalid",
+		Bio:   "This account was deleted.",
+		// Not a bcrypt hash, so no password matches it.
+		PasswordHash:        "!",
+		Ghost:               true,
+		HideFromLeaderboard: true,
+	}
+	res, err := db.ModelContext(ctx, ghost).
+		OnConflict("DO NOTHING").
+		Insert()
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() > 0 {
+		return ghost, nil
+	}
+
+	// Either another request created the ghost user or a user registered the
+	// username before it was reserved and the 24_reserve_ghost_username
+	// migration was not applied.
+	ghost = new(User)
+	if err := db.ModelContext(ctx, ghost).Where("ghost").Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return nil, fmt.Errorf("org: username %q of the ghost user is taken, run migrate_db", GhostUsername)
+		}
+		return nil, err
+	}
+	return ghost, nil
+}
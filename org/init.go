@@ -5,17 +5,44 @@ import (
 )
 
 func init() {
+	RegisterPendingAction(ActionFollow, redeemFollow)
+
 	g := rwe.API.WithMiddleware(UserMiddleware)
 
 	g.POST("/users", createUserHandler)
 	g.POST("/users/login", loginUserHandler)
+	g.POST("/tokens/anonymous", createAnonymousTokenHandler)
 	g.GET("/profiles/:username", profileHandler)
 
+	g.WithMiddleware(DeferMiddleware(ActionFollow, "username")).
+		POST("/profiles/:username/follow", followUserHandler)
+
 	g = g.WithMiddleware(MustUserMiddleware)
 
 	g.GET("/user/", currentUserHandler)
 	g.PUT("/user/", updateUserHandler)
+	g.GET("/user/preferences", preferencesHandler)
+	g.PUT("/user/preferences", updatePreferencesHandler)
+	g.GET("/user/verification", verificationHandler)
+	g.POST("/user/verification", requestVerificationHandler)
+
+	g.POST("/user/pending-actions", redeemPendingActionsHandler)
 
-	g.POST("/profiles/:username/follow", followUserHandler)
 	g.DELETE("/profiles/:username/follow", unfollowUserHandler)
+
+	g = g.WithMiddleware(MustAdminMiddleware)
+
+	g.GET("/admin/users", listUsersHandler)
+	g.PUT("/admin/users/:username/role", updateUserRoleHandler)
+	g.DELETE("/admin/users/:username/verification", revokeVerificationHandler)
+	g.GET("/admin/verifications", listVerificationsHandler)
+	g.PUT("/admin/verifications/:id", reviewVerificationHandler)
+	g.GET("/admin/faults", listFaultsHandler)
+	g.PUT("/admin/faults", updateFaultsHandler)
+	g.GET("/admin/slo", sloHandler)
+	g.GET("/admin/shadow", shadowHandler)
+	g.GET("/admin/pools", poolsHandler)
+	g.GET("/admin/throttles", throttlesHandler)
+	g.GET("/admin/budgets", budgetsHandler)
+	g.GET("/admin/features", featuresHandler)
 }
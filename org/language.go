@@ -0,0 +1,73 @@
+package org
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+)
+
+// maxLanguages limits content languages a user can prefer.
+const maxLanguages = 10
+
+var languageRe = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// NormalizeLanguage returns the primary subtag of the language tag, for
+// example, "en" for "en-US". Content is matched by the primary language only.
+func NormalizeLanguage(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if !languageRe.MatchString(tag) {
+		return "", apperr.Validation("language", "language must be an ISO 639 language code")
+	}
+	return tag, nil
+}
+
+func normalizeLanguages(tags []string, warnings *apperr.Warnings) ([]string, error) {
+	if len(tags) > maxLanguages {
+		return nil, apperr.Validation("languages", "at most %d languages are allowed", maxLanguages)
+	}
+
+	langs := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		lang, err := NormalizeLanguage(tag)
+		if err != nil {
+			return nil, apperr.Validation("languages", "%q is not an ISO 639 language code", tag)
+		}
+		if lang != tag {
+			warnings.Add("languages", apperr.LanguageNormalized,
+				"language %q normalized to %q", tag, lang)
+		}
+		if !seen[lang] {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+	return langs, nil
+}
+
+// acceptLanguages returns languages from the Accept-Language header in the
+// order of preference. Weights are not parsed because browsers already send
+// the languages sorted by them.
+func acceptLanguages(header string) []string {
+	var langs []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			part = part[:i]
+		}
+		lang, err := NormalizeLanguage(part)
+		if err != nil || seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		langs = append(langs, lang)
+		if len(langs) == maxLanguages {
+			break
+		}
+	}
+	return langs
+}
@@ -0,0 +1,117 @@
+package org
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const ActionFollow = "follow"
+
+const pendingActionTTL = 24 * time.Hour
+
+// PendingAction is an action attempted by a logged out user. The client keeps
+// the signed token and redeems it right after signup or login.
+type PendingAction struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+}
+
+type pendingActionClaims struct {
+	jwt.StandardClaims
+	Action PendingAction `json:"action"`
+}
+
+// PendingActionFunc performs the action on behalf of the user. It must be
+// idempotent because the same token can be redeemed more than once.
+type PendingActionFunc func(ctx context.Context, tx *pg.Tx, userID uint64, target string) error
+
+var pendingActions = make(map[string]PendingActionFunc)
+
+// RegisterPendingAction must be called from init.
+func RegisterPendingAction(kind string, fn PendingActionFunc) {
+	if _, ok := pendingActions[kind]; ok {
+		panic("pending action " + kind + " is already registered")
+	}
+	pendingActions[kind] = fn
+}
+
+func CreatePendingActionToken(action *PendingAction) (string, error) {
+	claims := &pendingActionClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(pendingActionTTL).Unix(),
+		},
+		Action: *action,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	key := []byte(rwe.Config.SecretKey)
+	return token.SignedString(key)
+}
+
+func decodePendingActionToken(jwtToken string) (*PendingAction, error) {
+	token, err := jwt.ParseWithClaims(jwtToken, &pendingActionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(rwe.Config.SecretKey), nil
+	})
+	if err != nil {
+		return nil, apperr.Validation("pendingActions", "invalid pending action: %s", err)
+	}
+
+	claims := token.Claims.(*pendingActionClaims)
+	if _, ok := pendingActions[claims.Action.Kind]; !ok {
+		return nil, apperr.Validation("pendingActions",
+			"unknown pending action %q", claims.Action.Kind)
+	}
+
+	return &claims.Action, nil
+}
+
+// redeemPendingActions performs all actions in a single transaction so either
+// all of them are applied or none.
+func redeemPendingActions(ctx context.Context, userID uint64, actions []*PendingAction) error {
+	return rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		for _, action := range actions {
+			fn := pendingActions[action.Kind]
+			if err := fn(ctx, tx, userID, action.Target); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeferMiddleware lets logged out users attempt the action. Instead of the
+// plain 401 error they receive a pending action token for the target in the
+// route param. It must be used after UserMiddleware.
+func DeferMiddleware(kind, param string) treemux.MiddlewareFunc {
+	return func(next treemux.HandlerFunc) treemux.HandlerFunc {
+		return func(w http.ResponseWriter, req treemux.Request) error {
+			if UserFromContext(req.Context()) != nil {
+				return next(w, req)
+			}
+
+			token, err := CreatePendingActionToken(&PendingAction{
+				Kind:   kind,
+				Target: req.Param(param),
+			})
+			if err != nil {
+				return err
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+			return httputil.JSON(w, treemux.H{
+				"status":        http.StatusUnauthorized,
+				"code":          apperr.Unauthorized,
+				"message":       "log in or sign up to continue",
+				"pendingAction": token,
+			})
+		}
+	}
+}
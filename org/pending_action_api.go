@@ -0,0 +1,72 @@
+package org
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+const maxPendingActions = 20
+
+func redeemPendingActionsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := UserFromContext(ctx)
+
+	var in struct {
+		PendingActions []string `json:"pendingActions"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 100<<kb); err != nil {
+		return err
+	}
+
+	if len(in.PendingActions) == 0 {
+		return apperr.Required("pendingActions")
+	}
+	if len(in.PendingActions) > maxPendingActions {
+		return apperr.Validation("pendingActions",
+			"at most %d pending actions can be redeemed at once", maxPendingActions)
+	}
+
+	actions := make([]*PendingAction, 0, len(in.PendingActions))
+	for _, token := range in.PendingActions {
+		action, err := decodePendingActionToken(token)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, action)
+	}
+
+	if err := redeemPendingActions(ctx, user.ID, actions); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"pendingActions": actions,
+	})
+}
+
+func redeemFollow(ctx context.Context, tx *pg.Tx, userID uint64, username string) error {
+	user := new(User)
+	if err := tx.ModelContext(ctx, user).
+		Column("id").
+		Where("username = ?", username).
+		Select(); err != nil {
+		return err
+	}
+
+	if _, err := tx.ModelContext(ctx, &FollowUser{
+		UserID:         userID,
+		FollowedUserID: user.ID,
+		CreatedAt:      rwe.Clock.Now(),
+	}).OnConflict("DO NOTHING").Insert(); err != nil {
+		return err
+	}
+
+	return nil
+}
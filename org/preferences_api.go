@@ -0,0 +1,97 @@
+package org
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/vmihailenco/treemux"
+)
+
+// Preferences are user settings that change what content is shown.
+type Preferences struct {
+	// Languages are content languages. Articles in other languages are not
+	// listed. Empty list shows all articles. It is only updated when set.
+	Languages *[]string `json:"languages"`
+	// TimeZone is an IANA time zone like "Europe/Berlin". It is only updated
+	// when set.
+	TimeZone *string `json:"timeZone"`
+}
+
+func newPreferences(user *User) *Preferences {
+	langs := user.Languages
+	if langs == nil {
+		langs = make([]string, 0)
+	}
+	timeZone := user.Location().String()
+	return &Preferences{
+		Languages: &langs,
+		TimeZone:  &timeZone,
+	}
+}
+
+func preferencesHandler(w http.ResponseWriter, req treemux.Request) error {
+	user := UserFromContext(req.Context())
+	return httputil.JSON(w, treemux.H{
+		"preferences": newPreferences(user),
+	})
+}
+
+func updatePreferencesHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := UserFromContext(ctx)
+
+	var in struct {
+		Preferences *Preferences `json:"preferences"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Preferences == nil {
+		return apperr.Required("preferences")
+	}
+
+	var warnings apperr.Warnings
+
+	q := rwe.PGMain().
+		ModelContext(ctx, user).
+		Where("id = ?", user.ID).
+		Returning("languages, time_zone")
+
+	if in.Preferences.Languages != nil {
+		langs, err := normalizeLanguages(*in.Preferences.Languages, &warnings)
+		if err != nil {
+			return err
+		}
+		q = q.Set("languages = ?", pg.Array(langs))
+	}
+
+	if in.Preferences.TimeZone != nil {
+		loc, err := rwe.LoadLocation(*in.Preferences.TimeZone)
+		if err != nil {
+			return apperr.Validation("timeZone", "%q is not an IANA time zone", *in.Preferences.TimeZone)
+		}
+		q = q.Set("time_zone = ?", loc.String())
+	}
+
+	if in.Preferences.Languages != nil || in.Preferences.TimeZone != nil {
+		if _, err := q.Update(); err != nil {
+			return err
+		}
+
+		// Lists filter articles by the cached user.
+		if err := rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID)); err != nil {
+			return err
+		}
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"preferences": newPreferences(user),
+		"warnings":    warnings.List(),
+	})
+}
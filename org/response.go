@@ -0,0 +1,49 @@
+package org
+
+// UserResponse is the JSON representation of the current user. Handlers
+// serialize users only with NewUserResponse so the shape is defined here.
+type UserResponse struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	Bio       string `json:"bio"`
+	Image     string `json:"image"`
+	Token     string `json:"token,omitempty"`
+	Following bool   `json:"following"`
+
+	HideFromLeaderboard bool `json:"hideFromLeaderboard"`
+}
+
+func NewUserResponse(user *User) *UserResponse {
+	return &UserResponse{
+		Username:  user.Username,
+		Email:     user.Email,
+		Bio:       user.Bio,
+		Image:     user.Image,
+		Token:     user.Token,
+		Following: user.Following,
+
+		HideFromLeaderboard: user.HideFromLeaderboard,
+	}
+}
+
+// ProfileResponse is the public JSON representation of a user.
+type ProfileResponse struct {
+	Username  string `json:"username"`
+	Bio       string `json:"bio"`
+	Image     string `json:"image"`
+	Verified  bool   `json:"verified"`
+	Following bool   `json:"following"`
+}
+
+func NewProfileResponse(profile *Profile) *ProfileResponse {
+	if profile == nil {
+		return nil
+	}
+	return &ProfileResponse{
+		Username:  profile.Username,
+		Bio:       profile.Bio,
+		Image:     profile.Image,
+		Verified:  profile.Verified,
+		Following: profile.Following,
+	}
+}
@@ -0,0 +1,88 @@
+package org
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func compactJSON(t *testing.T, s string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestUserResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		user *User
+		want string
+	}{
+		{
+			name: "without token",
+			user: &User{ID: 1, Username: "CurrentUser", Email: "hello@world.com", PasswordHash: "hash"},
+			want: `{
+				"username": "CurrentUser", "email": "hello@world.com", "bio": "", "image": "",
+				"following": false, "hideFromLeaderboard": false
+			}`,
+		},
+		{
+			name: "with token",
+			user: &User{
+				Username:            "CurrentUser",
+				Email:               "hello@world.com",
+				Bio:                 "bio",
+				Image:               "https://example.com/image.png",
+				Token:               "token",
+				HideFromLeaderboard: true,
+			},
+			want: `{
+				"username": "CurrentUser", "email": "hello@world.com", "bio": "bio",
+				"image": "https://example.com/image.png", "token": "token",
+				"following": false, "hideFromLeaderboard": true
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		b, err := json.Marshal(NewUserResponse(test.user))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), compactJSON(t, test.want); got != want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.name, got, want)
+		}
+	}
+}
+
+func TestProfileResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *Profile
+		want    string
+	}{
+		{
+			name: "nil",
+			want: `null`,
+		},
+		{
+			name:    "profile",
+			profile: &Profile{ID: 1, Username: "FollowedUser", Verified: true, Following: true},
+			want: `{
+				"username": "FollowedUser", "bio": "", "image": "", "verified": true, "following": true
+			}`,
+		},
+	}
+
+	for _, test := range tests {
+		b, err := json.Marshal(NewProfileResponse(test.profile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), compactJSON(t, test.want); got != want {
+			t.Errorf("%s:\ngot  %s\nwant %s", test.name, got, want)
+		}
+	}
+}
@@ -1,35 +1,35 @@
 package org
 
 import (
-	"errors"
 	"strconv"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 )
 
 func decodeUserToken(jwtToken string) (uint64, error) {
 	if len(jwtToken) == 0 {
-		return 0, errors.New("token is missing or empty")
+		return 0, apperr.New(apperr.Unauthorized, "token is missing or empty")
 	}
 
 	token, err := jwt.ParseWithClaims(jwtToken, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(rwe.Config.SecretKey), nil
 	})
 	if err != nil {
-		return 0, err
+		return 0, apperr.New(apperr.Unauthorized, "invalid token: %s", err)
 	}
 
 	if !token.Valid {
-		return 0, errors.New("invalid token")
+		return 0, apperr.New(apperr.Unauthorized, "invalid token")
 	}
 
 	claims := token.Claims.(*jwt.StandardClaims)
 
 	id, err := strconv.ParseUint(claims.Subject, 10, 64)
 	if err != nil {
-		return 0, err
+		return 0, apperr.New(apperr.Unauthorized, "invalid token subject")
 	}
 
 	return id, nil
@@ -45,3 +45,49 @@ func CreateUserToken(userID uint64, ttl time.Duration) (string, error) {
 	key := []byte(rwe.Config.SecretKey)
 	return token.SignedString(key)
 }
+
+type confirmationClaims struct {
+	jwt.StandardClaims
+	UserID uint64 `json:"uid"`
+	Action string `json:"action"`
+	Value  string `json:"value"`
+}
+
+// CreateConfirmationToken signs the value that the user confirms with a second
+// request, e.g. the chosen options of a destructive action. The claims differ
+// from user tokens, so the token can't be used to log in.
+func CreateConfirmationToken(userID uint64, action, value string, ttl time.Duration) (string, error) {
+	claims := &confirmationClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: rwe.Clock.Now().Add(ttl).Unix(),
+		},
+		UserID: userID,
+		Action: action,
+		Value:  value,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	key := []byte(rwe.Config.SecretKey)
+	return token.SignedString(key)
+}
+
+// DecodeConfirmationToken returns the value of the token created for the user
+// and the action. Expiration is checked with rwe.Clock.
+func DecodeConfirmationToken(jwtToken string, userID uint64, action string) (string, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(jwtToken, &confirmationClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(rwe.Config.SecretKey), nil
+	})
+	if err != nil {
+		return "", apperr.Validation("token", "invalid confirmation token: %s", err)
+	}
+
+	claims := token.Claims.(*confirmationClaims)
+	if !claims.VerifyExpiresAt(rwe.Clock.Now().Unix(), true) {
+		return "", apperr.Validation("token", "confirmation token has expired")
+	}
+	if claims.UserID != userID || claims.Action != action {
+		return "", apperr.Validation("token", "confirmation token is for another action")
+	}
+	return claims.Value, nil
+}
@@ -5,8 +5,18 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"github.com/go-redis/cache/v8"
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
 )
 
 type User struct {
@@ -19,16 +29,60 @@ type User struct {
 	Image        string `json:"image"`
 	Password     string `pg:"-" json:"password,omitempty"`
 	PasswordHash string `json:"-"`
+	Role         string `json:"-"`
 	Following    bool   `pg:"-" json:"following"`
+	// Verified is set by admins when they approve a VerificationRequest.
+	Verified bool `json:"-"`
+	// Ghost marks the author of content transferred from deleted accounts,
+	// see GhostUser.
+	Ghost bool `json:"-"`
+
+	HideFromLeaderboard bool `pg:",use_zero" json:"hideFromLeaderboard"`
+
+	// Languages are preferred content languages, see Preferences.
+	Languages []string `pg:",array" json:"-"`
+	// TimeZone is the IANA time zone of the user, empty for UTC.
+	TimeZone string `json:"-"`
 
 	Token string `pg:"-" json:"token,omitempty"`
 }
 
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsModerator reports whether the user can take down content. Admins are
+// moderators too.
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// Location returns the time zone of the user for dates shown to the user.
+func (u *User) Location() *time.Location {
+	loc, err := rwe.LoadLocation(u.TimeZone)
+	if err != nil {
+		// The zone was removed from the database after it was stored.
+		return time.UTC
+	}
+	return loc
+}
+
+const maxBioLength = 500
+
+// normalizeText normalizes the username and bio chosen by the user.
+func (u *User) normalizeText() error {
+	if err := textutil.Line("username", &u.Username, 0); err != nil {
+		return err
+	}
+	return textutil.Text("bio", &u.Bio, maxBioLength)
+}
+
 type FollowUser struct {
 	tableName struct{} `pg:"alias:fu"`
 
 	UserID         uint64
 	FollowedUserID uint64
+	CreatedAt      time.Time
 }
 
 type Profile struct {
@@ -38,6 +92,7 @@ type Profile struct {
 	Username  string `json:"username"`
 	Bio       string `json:"bio"`
 	Image     string `json:"image"`
+	Verified  bool   `json:"verified"`
 	Following bool   `pg:"-" json:"following"`
 }
 
@@ -46,6 +101,7 @@ func NewProfile(user *User) *Profile {
 		Username:  user.Username,
 		Bio:       user.Bio,
 		Image:     user.Image,
+		Verified:  user.Verified,
 		Following: user.Following,
 	}
 }
@@ -58,7 +114,7 @@ func SelectUser(ctx context.Context, userID uint64) (*User, error) {
 		Value: user,
 		TTL:   15 * time.Minute,
 		Do: func(item *cache.Item) (interface{}, error) {
-			return selectUser(ctx, userID)
+			return selectUser(rwe.DetachedContext(ctx), userID)
 		},
 	}); err != nil {
 		return nil, err
@@ -88,3 +144,42 @@ func SelectUserByUsername(ctx context.Context, username string) (*User, error) {
 
 	return user, nil
 }
+
+// InsertUser hashes the password of the new user and inserts it with db, which
+// is either the database or a transaction.
+func InsertUser(ctx context.Context, db orm.DB, user *User) error {
+	if err := user.normalizeText(); err != nil {
+		return err
+	}
+	if user.Username == GhostUsername {
+		return errGhostUsername
+	}
+
+	var err error
+	user.PasswordHash, err = hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ModelContext(ctx, user).Insert(); err != nil {
+		return userConflictError(err)
+	}
+	return nil
+}
+
+// userConflictError reports violations of the unique email and username
+// indexes with their error codes.
+func userConflictError(err error) error {
+	pgErr, ok := err.(pg.Error)
+	if !ok || !pgErr.IntegrityViolation() {
+		return err
+	}
+
+	switch pgErr.Field('n') {
+	case "users_email_idx":
+		return apperr.New(apperr.EmailTaken, "email is already taken")
+	case "users_username_idx":
+		return apperr.New(apperr.UsernameTaken, "username is already taken")
+	}
+	return err
+}
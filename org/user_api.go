@@ -1,21 +1,24 @@
 package org
 
 import (
-	"errors"
 	"net/http"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 	"github.com/vmihailenco/treemux"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/uptrace/go-realworld-example-app/apperr"
 	"github.com/uptrace/go-realworld-example-app/httputil"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 )
 
 const kb = 10
 
-var errUserNotFound = errors.New("Not registered email or invalid password")
+var errUserNotFound = apperr.New(apperr.UserNotFound, "Not registered email or invalid password")
+
+var userQueries rwe.QueryCache
 
 func setUserToken(user *User) error {
 	token, err := CreateUserToken(user.ID, 24*time.Hour)
@@ -28,8 +31,8 @@ func setUserToken(user *User) error {
 
 func currentUserHandler(w http.ResponseWriter, req treemux.Request) error {
 	user := UserFromContext(req.Context())
-	return treemux.JSON(w, treemux.H{
-		"user": user,
+	return httputil.JSON(w, treemux.H{
+		"user": NewUserResponse(user),
 	})
 }
 
@@ -45,30 +48,23 @@ func createUserHandler(w http.ResponseWriter, req treemux.Request) error {
 	}
 
 	if in.User == nil {
-		return errors.New(`JSON field "user" is required`)
+		return apperr.Required("user")
 	}
 
 	user := in.User
+	user.Languages = acceptLanguages(req.Header.Get("Accept-Language"))
 
-	var err error
-	user.PasswordHash, err = hashPassword(user.Password)
-	if err != nil {
-		return err
-	}
-
-	if _, err := rwe.PGMain().
-		ModelContext(ctx, user).
-		Insert(); err != nil {
+	if err := InsertUser(ctx, rwe.PGMain(), user); err != nil {
 		return err
 	}
 
-	if err = setUserToken(user); err != nil {
+	if err := setUserToken(user); err != nil {
 		return err
 	}
 
 	user.Password = ""
-	return treemux.JSON(w, treemux.H{
-		"user": user,
+	return httputil.JSON(w, treemux.H{
+		"user": NewUserResponse(user),
 	})
 }
 
@@ -94,14 +90,21 @@ func loginUserHandler(w http.ResponseWriter, req treemux.Request) error {
 	}
 
 	if in.User == nil {
-		return errors.New(`JSON field "user" is required`)
+		return apperr.Required("user")
 	}
 
 	user := new(User)
-	if err := rwe.PGMain().
-		ModelContext(ctx, user).
-		Where("email = ?", in.User.Email).
-		Select(); err != nil {
+	query, err := userQueries.Compile("login", func() (string, error) {
+		return rwe.FormatSelect(rwe.PGMain(), rwe.PGMain().Model(user).Where("email = ?0"))
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := rwe.PGMain().QueryOneContext(ctx, user, query, in.User.Email); err != nil {
+		if err == pg.ErrNoRows {
+			return errUserNotFound
+		}
 		return err
 	}
 
@@ -113,8 +116,8 @@ func loginUserHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"user": user,
+	return httputil.JSON(w, treemux.H{
+		"user": NewUserResponse(user),
 	})
 }
 
@@ -139,10 +142,16 @@ func updateUserHandler(w http.ResponseWriter, req treemux.Request) error {
 	}
 
 	if in.User == nil {
-		return errors.New(`JSON field "user" is required`)
+		return apperr.Required("user")
 	}
 
 	user := in.User
+	if err := user.normalizeText(); err != nil {
+		return err
+	}
+	if user.Username == GhostUsername && authUser.Username != GhostUsername {
+		return errGhostUsername
+	}
 
 	var err error
 	user.PasswordHash, err = hashPassword(user.Password)
@@ -157,15 +166,16 @@ func updateUserHandler(w http.ResponseWriter, req treemux.Request) error {
 		Set("password_hash = ?", user.PasswordHash).
 		Set("image = ?", user.Image).
 		Set("bio = ?", user.Bio).
+		Set("hide_from_leaderboard = ?", user.HideFromLeaderboard).
 		Where("id = ?", authUser.ID).
 		Returning("*").
 		Update(); err != nil {
-		return err
+		return userConflictError(err)
 	}
 
 	user.Password = ""
-	return treemux.JSON(w, treemux.H{
-		"user": authUser,
+	return httputil.JSON(w, treemux.H{
+		"user": NewUserResponse(authUser),
 	})
 }
 
@@ -173,7 +183,7 @@ func profileHandler(w http.ResponseWriter, req treemux.Request) error {
 	ctx := req.Context()
 
 	followingColumn := func(q *orm.Query) (*orm.Query, error) {
-		if authUser, ok := ctx.Value(userCtxKey{}).(*User); ok {
+		if authUser := UserFromContext(ctx); authUser != nil {
 			subq := rwe.PGMain().Model((*FollowUser)(nil)).
 				Where("fu.followed_user_id = u.id").
 				Where("fu.user_id = ?", authUser.ID)
@@ -196,8 +206,8 @@ func profileHandler(w http.ResponseWriter, req treemux.Request) error {
 		return err
 	}
 
-	return treemux.JSON(w, treemux.H{
-		"profile": NewProfile(user),
+	return httputil.JSON(w, treemux.H{
+		"profile": NewProfileResponse(NewProfile(user)),
 	})
 }
 
@@ -213,16 +223,18 @@ func followUserHandler(w http.ResponseWriter, req treemux.Request) error {
 	followUser := &FollowUser{
 		UserID:         authUser.ID,
 		FollowedUserID: user.ID,
+		CreatedAt:      rwe.Clock.Now(),
 	}
 	if _, err := rwe.PGMain().
 		ModelContext(ctx, followUser).
 		Insert(); err != nil {
 		return err
 	}
+	rwe.PublishActivity(ctx, user.ID)
 
 	user.Following = true
-	return treemux.JSON(w, treemux.H{
-		"profile": NewProfile(user),
+	return httputil.JSON(w, treemux.H{
+		"profile": NewProfileResponse(NewProfile(user)),
 	})
 }
 
@@ -244,7 +256,7 @@ func unfollowUserHandler(w http.ResponseWriter, req treemux.Request) error {
 	}
 
 	user.Following = false
-	return treemux.JSON(w, treemux.H{
-		"profile": NewProfile(user),
+	return httputil.JSON(w, treemux.H{
+		"profile": NewProfileResponse(NewProfile(user)),
 	})
 }
@@ -4,12 +4,18 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	_ "github.com/uptrace/go-realworld-example-app/admin"
 	"github.com/uptrace/go-realworld-example-app/org"
 	"github.com/uptrace/go-realworld-example-app/rwe"
 	. "github.com/uptrace/go-realworld-example-app/testbed"
 	"github.com/uptrace/go-realworld-example-app/xconfig"
+	"github.com/vmihailenco/treemux"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -32,8 +38,68 @@ func init() {
 	}
 
 	ctx = rwe.Init(ctx, cfg)
+
+	rwe.Internal.POST("/test/signed", func(w http.ResponseWriter, req treemux.Request) error {
+		return treemux.JSON(w, treemux.H{"ok": true})
+	})
 }
 
+var _ = Describe("signed request", func() {
+	const uri = "/api/internal/test/signed?batch=1"
+
+	signedPost := func(uri, body, secret, signedURI string, timestamp int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", uri, strings.NewReader(body))
+		req.Header.Set(rwe.SignatureKeyHeader, "test")
+		req.Header.Set(rwe.SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(rwe.SignatureHeader,
+			rwe.Signature(secret, "POST", signedURI, timestamp, []byte(body)))
+
+		resp := httptest.NewRecorder()
+		rwe.Router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	BeforeEach(func() {
+		ResetAll(ctx)
+		rwe.Config.SigningKeys = map[string]string{"test": "secret"}
+	})
+
+	AfterEach(func() {
+		rwe.Config.SigningKeys = nil
+	})
+
+	It("accepts signed request once", func() {
+		now := time.Now().Unix()
+
+		resp := signedPost(uri, `{"event": "view"}`, "secret", uri, now)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+
+		resp = signedPost(uri, `{"event": "view"}`, "secret", uri, now)
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects stale or unsigned requests", func() {
+		resp := signedPost(uri, `{}`, "secret", uri, time.Now().Add(-time.Hour).Unix())
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+
+		resp = Post(uri, `{}`)
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects bad signatures", func() {
+		now := time.Now().Unix()
+
+		resp := signedPost(uri, `{}`, "wrong", uri, now)
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+
+		resp = signedPost(uri, `{"event": "view"}`, "secret", uri, now)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+
+		resp = signedPost("/api/internal/test/signed?batch=2", `{}`, "secret", uri, now+1)
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+	})
+})
+
 var _ = Describe("createUser", func() {
 	var data map[string]interface{}
 
@@ -49,6 +115,8 @@ var _ = Describe("createUser", func() {
 			"image":     Equal("img"),
 			"token":     Not(BeEmpty()),
 			"following": Equal(false),
+
+			"hideFromLeaderboard": Equal(false),
 		}
 
 		json := `{"user": {"username": "wangzitian0","email": "wzt@gg.cn","password": "jakejxke", "image": "img", "bio": "bar"}}`
@@ -61,6 +129,30 @@ var _ = Describe("createUser", func() {
 		Expect(data["user"]).To(MatchAllKeys(userKeys))
 	})
 
+	It("rejects taken email", func() {
+		json := `{"user": {"username": "other","email": "wzt@gg.cn","password": "jakejxke"}}`
+		resp := Post("/api/users", json)
+
+		data = ParseJSON(resp, http.StatusConflict)
+		Expect(data["code"]).To(Equal("EMAIL_TAKEN"))
+	})
+
+	It("reports rate limit on every response", func() {
+		resp := Get("/api/profiles/wangzitian0")
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("X-RateLimit-Limit")).To(Equal("100"))
+		Expect(resp.Header().Get("X-RateLimit-Remaining")).NotTo(BeEmpty())
+		Expect(resp.Header().Get("X-RateLimit-Reset")).NotTo(BeEmpty())
+	})
+
+	It("rejects invalid password", func() {
+		json := `{"user": {"email": "wzt@gg.cn","password": "wrong"}}`
+		resp := Post("/api/users/login", json)
+
+		data = ParseJSON(resp, http.StatusUnprocessableEntity)
+		Expect(data["code"]).To(Equal("USER_NOT_FOUND"))
+	})
+
 	Describe("loginUser", func() {
 		var user *org.User
 
@@ -72,7 +164,7 @@ var _ = Describe("createUser", func() {
 
 			username := data["user"].(map[string]interface{})["username"].(string)
 			var err error
-			user, err = org.SelectUserByUsername(context.Background(), username)
+			user, err = org.SelectUserByUsername(ctx, username)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -80,6 +172,348 @@ var _ = Describe("createUser", func() {
 			Expect(data["user"]).To(MatchAllKeys(userKeys))
 		})
 
+		Describe("preferences", func() {
+			It("updates content languages", func() {
+				resp := GetWithToken("/api/user/preferences", user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["preferences"]).To(Equal(map[string]interface{}{
+					"languages": []interface{}{},
+					"timeZone":  "UTC",
+				}))
+
+				json := `{"preferences": {"languages": ["en-US", "de", "EN"]}}`
+				resp = PutWithToken("/api/user/preferences", json, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["warnings"]).To(Equal([]interface{}{
+					map[string]interface{}{"code": "LANGUAGE_NORMALIZED", "field": "languages", "message": `language "en-US" normalized to "en"`},
+					map[string]interface{}{"code": "LANGUAGE_NORMALIZED", "field": "languages", "message": `language "EN" normalized to "en"`},
+				}))
+
+				resp = GetWithToken("/api/user/preferences", user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["preferences"]).To(Equal(map[string]interface{}{
+					"languages": []interface{}{"en", "de"},
+					"timeZone":  "UTC",
+				}))
+			})
+
+			It("rejects invalid languages", func() {
+				json := `{"preferences": {"languages": ["english"]}}`
+				resp := PutWithToken("/api/user/preferences", json, user.ID)
+				data = ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("languages"))
+			})
+
+			It("updates time zone", func() {
+				json := `{"preferences": {"languages": [], "timeZone": "Europe/Berlin"}}`
+				resp := PutWithToken("/api/user/preferences", json, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["preferences"]).To(HaveKeyWithValue("timeZone", "Europe/Berlin"))
+
+				// Omitted time zone is kept.
+				resp = PutWithToken("/api/user/preferences", `{"preferences": {"languages": ["en"]}}`, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["preferences"]).To(HaveKeyWithValue("timeZone", "Europe/Berlin"))
+
+				// Omitted languages are kept.
+				resp = PutWithToken("/api/user/preferences", `{"preferences": {"timeZone": "Asia/Tokyo"}}`, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["preferences"]).To(Equal(map[string]interface{}{
+					"languages": []interface{}{"en"},
+					"timeZone":  "Asia/Tokyo",
+				}))
+
+				json = `{"preferences": {"languages": [], "timeZone": "Europe/Atlantis"}}`
+				resp = PutWithToken("/api/user/preferences", json, user.ID)
+				data = ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("timeZone"))
+			})
+		})
+
+		Describe("fault injection", func() {
+			AfterEach(func() {
+				rwe.SetFaults(nil)
+			})
+
+			It("requires admin role", func() {
+				resp := PutWithToken("/api/admin/faults", `{"faults": []}`, user.ID)
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("injects errors into matching routes", func() {
+				_, err := rwe.PGMain().ModelContext(ctx, user).
+					Set("role = ?", org.RoleAdmin).
+					WherePK().
+					Update()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+
+				json := `{"faults": [{"path": "/api/profiles/", "percent": 100, "status": 503}]}`
+				resp := PutWithToken("/api/admin/faults", json, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["faults"]).To(HaveLen(1))
+
+				resp = Get("/api/profiles/wangzitian0")
+				Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+
+				resp = PutWithToken("/api/admin/faults", `{"faults": []}`, user.ID)
+				_ = ParseJSON(resp, http.StatusOK)
+
+				resp = Get("/api/profiles/wangzitian0")
+				Expect(resp.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Describe("slo", func() {
+			AfterEach(func() {
+				rwe.SetFaults(nil)
+				rwe.SetObjectives(nil)
+			})
+
+			It("reports error budget burn rate", func() {
+				_, err := rwe.PGMain().ModelContext(ctx, user).
+					Set("role = ?", org.RoleAdmin).
+					WherePK().
+					Update()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+
+				rwe.SetObjectives([]*xconfig.Objective{{
+					Name:         "profiles",
+					Prefix:       "/api/profiles/",
+					Availability: 0.99,
+				}})
+				rwe.SetFaults([]*rwe.Fault{{Path: "/api/profiles/", Percent: 100, Status: 503}})
+
+				resp := Get("/api/profiles/wangzitian0")
+				Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+
+				rwe.SetFaults(nil)
+				resp = Get("/api/profiles/wangzitian0")
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				resp = GetWithToken("/api/admin/slo", user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				objectives := data["objectives"].([]interface{})
+				Expect(objectives).To(HaveLen(1))
+				Expect(objectives[0]).To(MatchAllKeys(Keys{
+					"name":                 Equal("profiles"),
+					"requests":             Equal(float64(2)),
+					"availability":         Equal(0.5),
+					"availabilityBurnRate": BeNumerically("~", 50),
+					"latencyBurnRate":      Equal(float64(0)),
+				}))
+			})
+		})
+
+		It("reports database pools", func() {
+			_, err := rwe.PGMain().ModelContext(ctx, user).
+				Set("role = ?", org.RoleAdmin).
+				WherePK().
+				Update()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+
+			resp := GetWithToken("/api/admin/pools", user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["pools"]).To(HaveKeyWithValue("main", MatchKeys(IgnoreExtras, Keys{
+				"totalConns": BeNumerically(">", 0),
+				"resets":     Equal(float64(0)),
+			})))
+		})
+
+		It("reports feature flags", func() {
+			_, err := rwe.PGMain().ModelContext(ctx, user).
+				Set("role = ?", org.RoleAdmin).
+				WherePK().
+				Update()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+
+			features := rwe.Config.Features
+			rwe.Config.Features = map[string]bool{"feed_ranking": true, "articles_favorites_count": false}
+			defer func() { rwe.Config.Features = features }()
+
+			resp := GetWithToken("/api/admin/features", user.ID)
+			data = ParseJSON(resp, http.StatusOK)
+			Expect(data["features"]).To(Equal(map[string]interface{}{
+				"feed_ranking":             true,
+				"articles_favorites_count": false,
+			}))
+		})
+
+		Describe("admin users", func() {
+			It("lists users and changes roles", func() {
+				resp := GetWithToken("/api/admin/users", user.ID)
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+
+				_, err := rwe.PGMain().ModelContext(ctx, user).
+					Set("role = ?", org.RoleAdmin).
+					WherePK().
+					Update()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+
+				resp = GetWithToken("/api/admin/users?username=wang", user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["users"]).To(Equal([]interface{}{
+					map[string]interface{}{"username": "wangzitian0", "email": "wzt@gg.cn", "role": "admin"},
+				}))
+				Expect(data["nextAfter"]).To(Equal(""))
+
+				json := `{"user": {"role": "user"}}`
+				resp = PutWithToken("/api/admin/users/wangzitian0/role", json, user.ID)
+				data = ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("role"))
+
+				resp = PutWithToken("/api/admin/users/nobody/role", json, user.ID)
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+			})
+
+			It("serves the admin UI", func() {
+				resp := Get("/admin/")
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(resp.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+				Expect(resp.Body.String()).To(ContainSubstring(`<script src="admin.js">`))
+
+				resp = Get("/admin/admin.js")
+				Expect(resp.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Describe("verification", func() {
+			It("verifies the user when the request is approved", func() {
+				resp := PostWithToken("/api/user/verification", `{"verification": {"evidence": " "}}`, user.ID)
+				data = ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("evidence"))
+
+				json := `{"verification": {"evidence": "https://example.com/wangzitian0"}}`
+				resp = PostWithToken("/api/user/verification", json, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				verification := data["verification"].(map[string]interface{})
+				Expect(verification).To(HaveKeyWithValue("status", "pending"))
+
+				resp = PostWithToken("/api/user/verification", json, user.ID)
+				data = ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("verification"))
+
+				_, err := rwe.PGMain().ModelContext(ctx, user).
+					Set("role = ?", org.RoleAdmin).
+					WherePK().
+					Update()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))).To(Succeed())
+
+				resp = GetWithToken("/api/admin/verifications", user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				queue := data["verifications"].([]interface{})
+				Expect(queue).To(HaveLen(1))
+				Expect(queue[0]).To(HaveKeyWithValue("username", "wangzitian0"))
+				Expect(queue[0]).To(HaveKeyWithValue("evidence", "https://example.com/wangzitian0"))
+
+				url := fmt.Sprintf("/api/admin/verifications/%v", verification["id"])
+				review := `{"verification": {"status": "approved", "note": "linked from the homepage"}}`
+				resp = PutWithToken(url, review, user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["verification"]).To(HaveKeyWithValue("status", "approved"))
+
+				resp = PutWithToken(url, review, user.ID)
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+
+				resp = Get("/api/profiles/wangzitian0")
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["profile"]).To(HaveKeyWithValue("verified", true))
+
+				resp = PostWithToken("/api/user/verification", json, user.ID)
+				data = ParseJSON(resp, http.StatusBadRequest)
+				Expect(data["field"]).To(Equal("verification"))
+
+				resp = DeleteWithToken("/api/admin/users/wangzitian0/verification", user.ID)
+				Expect(resp.Code).To(Equal(http.StatusOK))
+
+				resp = Get("/api/profiles/wangzitian0")
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["profile"]).To(HaveKeyWithValue("verified", false))
+			})
+		})
+
+		Describe("public mode", func() {
+			BeforeEach(func() {
+				rwe.Config.Public.Enabled = true
+			})
+
+			AfterEach(func() {
+				rwe.Config.Public.Enabled = false
+			})
+
+			getWithAnonymousToken := func(url, token string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest("GET", url, nil)
+				req.Header.Set("Authorization", "Token "+token)
+				resp := httptest.NewRecorder()
+				rwe.Router.ServeHTTP(resp, req)
+				return resp
+			}
+
+			It("requires anonymous token from logged out clients", func() {
+				resp := Get("/api/profiles/wangzitian0")
+				data = ParseJSON(resp, http.StatusUnauthorized)
+
+				resp = Post("/api/tokens/anonymous", "")
+				data = ParseJSON(resp, http.StatusOK)
+				token := data["token"].(string)
+
+				resp = getWithAnonymousToken("/api/profiles/wangzitian0", token)
+				data = ParseJSON(resp, http.StatusOK)
+				Expect(data["profile"]).To(HaveKeyWithValue("username", "wangzitian0"))
+
+				resp = getWithAnonymousToken("/api/user/", token)
+				data = ParseJSON(resp, http.StatusUnauthorized)
+			})
+
+			It("shares the quota between anonymous tokens of the client", func() {
+				rwe.Config.Public.AnonymousLimit = 2
+				defer func() { rwe.Config.Public.AnonymousLimit = 0 }()
+
+				resp := Post("/api/tokens/anonymous", "")
+				token := ParseJSON(resp, http.StatusOK)["token"].(string)
+
+				for i := 0; i < 2; i++ {
+					resp = getWithAnonymousToken("/api/profiles/wangzitian0", token)
+					_ = ParseJSON(resp, http.StatusOK)
+				}
+
+				resp = Post("/api/tokens/anonymous", "")
+				token = ParseJSON(resp, http.StatusOK)["token"].(string)
+
+				resp = getWithAnonymousToken("/api/profiles/wangzitian0", token)
+				data = ParseJSON(resp, http.StatusTooManyRequests)
+				Expect(data["code"]).To(Equal("RATE_LIMITED"))
+			})
+
+			It("limits anonymous tokens per client", func() {
+				for i := 0; i < 10; i++ {
+					resp := Post("/api/tokens/anonymous", "")
+					_ = ParseJSON(resp, http.StatusOK)
+					Expect(resp.Header().Get("X-RateLimit-Limit")).To(Equal("10"))
+					Expect(resp.Header().Get("X-RateLimit-Remaining")).To(Equal(strconv.Itoa(9 - i)))
+				}
+
+				resp := Post("/api/tokens/anonymous", "")
+				data = ParseJSON(resp, http.StatusTooManyRequests)
+				Expect(resp.Header().Get("Retry-After")).NotTo(BeEmpty())
+			})
+
+			It("rejects writes", func() {
+				resp := GetWithToken("/api/user/", user.ID)
+				data = ParseJSON(resp, http.StatusOK)
+
+				json := `{"user": {"bio": "foo"}}`
+				resp = PutWithToken("/api/user/", json, user.ID)
+				data = ParseJSON(resp, http.StatusForbidden)
+				Expect(data["code"]).To(Equal("READ_ONLY"))
+			})
+		})
+
 		Describe("currentUser", func() {
 			BeforeEach(func() {
 				resp := GetWithToken("/api/user/", user.ID)
@@ -93,7 +527,7 @@ var _ = Describe("createUser", func() {
 
 		Describe("updateUser", func() {
 			BeforeEach(func() {
-				json := `{"user": {"username": "hello","email": "foo@bar.com", "image": "bar", "bio": "foo"}}`
+				json := `{"user": {"username": "hello","email": "foo@bar.com", "image": "bar", "bio": "foo", "hideFromLeaderboard": true}}`
 				resp := PutWithToken("/api/user/", json, user.ID)
 				data = ParseJSON(resp, http.StatusOK)
 			})
@@ -107,6 +541,8 @@ var _ = Describe("createUser", func() {
 					"image":     Equal("bar"),
 					"token":     Not(BeEmpty()),
 					"following": Equal(false),
+
+					"hideFromLeaderboard": Equal(true),
 				}))
 			})
 		})
@@ -137,6 +573,7 @@ var _ = Describe("createUser", func() {
 					"username":  Equal("hello"),
 					"bio":       Equal(""),
 					"image":     Equal(""),
+					"verified":  Equal(false),
 					"following": Equal(true),
 				}))
 			})
@@ -154,6 +591,7 @@ var _ = Describe("createUser", func() {
 						"username":  Equal("hello"),
 						"bio":       Equal(""),
 						"image":     Equal(""),
+						"verified":  Equal(false),
 						"following": Equal(false),
 					}))
 				})
@@ -0,0 +1,131 @@
+package org
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+)
+
+const (
+	VerificationPending  = "pending"
+	VerificationApproved = "approved"
+	VerificationRejected = "rejected"
+)
+
+const (
+	maxEvidenceLength     = 2000
+	maxReviewNoteLength   = 500
+	verificationQueueSize = 100
+)
+
+var (
+	errAlreadyVerified = apperr.Validation("verification", "user is already verified")
+	errPendingRequest  = apperr.Validation("verification", "verification request is already pending")
+)
+
+// VerificationRequest asks admins to verify the author with the evidence,
+// e.g. links to other profiles of the author. Approved requests set
+// User.Verified, which is shown as a badge on the profile.
+type VerificationRequest struct {
+	tableName struct{} `pg:"verification_requests,alias:vr"`
+
+	ID       uint64 `json:"id"`
+	UserID   uint64 `json:"-"`
+	Username string `pg:"-" json:"username,omitempty"`
+
+	Evidence string `json:"evidence"`
+	Status   string `json:"status"`
+	// Note is the reason of the decision that is shown to the user.
+	Note       string `pg:",use_zero" json:"note"`
+	ReviewerID uint64 `json:"-"`
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	ReviewedAt *time.Time `json:"reviewedAt"`
+}
+
+// SelectVerificationRequest returns the latest request of the user or nil.
+func SelectVerificationRequest(ctx context.Context, user *User) (*VerificationRequest, error) {
+	vr := new(VerificationRequest)
+	if err := rwe.PGMain().ModelContext(ctx, vr).
+		Where("vr.user_id = ?", user.ID).
+		OrderExpr("vr.created_at DESC, vr.id DESC").
+		Limit(1).
+		Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	vr.Username = user.Username
+	return vr, nil
+}
+
+// SelectVerificationQueue returns requests with the status, oldest first, so
+// admins review pending requests in the order they were made.
+func SelectVerificationQueue(ctx context.Context, status string) ([]*VerificationRequest, error) {
+	requests := make([]*VerificationRequest, 0)
+	if err := rwe.PGMain().ModelContext(ctx, &requests).
+		ColumnExpr("vr.*").
+		ColumnExpr("u.username").
+		Join("JOIN users AS u ON u.id = vr.user_id").
+		Where("vr.status = ?", status).
+		OrderExpr("vr.created_at ASC, vr.id ASC").
+		Limit(verificationQueueSize).
+		Select(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// insertVerificationRequest saves the pending request. Users have at most one
+// pending request.
+func insertVerificationRequest(ctx context.Context, vr *VerificationRequest) error {
+	if _, err := rwe.PGMain().ModelContext(ctx, vr).Insert(); err != nil {
+		if pgErr, ok := err.(pg.Error); ok && pgErr.IntegrityViolation() {
+			return errPendingRequest
+		}
+		return err
+	}
+	return nil
+}
+
+// reviewVerificationRequest sets the status of the pending request and
+// verifies the user when the request is approved.
+func reviewVerificationRequest(ctx context.Context, vr *VerificationRequest) error {
+	if err := rwe.PGMainTx().RunInTransaction(ctx, func(tx *pg.Tx) error {
+		res, err := tx.ModelContext(ctx, vr).
+			Set("status = ?status").
+			Set("note = ?note").
+			Set("reviewer_id = ?reviewer_id").
+			Set("reviewed_at = ?reviewed_at").
+			Where("vr.id = ?id").
+			Where("vr.status = ?", VerificationPending).
+			Returning("*").
+			Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return apperr.New(apperr.NotFound, "verification request %d is not pending", vr.ID)
+		}
+
+		if vr.Status != VerificationApproved {
+			return nil
+		}
+
+		_, err = tx.ModelContext(ctx, (*User)(nil)).
+			Set("verified = true").
+			Where("id = ?", vr.UserID).
+			Update()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	// Profiles of the current user use the cached user.
+	return rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", vr.UserID))
+}
@@ -0,0 +1,168 @@
+package org
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/rwe"
+	"github.com/uptrace/go-realworld-example-app/textutil"
+	"github.com/vmihailenco/treemux"
+)
+
+func verificationHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := UserFromContext(ctx)
+
+	vr, err := SelectVerificationRequest(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"verified":     user.Verified,
+		"verification": vr,
+	})
+}
+
+func requestVerificationHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	user := UserFromContext(ctx)
+
+	var in struct {
+		Verification *struct {
+			Evidence string `json:"evidence"`
+		} `json:"verification"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Verification == nil {
+		return apperr.Required("verification")
+	}
+	if err := textutil.Text("evidence", &in.Verification.Evidence, maxEvidenceLength); err != nil {
+		return err
+	}
+	if strings.TrimSpace(in.Verification.Evidence) == "" {
+		return apperr.Validation("evidence", "evidence is required")
+	}
+
+	if user.Verified {
+		return errAlreadyVerified
+	}
+
+	vr := &VerificationRequest{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Evidence:  in.Verification.Evidence,
+		Status:    VerificationPending,
+		CreatedAt: rwe.Clock.Now(),
+	}
+	if err := insertVerificationRequest(ctx, vr); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"verification": vr,
+	})
+}
+
+//------------------------------------------------------------------------------
+
+// listVerificationsHandler returns the review queue, pending requests by
+// default or the requests with the ?status.
+func listVerificationsHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = VerificationPending
+	}
+
+	requests, err := SelectVerificationQueue(ctx, status)
+	if err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"verifications": requests,
+	})
+}
+
+func reviewVerificationHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	authUser := UserFromContext(ctx)
+
+	id, err := req.Params.Uint64("id")
+	if err != nil {
+		return err
+	}
+
+	var in struct {
+		Verification *struct {
+			Status string `json:"status"`
+			Note   string `json:"note"`
+		} `json:"verification"`
+	}
+
+	if err := httputil.UnmarshalJSON(w, req, &in, 10<<kb); err != nil {
+		return err
+	}
+
+	if in.Verification == nil {
+		return apperr.Required("verification")
+	}
+
+	switch in.Verification.Status {
+	case VerificationApproved, VerificationRejected:
+	default:
+		return apperr.Validation("status", "status must be %s or %s",
+			VerificationApproved, VerificationRejected)
+	}
+	if err := textutil.Text("note", &in.Verification.Note, maxReviewNoteLength); err != nil {
+		return err
+	}
+
+	now := rwe.Clock.Now()
+	vr := &VerificationRequest{
+		ID:         id,
+		Status:     in.Verification.Status,
+		Note:       in.Verification.Note,
+		ReviewerID: authUser.ID,
+		ReviewedAt: &now,
+	}
+	if err := reviewVerificationRequest(ctx, vr); err != nil {
+		return err
+	}
+
+	return httputil.JSON(w, treemux.H{
+		"verification": vr,
+	})
+}
+
+// revokeVerificationHandler removes the badge of the user. The user can
+// request verification again.
+func revokeVerificationHandler(w http.ResponseWriter, req treemux.Request) error {
+	ctx := req.Context()
+	username := req.Param("username")
+
+	user := new(User)
+	res, err := rwe.PGMain().
+		ModelContext(ctx, user).
+		Set("verified = false").
+		Where("username = ?", username).
+		Returning("id").
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return apperr.New(apperr.NotFound, "user %q does not exist", username)
+	}
+
+	return rwe.RedisCache().Delete(ctx, fmt.Sprintf("user:%d", user.ID))
+}
@@ -0,0 +1,99 @@
+package rwe
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// activityChannel is a single Redis channel with user ids as payloads. Per
+// user channels would be spread over the ring shards and would need a
+// subscription per shard.
+const activityChannel = "activity"
+
+// activityHub fans out messages of one Redis subscription per process to the
+// notification polls waiting on this instance.
+type activityHub struct {
+	startOnce sync.Once
+
+	mu   sync.Mutex
+	subs map[uint64]map[chan struct{}]struct{}
+}
+
+var hub = &activityHub{
+	subs: make(map[uint64]map[chan struct{}]struct{}),
+}
+
+// PublishActivity wakes up notification polls of the users on all instances.
+// Call it after the transaction that writes the activity commits. Errors are
+// only logged because polls still query the database every poll interval.
+func PublishActivity(ctx context.Context, userIDs ...uint64) {
+	for _, id := range userIDs {
+		if err := RedisRing().Publish(ctx, activityChannel, id).Err(); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("PublishActivity failed")
+		}
+	}
+}
+
+// SubscribeActivity returns a channel that receives a value when there is new
+// activity for the user. The returned func must be called to unsubscribe.
+func SubscribeActivity(userID uint64) (<-chan struct{}, func()) {
+	hub.startOnce.Do(hub.start)
+	return hub.subscribe(userID)
+}
+
+func (h *activityHub) start() {
+	pubsub := RedisRing().Subscribe(Ctx, activityChannel)
+
+	go func() {
+		<-ExitCh
+		_ = pubsub.Close()
+	}()
+
+	go func() {
+		// The channel reconnects after Redis errors and is closed with pubsub.
+		for msg := range pubsub.Channel() {
+			id, err := strconv.ParseUint(msg.Payload, 10, 64)
+			if err != nil {
+				continue
+			}
+			h.notify(id)
+		}
+	}()
+}
+
+func (h *activityHub) subscribe(userID uint64) (<-chan struct{}, func()) {
+	// A buffer of one remembers activity that arrives between queries.
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan struct{}]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[userID], ch)
+		if len(h.subs[userID]) == 0 {
+			delete(h.subs, userID)
+		}
+	}
+}
+
+func (h *activityHub) notify(userID uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package rwe
+
+import "testing"
+
+func TestActivityHub(t *testing.T) {
+	h := &activityHub{
+		subs: make(map[uint64]map[chan struct{}]struct{}),
+	}
+
+	ch1, unsub1 := h.subscribe(1)
+	ch2, unsub2 := h.subscribe(1)
+	other, unsubOther := h.subscribe(2)
+	defer unsubOther()
+
+	// Notifications are coalesced and never block when nobody reads.
+	h.notify(1)
+	h.notify(1)
+	for i, ch := range []<-chan struct{}{ch1, ch2} {
+		if len(ch) != 1 {
+			t.Fatalf("subscriber %d: got %d notifications, wanted 1", i, len(ch))
+		}
+		<-ch
+	}
+	if len(other) != 0 {
+		t.Fatalf("user 2 got a notification of user 1")
+	}
+
+	unsub1()
+	h.notify(1)
+	if len(ch1) != 0 || len(ch2) != 1 {
+		t.Fatalf("got %d and %d notifications, wanted 0 and 1", len(ch1), len(ch2))
+	}
+
+	unsub2()
+	if _, ok := h.subs[1]; ok {
+		t.Fatalf("subscribers of user 1 are not removed")
+	}
+}
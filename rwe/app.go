@@ -48,6 +48,7 @@ func Init(ctx context.Context, cfg *xconfig.Config) context.Context {
 	rand.Seed(uint64(time.Now().UnixNano()))
 	mathRand.Seed(time.Now().UnixNano())
 
+	ctx = JobContext(ctx)
 	Config = cfg
 	Ctx = ctx
 
@@ -144,6 +145,31 @@ func WaitExitSignal() os.Signal {
 	return <-ch
 }
 
+// FeatureEnabled reports whether the feature flag is turned on in the config.
+func FeatureEnabled(name string) bool {
+	return Config.Features[name]
+}
+
+// FeatureFlags returns the flags from the features section of the config.
+func FeatureFlags() map[string]bool {
+	flags := make(map[string]bool, len(Config.Features))
+	for name, on := range Config.Features {
+		flags[name] = on
+	}
+	return flags
+}
+
+const defaultCountThreshold = 1000
+
+// CountThreshold returns how many rows the endpoint counts exactly before
+// falling back to an estimate.
+func CountThreshold(endpoint string) int {
+	if n, ok := Config.CountThresholds[endpoint]; ok {
+		return n
+	}
+	return defaultCountThreshold
+}
+
 func IsDebug() bool {
 	switch Config.Env {
 	case "prod":
@@ -0,0 +1,308 @@
+package rwe
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/xcontext"
+	"github.com/vmihailenco/treemux"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Phases of a request that are timed against the latency budget. Phases can
+// overlap, for example auth includes the query that loads the user, and
+// concurrent queries are summed.
+const (
+	PhaseAuth      = "auth"
+	PhaseDB        = "db"
+	PhaseSerialize = "serialize"
+)
+
+var budgetKey = xcontext.NewKey("latency_budget")
+
+var budgetExceeded = metric.Must(global.Meter("github.com/uptrace/go-treemux-realworld-example-app")).
+	NewInt64Counter("http.server.latency_budget.exceeded",
+		metric.WithDescription("Requests that took longer than the latency budget of the route"))
+
+// BudgetStats reports how well a route keeps its latency budget since the
+// process started. Phases are mean durations per request.
+type BudgetStats struct {
+	BudgetMs  float64            `json:"budgetMs"`
+	Requests  uint64             `json:"requests"`
+	Exceeded  uint64             `json:"exceeded"`
+	Adherence float64            `json:"adherence"`
+	MeanMs    float64            `json:"meanMs"`
+	PhasesMs  map[string]float64 `json:"phasesMs"`
+}
+
+type budgetTracker struct {
+	mu       sync.Mutex
+	budget   time.Duration
+	requests uint64
+	exceeded uint64
+	total    time.Duration
+	phases   map[string]time.Duration
+}
+
+func (t *budgetTracker) record(budget, dur time.Duration, phases map[string]time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.budget = budget
+	t.requests++
+	if dur > budget {
+		t.exceeded++
+	}
+	t.total += dur
+	for phase, d := range phases {
+		t.phases[phase] += d
+	}
+}
+
+func (t *budgetTracker) stats() *BudgetStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := &BudgetStats{
+		BudgetMs:  durationMs(t.budget),
+		Requests:  t.requests,
+		Exceeded:  t.exceeded,
+		Adherence: 1,
+		PhasesMs:  make(map[string]float64, len(t.phases)),
+	}
+	if t.requests == 0 {
+		return stats
+	}
+
+	n := float64(t.requests)
+	stats.Adherence = 1 - float64(t.exceeded)/n
+	stats.MeanMs = durationMs(t.total) / n
+	for phase, d := range t.phases {
+		stats.PhasesMs[phase] = durationMs(d) / n
+	}
+	return stats
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+var (
+	budgetMu       sync.RWMutex
+	budgetTrackers = make(map[string]*budgetTracker)
+)
+
+func getBudgetTracker(route string) *budgetTracker {
+	budgetMu.RLock()
+	t, ok := budgetTrackers[route]
+	budgetMu.RUnlock()
+	if ok {
+		return t
+	}
+
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+
+	if t, ok := budgetTrackers[route]; ok {
+		return t
+	}
+	t = &budgetTracker{phases: make(map[string]time.Duration)}
+	budgetTrackers[route] = t
+	return t
+}
+
+// BudgetStatuses returns the stats of every route with a latency budget that
+// has served requests. Routes are keyed by the method and the pattern.
+func BudgetStatuses() map[string]*BudgetStats {
+	budgetMu.RLock()
+	defer budgetMu.RUnlock()
+
+	m := make(map[string]*BudgetStats, len(budgetTrackers))
+	for route, t := range budgetTrackers {
+		m[route] = t.stats()
+	}
+	return m
+}
+
+//------------------------------------------------------------------------------
+
+// budgetTimer collects the phase durations of a request.
+type budgetTimer struct {
+	start time.Time
+
+	mu     sync.Mutex
+	budget time.Duration
+	phases map[string]time.Duration
+	open   map[string]time.Time
+}
+
+func budgetTimerFromContext(ctx context.Context) *budgetTimer {
+	t, _ := budgetKey.Value(ctx).(*budgetTimer)
+	return t
+}
+
+func (t *budgetTimer) setBudget(budget time.Duration) {
+	t.mu.Lock()
+	t.budget = budget
+	t.mu.Unlock()
+}
+
+func (t *budgetTimer) begin(phase string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.open[phase] = time.Now()
+	t.mu.Unlock()
+}
+
+// end stops the phase started with begin and does nothing when the phase is
+// already stopped.
+func (t *budgetTimer) end(phase string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if start, ok := t.open[phase]; ok {
+		t.phases[phase] += time.Since(start)
+		delete(t.open, phase)
+	}
+	t.mu.Unlock()
+}
+
+func (t *budgetTimer) add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.phases[phase] += d
+	t.mu.Unlock()
+}
+
+func (t *budgetTimer) snapshot() (time.Duration, map[string]time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	phases := make(map[string]time.Duration, len(t.phases))
+	for phase, d := range t.phases {
+		phases[phase] = d
+	}
+	return t.budget, phases
+}
+
+// budgetMiddleware times API requests and records the routes that declare a
+// budget with LatencyBudget.
+func budgetMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		timer := &budgetTimer{
+			start:  time.Now(),
+			phases: make(map[string]time.Duration),
+			open:   make(map[string]time.Time),
+		}
+		ctx := budgetKey.With(req.Context(), timer)
+
+		err := next(w, req.WithContext(ctx))
+		dur := time.Since(timer.start)
+
+		budget, phases := timer.snapshot()
+		if budget == 0 {
+			return err
+		}
+
+		route := req.Method + " " + req.Route()
+		getBudgetTracker(route).record(budget, dur, phases)
+
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(
+			label.Int64("latency_budget.budget_ms", budget.Milliseconds()),
+			label.Bool("latency_budget.exceeded", dur > budget),
+		)
+		for phase, d := range phases {
+			span.SetAttributes(label.Int64("latency_budget."+phase+"_ms", d.Milliseconds()))
+		}
+
+		if dur > budget {
+			budgetExceeded.Add(ctx, 1,
+				label.String("http.method", req.Method),
+				label.String("http.route", req.Route()))
+
+			fields := logrus.Fields{
+				"route":    route,
+				"budget":   budget,
+				"duration": dur,
+			}
+			for phase, d := range phases {
+				fields[phase] = d
+			}
+			logrus.WithContext(ctx).WithFields(fields).Warn("request exceeded latency budget")
+		}
+
+		return err
+	}
+}
+
+// LatencyBudget declares how long requests of the route are expected to take.
+// The budget covers the whole API middleware chain, so routes can add it after
+// the auth middleware.
+func LatencyBudget(budget time.Duration) treemux.MiddlewareFunc {
+	return func(next treemux.HandlerFunc) treemux.HandlerFunc {
+		return func(w http.ResponseWriter, req treemux.Request) error {
+			if t := budgetTimerFromContext(req.Context()); t != nil {
+				t.setBudget(budget)
+			}
+			return next(w, req)
+		}
+	}
+}
+
+// TimedMiddleware reports the time spent in the middleware as the phase. The
+// handlers called by the middleware are not included.
+func TimedMiddleware(phase string, mw treemux.MiddlewareFunc) treemux.MiddlewareFunc {
+	return func(next treemux.HandlerFunc) treemux.HandlerFunc {
+		h := mw(func(w http.ResponseWriter, req treemux.Request) error {
+			budgetTimerFromContext(req.Context()).end(phase)
+			return next(w, req)
+		})
+		return func(w http.ResponseWriter, req treemux.Request) error {
+			t := budgetTimerFromContext(req.Context())
+			t.begin(phase)
+			err := h(w, req)
+			t.end(phase)
+			return err
+		}
+	}
+}
+
+// JSON writes the value like httputil.JSON and reports encoding and writing it
+// as the serialize phase.
+func JSON(w http.ResponseWriter, req treemux.Request, value interface{}) error {
+	t := budgetTimerFromContext(req.Context())
+	t.begin(PhaseSerialize)
+	defer t.end(PhaseSerialize)
+
+	return httputil.JSON(w, value)
+}
+
+//------------------------------------------------------------------------------
+
+// budgetHook adds the time spent in queries to the db phase.
+type budgetHook struct{}
+
+var _ pg.QueryHook = (*budgetHook)(nil)
+
+func (budgetHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (budgetHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	budgetTimerFromContext(ctx).add(PhaseDB, time.Since(evt.StartTime))
+	return nil
+}
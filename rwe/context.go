@@ -0,0 +1,73 @@
+package rwe
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/go-realworld-example-app/xcontext"
+)
+
+var jobKey = xcontext.NewKey("job")
+
+// JobContext marks ctx as belonging to a background job or command rather than
+// to an HTTP request. Queries using such a context are not required to be
+// cancelable.
+func JobContext(ctx context.Context) context.Context {
+	return jobKey.With(ctx, true)
+}
+
+func isJobContext(ctx context.Context) bool {
+	return jobKey.Value(ctx) != nil
+}
+
+// DetachedContext returns a job context that keeps the values of ctx, for
+// example, the trace span, but is not canceled together with ctx. Use it for
+// work that is shared by several requests and should not fail when one of the
+// clients goes away.
+func DetachedContext(ctx context.Context) context.Context {
+	return JobContext(detachedContext{parent: ctx})
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+//------------------------------------------------------------------------------
+
+// ErrQueryWithoutContext is returned in tests for queries that neither use
+// the request context nor an explicit job context.
+var ErrQueryWithoutContext = errors.New("rwe: query does not use request or job context")
+
+// contextHook catches queries that can't be canceled because they were built
+// with Model or Exec instead of ModelContext or ExecContext.
+type contextHook struct{}
+
+var _ pg.QueryHook = (*contextHook)(nil)
+
+func (contextHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	if ctx.Done() != nil || isJobContext(ctx) {
+		return ctx, nil
+	}
+
+	if Config.Env == "test" {
+		return ctx, ErrQueryWithoutContext
+	}
+
+	query, _ := evt.UnformattedQuery()
+	logrus.WithContext(ctx).
+		WithField("query", string(query)).
+		Warn(ErrQueryWithoutContext.Error())
+	return ctx, nil
+}
+
+func (contextHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	return nil
+}
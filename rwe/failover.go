@@ -0,0 +1,308 @@
+package rwe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/go-realworld-example-app/xconfig"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultMaxFailures         = 3
+	// poolCloseDelay lets queries that already use a connection of the
+	// replaced pool finish before it is closed.
+	poolCloseDelay = 30 * time.Second
+)
+
+// PoolStats reports a database pool and the times it was replaced.
+type PoolStats struct {
+	TotalConns uint32 `json:"totalConns"`
+	IdleConns  uint32 `json:"idleConns"`
+	Timeouts   uint32 `json:"timeouts"`
+
+	HealthChecks uint64 `json:"healthChecks"`
+	Failures     uint64 `json:"failures"`
+	AddrChanges  uint64 `json:"addrChanges"`
+	Resets       uint64 `json:"resets"`
+
+	LastResetAt    time.Time `json:"lastResetAt"`
+	LastResetCause string    `json:"lastResetCause"`
+}
+
+// failoverDB is a pool that is replaced when the database fails over. The
+// pool keeps connections to the old primary, which either fail or, when the
+// old primary became a replica, reject writes. A new pool dials the host of
+// the DSN again, so it connects to the address the host resolves to now.
+//
+// The pool is replaced after MaxFailures consecutive queries failed with a
+// connection error, or when the health check sees that the host resolves to
+// other addresses. A successful health check resets the failure count.
+type failoverDB struct {
+	name    string
+	cfg     *xconfig.Postgres
+	usePool bool
+
+	interval    time.Duration
+	maxFailures uint32
+
+	db        atomic.Value // *pg.DB
+	failures  uint32
+	resetting uint32
+
+	mu     sync.Mutex
+	addrs  []string
+	closed bool
+
+	stats PoolStats
+}
+
+var (
+	failoverDBsMu sync.Mutex
+	failoverDBs   []*failoverDB
+)
+
+func newFailoverDB(name string, cfg *xconfig.Postgres, usePool bool) *failoverDB {
+	f := &failoverDB{
+		name:        name,
+		cfg:         cfg,
+		usePool:     usePool,
+		interval:    cfg.HealthCheckInterval,
+		maxFailures: uint32(cfg.MaxFailures),
+	}
+	if f.interval == 0 {
+		f.interval = defaultHealthCheckInterval
+	}
+	if f.maxFailures == 0 {
+		f.maxFailures = defaultMaxFailures
+	}
+
+	f.db.Store(f.connect())
+	f.addrs, _ = f.lookupHost(Ctx)
+
+	failoverDBsMu.Lock()
+	failoverDBs = append(failoverDBs, f)
+	failoverDBsMu.Unlock()
+
+	go f.run()
+
+	OnExitSecondary(func(ctx context.Context) {
+		f.mu.Lock()
+		f.closed = true
+		f.mu.Unlock()
+
+		if err := f.DB().Close(); err != nil {
+			logrus.WithError(err).Error("pg.Close failed")
+		}
+	})
+
+	return f
+}
+
+func (f *failoverDB) DB() *pg.DB {
+	return f.db.Load().(*pg.DB)
+}
+
+func (f *failoverDB) connect() *pg.DB {
+	db := newPostgres(f.cfg, f.usePool)
+	db.AddQueryHook(failoverHook{f: f, db: db})
+	addShadowHook(db)
+	return db
+}
+
+// lookupHost returns the sorted addresses of the DSN host or nil when the
+// DSN uses an IP address.
+func (f *failoverDB) lookupHost(ctx context.Context) ([]string, error) {
+	host, _, err := net.SplitHostPort(pgAddr(f.cfg, f.usePool))
+	if err != nil || host == "" || net.ParseIP(host) != nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.interval)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func (f *failoverDB) run() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ExitCh:
+			return
+		case <-ticker.C:
+			f.healthCheck()
+		}
+	}
+}
+
+func (f *failoverDB) healthCheck() {
+	atomic.AddUint64(&f.stats.HealthChecks, 1)
+
+	addrs, err := f.lookupHost(Ctx)
+	if err != nil {
+		logrus.WithError(err).WithField("db", f.name).Warn("postgres host lookup failed")
+	} else if f.addrsChanged(addrs) {
+		atomic.AddUint64(&f.stats.AddrChanges, 1)
+		f.reset("host resolves to " + strings.Join(addrs, ", "))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(Ctx, f.interval)
+	defer cancel()
+
+	// The hook counts the failure.
+	if err := f.DB().Ping(ctx); err == nil {
+		atomic.StoreUint32(&f.failures, 0)
+	}
+}
+
+func (f *failoverDB) addrsChanged(addrs []string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.addrs == nil {
+		f.addrs = addrs
+		return false
+	}
+	return strings.Join(addrs, ",") != strings.Join(f.addrs, ",")
+}
+
+func (f *failoverDB) fail(err error) {
+	atomic.AddUint64(&f.stats.Failures, 1)
+	if atomic.AddUint32(&f.failures, 1) < f.maxFailures {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&f.resetting, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreUint32(&f.resetting, 0)
+		f.reset(err.Error())
+	}()
+}
+
+// reset replaces the pool. While the database is down the pool is replaced at
+// most once per health check interval.
+func (f *failoverDB) reset(cause string) {
+	addrs, _ := f.lookupHost(Ctx)
+
+	f.mu.Lock()
+	if f.closed || time.Since(f.stats.LastResetAt) < f.interval {
+		f.mu.Unlock()
+		return
+	}
+
+	old := f.DB()
+	f.db.Store(f.connect())
+	f.addrs = addrs
+	atomic.StoreUint32(&f.failures, 0)
+	f.stats.LastResetAt = time.Now()
+	f.stats.LastResetCause = cause
+	f.mu.Unlock()
+
+	atomic.AddUint64(&f.stats.Resets, 1)
+	logrus.WithField("db", f.name).WithField("cause", cause).Warn("postgres pool replaced")
+
+	time.AfterFunc(poolCloseDelay, func() {
+		if err := old.Close(); err != nil {
+			logrus.WithError(err).Error("pg.Close failed")
+		}
+	})
+}
+
+func (f *failoverDB) Stats() *PoolStats {
+	pool := f.DB().PoolStats()
+
+	f.mu.Lock()
+	lastResetAt := f.stats.LastResetAt
+	lastResetCause := f.stats.LastResetCause
+	f.mu.Unlock()
+
+	return &PoolStats{
+		TotalConns: pool.TotalConns,
+		IdleConns:  pool.IdleConns,
+		Timeouts:   pool.Timeouts,
+
+		HealthChecks: atomic.LoadUint64(&f.stats.HealthChecks),
+		Failures:     atomic.LoadUint64(&f.stats.Failures),
+		AddrChanges:  atomic.LoadUint64(&f.stats.AddrChanges),
+		Resets:       atomic.LoadUint64(&f.stats.Resets),
+
+		LastResetAt:    lastResetAt,
+		LastResetCause: lastResetCause,
+	}
+}
+
+// PoolStatuses returns the stats of the database pools by name.
+func PoolStatuses() map[string]*PoolStats {
+	failoverDBsMu.Lock()
+	defer failoverDBsMu.Unlock()
+
+	m := make(map[string]*PoolStats, len(failoverDBs))
+	for _, f := range failoverDBs {
+		m[f.name] = f.Stats()
+	}
+	return m
+}
+
+//------------------------------------------------------------------------------
+
+// failoverHook counts failed queries of the pool. Queries of a replaced pool
+// are ignored.
+type failoverHook struct {
+	f  *failoverDB
+	db *pg.DB
+}
+
+var _ pg.QueryHook = (*failoverHook)(nil)
+
+func (h failoverHook) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h failoverHook) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	if isFailoverError(evt.Err) && h.f.DB() == h.db {
+		h.f.fail(evt.Err)
+	}
+	return nil
+}
+
+// isFailoverError reports whether the error means that the connection is
+// broken or goes to a server that is no longer the primary.
+func isFailoverError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		code := pgErr.Field('C')
+		switch {
+		case strings.HasPrefix(code, "08"), // connection_exception
+			strings.HasPrefix(code, "57P"), // admin_shutdown, cannot_connect_now
+			code == "25006":                // read_only_sql_transaction
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
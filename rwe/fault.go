@@ -0,0 +1,102 @@
+package rwe
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/vmihailenco/treemux"
+)
+
+// Fault is injected into a percentage of API requests whose path starts with
+// Path. It is used to test how clients retry and degrade. Faults are kept in
+// memory and apply only to the instance that received them.
+type Fault struct {
+	Path      string  `json:"path"`
+	Percent   float64 `json:"percent"`
+	LatencyMS int     `json:"latencyMs"`
+	// Status is the error status to respond with, for example, 500 or 503.
+	// Zero adds only the latency.
+	Status int `json:"status"`
+	// Drop closes the connection without sending a response.
+	Drop bool `json:"drop"`
+}
+
+func (f *Fault) Validate() error {
+	if !strings.HasPrefix(f.Path, "/api/") {
+		return apperr.Validation("path", "path must start with /api/")
+	}
+	if strings.HasPrefix(f.Path, faultExemptPath) {
+		return apperr.Validation("path", "admin endpoints can't have faults")
+	}
+	if f.Percent <= 0 || f.Percent > 100 {
+		return apperr.Validation("percent", "percent must be in range (0, 100]")
+	}
+	if f.LatencyMS < 0 || f.LatencyMS > 30000 {
+		return apperr.Validation("latencyMs", "latencyMs must be in range [0, 30000]")
+	}
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return apperr.Validation("status", "status must be an error status")
+	}
+	return nil
+}
+
+// faultExemptPath keeps admin endpoints working so faults can be removed.
+const faultExemptPath = "/api/admin/"
+
+var faults atomic.Value // []*Fault
+
+// Faults returns the faults injected into API requests.
+func Faults() []*Fault {
+	list, _ := faults.Load().([]*Fault)
+	if list == nil {
+		list = make([]*Fault, 0)
+	}
+	return list
+}
+
+// SetFaults replaces the injected faults. Empty list disables injection.
+func SetFaults(list []*Fault) {
+	faults.Store(list)
+}
+
+func faultMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		list, _ := faults.Load().([]*Fault)
+		if len(list) == 0 || strings.HasPrefix(req.URL.Path, faultExemptPath) {
+			return next(w, req)
+		}
+
+		for _, f := range list {
+			if !strings.HasPrefix(req.URL.Path, f.Path) || rand.Float64()*100 >= f.Percent {
+				continue
+			}
+
+			if f.LatencyMS > 0 {
+				select {
+				case <-time.After(time.Duration(f.LatencyMS) * time.Millisecond):
+				case <-req.Context().Done():
+					return req.Context().Err()
+				}
+			}
+			if f.Drop {
+				// net/http closes the connection and doesn't log the panic.
+				panic(http.ErrAbortHandler)
+			}
+			if f.Status != 0 {
+				w.WriteHeader(f.Status)
+				return httputil.JSON(w, treemux.H{
+					"code":    apperr.Internal,
+					"message": "injected fault",
+				})
+			}
+			break
+		}
+
+		return next(w, req)
+	}
+}
@@ -0,0 +1,191 @@
+package rwe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// jobLease is how long a claimed job is hidden from other workers. A job
+	// that runs longer can run twice, so jobs must be idempotent.
+	jobLease        = 10 * time.Minute
+	jobPollInterval = time.Second
+	maxJobAttempts  = 5
+)
+
+// JobFunc runs the job with the arguments it was enqueued with.
+type JobFunc func(ctx context.Context, args json.RawMessage) error
+
+var jobFuncs = make(map[string]JobFunc)
+
+// RegisterJob makes the job available to EnqueueJob and the job worker.
+func RegisterJob(name string, fn JobFunc) {
+	if _, ok := jobFuncs[name]; ok {
+		panic(fmt.Errorf("job %q is already registered", name))
+	}
+	jobFuncs[name] = fn
+}
+
+// Job is a row of the jobs table. Jobs are deleted when they succeed. Failed
+// jobs are retried with a backoff and are kept with FailedAt set after
+// maxJobAttempts.
+type Job struct {
+	tableName struct{} `pg:"jobs,alias:j"`
+
+	ID        uint64
+	Name      string
+	Args      json.RawMessage `pg:"type:jsonb"`
+	Attempts  int             `pg:",use_zero"`
+	LastError string
+
+	RunAt       time.Time
+	LockedUntil time.Time
+	FailedAt    time.Time
+	CreatedAt   time.Time
+}
+
+// EnqueueJob saves the job to run it in the background. Pass the transaction
+// as db so the job is enqueued only when the transaction commits.
+func EnqueueJob(ctx context.Context, db orm.DB, name string, args interface{}) (*Job, error) {
+	if _, ok := jobFuncs[name]; !ok {
+		return nil, fmt.Errorf("job %q is not registered", name)
+	}
+
+	b, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		Name:      name,
+		Args:      b,
+		RunAt:     Clock.Now(),
+		CreatedAt: Clock.Now(),
+	}
+	if _, err := db.ModelContext(ctx, job).Insert(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// StartJobWorker runs due jobs in the background until the app exits.
+func StartJobWorker(ctx context.Context) {
+	WaitGroup.Add(1)
+	go func() {
+		defer WaitGroup.Done()
+
+		for {
+			if _, err := RunJobs(ctx); err != nil {
+				logrus.WithContext(ctx).WithError(err).Error("RunJobs failed")
+			}
+
+			select {
+			case <-ExitCh:
+				return
+			case <-time.After(jobPollInterval):
+			}
+		}
+	}()
+}
+
+// RunJobs runs due jobs one by one until there are none left and returns the
+// number of jobs that were run. Failed jobs are rescheduled and don't stop
+// the other jobs.
+func RunJobs(ctx context.Context) (int, error) {
+	ctx = JobContext(ctx)
+
+	var n int
+	for Running() {
+		job, err := claimJob(ctx)
+		if err == pg.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if err := finishJob(ctx, job, runJob(ctx, job)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// claimJob locks the next due job for jobLease. SKIP LOCKED lets several
+// workers claim different jobs.
+func claimJob(ctx context.Context) (*Job, error) {
+	now := Clock.Now()
+
+	due := PGMain().ModelContext(ctx, (*Job)(nil)).
+		Column("id").
+		Where("run_at <= ?", now).
+		Where("locked_until IS NULL OR locked_until <= ?", now).
+		Where("failed_at IS NULL").
+		OrderExpr("run_at, id").
+		Limit(1).
+		For("UPDATE SKIP LOCKED")
+
+	job := new(Job)
+	if _, err := PGMain().ModelContext(ctx, job).
+		Set("locked_until = ?", now.Add(jobLease)).
+		Set("attempts = attempts + 1").
+		Where("id = (?)", due).
+		Returning("*").
+		Update(); err != nil {
+		return nil, err
+	}
+	if job.ID == 0 {
+		return nil, pg.ErrNoRows
+	}
+	return job, nil
+}
+
+func runJob(ctx context.Context, job *Job) (err error) {
+	fn, ok := jobFuncs[job.Name]
+	if !ok {
+		return fmt.Errorf("job %q is not registered", job.Name)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("job %q panicked: %v", job.Name, v)
+		}
+	}()
+	return fn(ctx, job.Args)
+}
+
+// finishJob deletes the job that succeeded or schedules a retry.
+func finishJob(ctx context.Context, job *Job, jobErr error) error {
+	if jobErr == nil {
+		_, err := PGMain().ModelContext(ctx, job).WherePK().Delete()
+		return err
+	}
+
+	logrus.WithContext(ctx).
+		WithField("job", job.Name).
+		WithField("id", job.ID).
+		WithField("attempts", job.Attempts).
+		WithError(jobErr).
+		Error("job failed")
+
+	q := PGMain().ModelContext(ctx, job).
+		Set("last_error = ?", jobErr.Error()).
+		Set("locked_until = NULL").
+		WherePK()
+	if job.Attempts >= maxJobAttempts {
+		q = q.Set("failed_at = ?", Clock.Now())
+	} else {
+		// 1, 4, 9, 16 minutes.
+		backoff := time.Duration(job.Attempts*job.Attempts) * time.Minute
+		q = q.Set("run_at = ?", Clock.Now().Add(backoff))
+	}
+	_, err := q.Update()
+	return err
+}
@@ -0,0 +1,47 @@
+package rwe
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/uptrace/go-realworld-example-app/jsonschema"
+)
+
+var metadataSchema struct {
+	sync.RWMutex
+	schema *jsonschema.Schema
+}
+
+func init() {
+	OnInit(func(ctx context.Context) {
+		path := Config.Articles.MetadataSchema
+		if path == "" {
+			return
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(Config.AppDir, path)
+		}
+
+		schema, err := jsonschema.Load(path)
+		if err != nil {
+			panic(err)
+		}
+		SetArticleMetadataSchema(schema)
+	})
+}
+
+// ArticleMetadataSchema returns the schema of article metadata or nil when
+// the deployment accepts any metadata.
+func ArticleMetadataSchema() *jsonschema.Schema {
+	metadataSchema.RLock()
+	defer metadataSchema.RUnlock()
+	return metadataSchema.schema
+}
+
+// SetArticleMetadataSchema replaces the schema, e.g. in tests.
+func SetArticleMetadataSchema(schema *jsonschema.Schema) {
+	metadataSchema.Lock()
+	metadataSchema.schema = schema
+	metadataSchema.Unlock()
+}
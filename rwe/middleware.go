@@ -0,0 +1,117 @@
+package rwe
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/uptrace/go-realworld-example-app/httputil"
+	"github.com/uptrace/go-realworld-example-app/xcontext"
+	"github.com/vmihailenco/treemux"
+)
+
+// Middleware is a named middleware with ordering constraints. Middlewares
+// listed first wrap the ones listed after them.
+type Middleware struct {
+	Name string
+	Func treemux.MiddlewareFunc
+
+	// After names middlewares that must wrap this one.
+	After []string
+	// Before names middlewares that this one must wrap.
+	Before []string
+}
+
+// MiddlewareChain is an ordered list of middlewares. A group chain continues
+// the chain of its parent, so constraints can refer to router middlewares.
+type MiddlewareChain struct {
+	parent *MiddlewareChain
+	list   []Middleware
+	pos    map[string]int
+}
+
+// NewMiddlewareChain checks the constraints and panics when they are violated,
+// so a misordered chain fails at startup instead of subtly at runtime.
+func NewMiddlewareChain(parent *MiddlewareChain, list ...Middleware) *MiddlewareChain {
+	c := &MiddlewareChain{
+		parent: parent,
+		list:   list,
+		pos:    make(map[string]int),
+	}
+
+	offset := 0
+	if parent != nil {
+		for name, i := range parent.pos {
+			c.pos[name] = i
+		}
+		offset = len(parent.pos)
+	}
+
+	for i, m := range list {
+		if _, ok := c.pos[m.Name]; ok {
+			panic(fmt.Errorf("rwe: middleware %s is registered twice", m.Name))
+		}
+		c.pos[m.Name] = offset + i
+	}
+
+	for i, m := range list {
+		i += offset
+		for _, name := range m.After {
+			if c.position(m, name) > i {
+				panic(fmt.Errorf("rwe: middleware %s must come after %s", m.Name, name))
+			}
+		}
+		for _, name := range m.Before {
+			if c.position(m, name) < i {
+				panic(fmt.Errorf("rwe: middleware %s must come before %s", m.Name, name))
+			}
+		}
+	}
+
+	return c
+}
+
+func (c *MiddlewareChain) position(m Middleware, name string) int {
+	i, ok := c.pos[name]
+	if !ok {
+		panic(fmt.Errorf("rwe: middleware %s refers to unknown middleware %s", m.Name, name))
+	}
+	return i
+}
+
+// Options returns the router or group options for the chain's own middlewares.
+func (c *MiddlewareChain) Options() []treemux.Option {
+	opts := make([]treemux.Option, len(c.list))
+	for i, m := range c.list {
+		opts[i] = treemux.WithMiddleware(m.Func)
+	}
+	return opts
+}
+
+//------------------------------------------------------------------------------
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMiddleware keeps the request id set by the proxy or generates one
+// and returns it in the response so clients can quote it in bug reports.
+func requestIDMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		id := req.Header.Get(requestIDHeader)
+		if httputil.Token(id) != nil {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := xcontext.WithRequestID(req.Context(), id)
+		return next(w, req.WithContext(ctx))
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+package rwe
+
+import (
+	"testing"
+
+	"github.com/vmihailenco/treemux"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	noop := func(next treemux.HandlerFunc) treemux.HandlerFunc { return next }
+
+	tests := []struct {
+		name  string
+		list  []Middleware
+		panic bool
+	}{
+		{"ordered", []Middleware{
+			{Name: "a", Func: noop},
+			{Name: "b", Func: noop, After: []string{"a"}, Before: []string{"c"}},
+			{Name: "c", Func: noop},
+		}, false},
+		{"after", []Middleware{
+			{Name: "a", Func: noop, After: []string{"b"}},
+			{Name: "b", Func: noop},
+		}, true},
+		{"before", []Middleware{
+			{Name: "a", Func: noop},
+			{Name: "b", Func: noop, Before: []string{"a"}},
+		}, true},
+		{"unknown", []Middleware{
+			{Name: "a", Func: noop, After: []string{"x"}},
+		}, true},
+		{"twice", []Middleware{
+			{Name: "a", Func: noop},
+			{Name: "a", Func: noop},
+		}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != test.panic {
+					t.Fatalf("got panic %v, wanted panic %v", r, test.panic)
+				}
+			}()
+			NewMiddlewareChain(nil, test.list...)
+		})
+	}
+}
+
+// TestAPIMiddleware rebuilds the chains of the router so a misordered
+// middleware fails the test and not only the startup.
+func TestAPIMiddleware(t *testing.T) {
+	router := NewMiddlewareChain(nil, routerMiddleware.list...)
+	api := NewMiddlewareChain(router, apiMiddleware.list...)
+
+	for _, name := range []string{"error", "budget", "fault"} {
+		if _, ok := api.pos[name]; !ok {
+			t.Fatalf("middleware %s is missing", name)
+		}
+	}
+	if api.pos["budget"] > api.pos["fault"] {
+		t.Fatal("budget must wrap fault so injected latency counts against the budget")
+	}
+}
@@ -14,26 +14,28 @@ import (
 
 var (
 	pgMainOnce sync.Once
-	pgMain     *pg.DB
+	pgMain     *failoverDB
 )
 
+// PGMain returns the current pool of the main database. The pool is replaced
+// on failover, so callers should not keep it.
 func PGMain() *pg.DB {
 	pgMainOnce.Do(func() {
-		pgMain = NewPostgres(Config.PGMain, hasPgbouncer())
+		pgMain = newFailoverDB("main", Config.PGMain, hasPgbouncer())
 	})
-	return pgMain
+	return pgMain.DB()
 }
 
 var (
 	pgMainTxOnce sync.Once
-	pgMainTx     *pg.DB
+	pgMainTx     *failoverDB
 )
 
 func PGMainTx() *pg.DB {
 	pgMainTxOnce.Do(func() {
-		pgMainTx = NewPostgres(Config.PGMain, false)
+		pgMainTx = newFailoverDB("main_tx", Config.PGMain, false)
 	})
-	return pgMainTx
+	return pgMainTx.DB()
 }
 
 func hasPgbouncer() bool {
@@ -46,22 +48,23 @@ func hasPgbouncer() bool {
 }
 
 func NewPostgres(cfg *xconfig.Postgres, usePool bool) *pg.DB {
-	addr := cfg.Addr
-	if usePool {
-		addr = replacePort(addr, cfg.ConnectionPoolPort)
-	}
-
-	opt := cfg.Options()
-	opt.Addr = addr
-
-	db := pg.Connect(opt)
+	db := newPostgres(cfg, usePool)
 	OnExitSecondary(func(ctx context.Context) {
 		if err := db.Close(); err != nil {
 			logrus.WithError(err).Error("pg.Close failed")
 		}
 	})
+	return db
+}
 
+func newPostgres(cfg *xconfig.Postgres, usePool bool) *pg.DB {
+	opt := cfg.Options()
+	opt.Addr = pgAddr(cfg, usePool)
+
+	db := pg.Connect(opt)
 	db.AddQueryHook(pgotel.TracingHook{})
+	db.AddQueryHook(contextHook{})
+	db.AddQueryHook(budgetHook{})
 	if IsDebug() {
 		db.AddQueryHook(pgdebug.DebugHook{})
 	}
@@ -69,6 +72,13 @@ func NewPostgres(cfg *xconfig.Postgres, usePool bool) *pg.DB {
 	return db
 }
 
+func pgAddr(cfg *xconfig.Postgres, usePool bool) string {
+	if usePool {
+		return replacePort(cfg.Addr, cfg.ConnectionPoolPort)
+	}
+	return cfg.Addr
+}
+
 func replacePort(s, newPort string) string {
 	if newPort == "" {
 		return s
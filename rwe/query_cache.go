@@ -0,0 +1,48 @@
+package rwe
+
+import (
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// QueryCache keeps SQL generated by the query builder so hot paths build and
+// format every query shape only once. Builders must reference params with
+// positional placeholders like ?0 and ?1 that are bound on every execution.
+type QueryCache struct {
+	queries sync.Map
+}
+
+// Compile returns the SQL cached for the query shape identified by key or
+// generates it with build.
+func (c *QueryCache) Compile(key string, build func() (string, error)) (string, error) {
+	if query, ok := c.queries.Load(key); ok {
+		return query.(string), nil
+	}
+
+	query, err := build()
+	if err != nil {
+		return "", err
+	}
+
+	c.queries.Store(key, query)
+	return query, nil
+}
+
+// FormatSelect returns the SQL of the select query. Positional placeholders
+// are kept in the SQL because there are no params to bind.
+func FormatSelect(db *pg.DB, q *orm.Query) (string, error) {
+	selq := orm.NewSelectQuery(q)
+
+	var fmter orm.QueryFormatter = db.Formatter()
+	if f, ok := fmter.(*orm.Formatter); ok {
+		fmter = f.WithModel(selq)
+	}
+
+	b, err := selq.AppendQuery(fmter, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
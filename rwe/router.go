@@ -1,11 +1,17 @@
 package rwe
 
 import (
-	"errors"
+	"context"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis_rate/v9"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/httputil"
 	"github.com/uptrace/go-realworld-example-app/httputil/httperror"
 	"github.com/vmihailenco/treemux"
 	"github.com/vmihailenco/treemux/extra/reqlog"
@@ -16,20 +22,58 @@ import (
 var (
 	Router *treemux.TreeMux
 	API    *treemux.Group
+	// Internal routes are called by other services, e.g. the analytics
+	// pipeline, and accept only signed requests.
+	Internal *treemux.Group
 )
 
-func init() {
-	Router = treemux.New(
-		treemux.WithMiddleware(treemuxgzip.NewMiddleware()),
-		treemux.WithMiddleware(treemuxotel.NewMiddleware()),
-		treemux.WithMiddleware(reqlog.NewMiddleware()),
-		treemux.WithMiddleware(errorHandler),
-	)
+// statusClientClosedRequest is the nginx status for requests canceled by the client.
+const statusClientClosedRequest = 499
+
+var routeParams = httputil.RouteParams{
+	"slug":     httputil.Slug,
+	"id":       httputil.ID,
+	"username": httputil.Name,
+	"token":    httputil.Token,
+}
 
-	API = Router.NewGroup("/api",
-		treemux.WithMiddleware(corsMiddleware),
-		treemux.WithMiddleware(rateLimitMiddleware),
+var (
+	routerMiddleware = NewMiddlewareChain(nil,
+		Middleware{Name: "zstd", Func: httputil.ZstdMiddleware, Before: []string{"gzip"}},
+		Middleware{Name: "gzip", Func: treemuxgzip.NewMiddleware()},
+		// The flusher is remembered before reqlog hides it and flushes the
+		// compressed data too.
+		Middleware{Name: "flush", Func: httputil.FlushMiddleware, After: []string{"zstd", "gzip"}},
+		Middleware{Name: "otel", Func: treemuxotel.NewMiddleware()},
+		Middleware{Name: "request_id", Func: requestIDMiddleware},
+		Middleware{Name: "reqlog", Func: reqlog.NewMiddleware(), After: []string{"otel"}},
+		// SLOs see the status written by the error handler.
+		Middleware{Name: "slo", Func: sloMiddleware, Before: []string{"error"}},
+		Middleware{Name: "error", Func: errorHandler},
+		Middleware{Name: "route_params", Func: routeParams.Middleware, After: []string{"error"}},
+	)
+	apiMiddleware = NewMiddlewareChain(routerMiddleware,
+		Middleware{Name: "cors", Func: corsMiddleware, After: []string{"error"}},
+		Middleware{Name: "rate_limit", Func: rateLimitMiddleware, After: []string{"cors"}},
+		// Injected latency counts against the budget.
+		Middleware{Name: "budget", Func: budgetMiddleware, After: []string{"error"}, Before: []string{"fault"}},
+		Middleware{Name: "fault", Func: faultMiddleware, After: []string{"error", "slo"}},
 	)
+)
+
+func init() {
+	Router = treemux.New(routerMiddleware.Options()...)
+
+	OnInit(func(ctx context.Context) {
+		httputil.SetJSONOptions(httputil.JSONOptions{
+			SnakeCase: Config.JSON.Naming == "snake_case",
+			OmitNulls: Config.JSON.OmitNulls,
+		})
+		SetObjectives(Config.SLO.Objectives)
+	})
+
+	API = Router.NewGroup("/api", apiMiddleware.Options()...)
+	Internal = API.NewGroup("/internal", treemux.WithMiddleware(SignedMiddleware))
 }
 
 func errorHandler(next treemux.HandlerFunc) treemux.HandlerFunc {
@@ -39,11 +83,17 @@ func errorHandler(next treemux.HandlerFunc) treemux.HandlerFunc {
 			return nil
 		}
 
+		if req.Context().Err() != nil {
+			// The client has gone away and nobody reads the response.
+			w.WriteHeader(statusClientClosedRequest)
+			return err
+		}
+
 		httpErr := httperror.From(err)
 		if httpErr.Status != 0 {
 			w.WriteHeader(httpErr.Status)
 		}
-		_ = treemux.JSON(w, httpErr)
+		_ = httputil.JSON(w, httpErr)
 
 		return err
 	}
@@ -81,7 +131,7 @@ func rateLimitMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
 			return next(w, req)
 		}
 
-		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		host, err := ClientIP(req.Request)
 		if err != nil {
 			return err
 		}
@@ -91,10 +141,43 @@ func rateLimitMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
 		if err != nil {
 			return err
 		}
+		SetRateLimitHeaders(w.Header(), res)
 		if res.Allowed == 0 {
-			return errors.New("rate limited")
+			return apperr.New(apperr.RateLimited, "rate limited")
 		}
 
 		return next(w, req)
 	}
 }
+
+// ClientIP returns the address of the client for rate limits.
+func ClientIP(req *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	return host, err
+}
+
+// SetRateLimitHeaders reports the limiter state so clients can throttle
+// themselves before they are rate limited. Limiters applied later in the chain
+// overwrite the headers because they are more specific.
+func SetRateLimitHeaders(h http.Header, res *redis_rate.Result) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit.Rate))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(res.ResetAfter).Unix(), 10))
+	if res.Allowed == 0 {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+}
+
+// SiteURL returns the public URL of the site without a trailing slash.
+// It falls back to the request host when site_url is not configured.
+func SiteURL(req *http.Request) string {
+	if Config.SiteURL != "" {
+		return strings.TrimSuffix(Config.SiteURL, "/")
+	}
+
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
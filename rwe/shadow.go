@@ -0,0 +1,396 @@
+package rwe
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-pg/pg/extra/pgotel"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/rand"
+)
+
+const (
+	defaultShadowQueueSize = 1000
+	// maxLoggedQueryLen truncates queries in mismatch logs.
+	maxLoggedQueryLen = 500
+)
+
+// ShadowStats counts the queries mirrored to the shadow database.
+type ShadowStats struct {
+	Writes     uint64 `json:"writes"`
+	Reads      uint64 `json:"reads"`
+	Mismatches uint64 `json:"mismatches"`
+	Errors     uint64 `json:"errors"`
+	Dropped    uint64 `json:"dropped"`
+}
+
+// shadowQuery is a query that succeeded on the main database together with
+// the number of rows it affected or returned there.
+type shadowQuery struct {
+	query []byte
+	rows  int
+	read  bool
+}
+
+// shadowDB mirrors writes of the main database to the shadow database and
+// repeats a sample of reads there. A single worker applies the queries in the
+// order they completed on the main database. Statements of a transaction are
+// kept until it commits and are applied together in a shadow transaction.
+type shadowDB struct {
+	db    *pg.DB
+	queue chan []shadowQuery
+
+	mu     sync.Mutex
+	txs    map[*pg.Tx][]shadowQuery
+	closed bool
+
+	stats ShadowStats
+}
+
+var (
+	shadowOnce sync.Once
+	shadow     *shadowDB
+)
+
+func shadowEnabled() bool {
+	return Config.Shadow.PG != nil
+}
+
+func pgShadow() *shadowDB {
+	shadowOnce.Do(func() {
+		cfg := Config.Shadow.PG
+		opt := cfg.Options()
+		opt.Addr = cfg.Addr
+
+		db := pg.Connect(opt)
+		db.AddQueryHook(pgotel.TracingHook{})
+
+		size := Config.Shadow.QueueSize
+		if size == 0 {
+			size = defaultShadowQueueSize
+		}
+
+		shadow = &shadowDB{
+			db:    db,
+			queue: make(chan []shadowQuery, size),
+			txs:   make(map[*pg.Tx][]shadowQuery),
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			shadow.run(Ctx)
+		}()
+
+		// Apply the queued queries before the databases are closed.
+		OnExit(func(ctx context.Context) {
+			shadow.mu.Lock()
+			shadow.closed = true
+			close(shadow.queue)
+			shadow.mu.Unlock()
+			<-done
+		})
+		OnExitSecondary(func(ctx context.Context) {
+			if err := db.Close(); err != nil {
+				logrus.WithError(err).Error("pg.Close failed")
+			}
+		})
+	})
+	return shadow
+}
+
+// addShadowHook mirrors the queries of the main database in shadow mode.
+func addShadowHook(db *pg.DB) {
+	if shadowEnabled() {
+		db.AddQueryHook(pgShadow())
+	}
+}
+
+// ShadowStatuses returns the counters of shadow mode or nil when it is disabled.
+func ShadowStatuses() *ShadowStats {
+	if !shadowEnabled() {
+		return nil
+	}
+	s := pgShadow()
+	return &ShadowStats{
+		Writes:     atomic.LoadUint64(&s.stats.Writes),
+		Reads:      atomic.LoadUint64(&s.stats.Reads),
+		Mismatches: atomic.LoadUint64(&s.stats.Mismatches),
+		Errors:     atomic.LoadUint64(&s.stats.Errors),
+		Dropped:    atomic.LoadUint64(&s.stats.Dropped),
+	}
+}
+
+//------------------------------------------------------------------------------
+
+var _ pg.QueryHook = (*shadowDB)(nil)
+
+func (s *shadowDB) BeforeQuery(ctx context.Context, evt *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (s *shadowDB) AfterQuery(ctx context.Context, evt *pg.QueryEvent) error {
+	tx, inTx := evt.DB.(*pg.Tx)
+
+	if evt.Err != nil {
+		// The transaction is aborted, so even COMMIT rolls it back.
+		if inTx {
+			s.discard(tx)
+		}
+		return nil
+	}
+
+	query, err := evt.FormattedQuery()
+	if err != nil {
+		return nil
+	}
+
+	if !inTx {
+		tx = nil
+	}
+	s.record(tx, query, evt.Result)
+	return nil
+}
+
+// record mirrors the successful query. The tx is nil for queries outside of
+// transactions.
+func (s *shadowDB) record(tx *pg.Tx, query []byte, res pg.Result) {
+	switch classifyQuery(query) {
+	case shadowCommit:
+		if tx != nil {
+			s.enqueue(s.discard(tx))
+		}
+	case shadowRollback:
+		if tx != nil {
+			s.discard(tx)
+		}
+	case shadowWrite:
+		q := shadowQuery{
+			// The query is in a pooled buffer that is reused after the hook.
+			query: append([]byte(nil), query...),
+			rows:  res.RowsAffected(),
+		}
+		if tx != nil {
+			s.mu.Lock()
+			s.txs[tx] = append(s.txs[tx], q)
+			s.mu.Unlock()
+		} else {
+			s.enqueue([]shadowQuery{q})
+		}
+	case shadowRead:
+		if tx != nil || rand.Float64() >= Config.Shadow.CompareReads {
+			return
+		}
+		s.enqueue([]shadowQuery{{
+			query: append([]byte(nil), query...),
+			rows:  res.RowsReturned(),
+			read:  true,
+		}})
+	}
+}
+
+func (s *shadowDB) discard(tx *pg.Tx) []shadowQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := s.txs[tx]
+	delete(s.txs, tx)
+	return batch
+}
+
+// enqueue never blocks the request: when the shadow database falls behind the
+// batch is dropped and the shadow data must be backfilled again.
+func (s *shadowDB) enqueue(batch []shadowQuery) {
+	if len(batch) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		atomic.AddUint64(&s.stats.Dropped, uint64(len(batch)))
+		return
+	}
+	select {
+	case s.queue <- batch:
+	default:
+		atomic.AddUint64(&s.stats.Dropped, uint64(len(batch)))
+	}
+}
+
+type shadowKind int
+
+const (
+	shadowIgnore shadowKind = iota
+	shadowRead
+	shadowWrite
+	shadowCommit
+	shadowRollback
+)
+
+// classifyQuery tells how the query is mirrored. Queries with a WITH clause
+// are writes when any of the statements changes rows, e.g.
+// WITH moved AS (DELETE ... RETURNING *) INSERT ..., and reads otherwise.
+func classifyQuery(query []byte) shadowKind {
+	switch queryVerb(query) {
+	case "COMMIT":
+		return shadowCommit
+	case "ROLLBACK":
+		return shadowRollback
+	case "INSERT", "UPDATE", "DELETE":
+		return shadowWrite
+	case "SELECT":
+		return shadowRead
+	case "WITH":
+		if modifiesRows(query) {
+			return shadowWrite
+		}
+		return shadowRead
+	default:
+		return shadowIgnore
+	}
+}
+
+func queryVerb(query []byte) string {
+	query = bytes.TrimSpace(query)
+	if i := bytes.IndexAny(query, " \n\t("); i >= 0 {
+		query = query[:i]
+	}
+	return string(bytes.ToUpper(query))
+}
+
+// modifiesRows reports whether the query has INSERT, UPDATE, or DELETE
+// keywords outside of literals, quoted identifiers, and comments. Locking
+// clauses like FOR UPDATE and FOR NO KEY UPDATE don't change rows.
+func modifiesRows(query []byte) bool {
+	var prev string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// Doubled quotes are escapes and are skipped as two literals.
+			end := bytes.IndexByte(query[i+1:], c)
+			if end == -1 {
+				return false
+			}
+			i += end + 2
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := bytes.IndexByte(query[i:], '\n')
+			if end == -1 {
+				return false
+			}
+			i += end + 1
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := bytes.Index(query[i+2:], []byte("*/"))
+			if end == -1 {
+				return false
+			}
+			i += end + 4
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			word := string(bytes.ToUpper(query[start:i]))
+			switch word {
+			case "INSERT", "DELETE":
+				return true
+			case "UPDATE":
+				if prev != "FOR" && prev != "KEY" {
+					return true
+				}
+			}
+			prev = word
+		default:
+			i++
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+//------------------------------------------------------------------------------
+
+func (s *shadowDB) run(ctx context.Context) {
+	for batch := range s.queue {
+		if len(batch) == 1 {
+			s.apply(ctx, s.db, batch[0])
+			continue
+		}
+
+		if err := s.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+			for _, q := range batch {
+				if err := s.apply(ctx, tx, q); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("shadow transaction failed")
+		}
+	}
+}
+
+func (s *shadowDB) apply(ctx context.Context, db orm.DB, q shadowQuery) error {
+	var res pg.Result
+	var err error
+	var rows int
+
+	if q.read {
+		atomic.AddUint64(&s.stats.Reads, 1)
+		res, err = db.QueryContext(ctx, pg.Discard, rawQuery(q.query))
+		if err == nil {
+			rows = res.RowsReturned()
+		}
+	} else {
+		atomic.AddUint64(&s.stats.Writes, 1)
+		res, err = db.ExecContext(ctx, rawQuery(q.query))
+		if err == nil {
+			rows = res.RowsAffected()
+		}
+	}
+
+	if err != nil {
+		atomic.AddUint64(&s.stats.Errors, 1)
+		logrus.WithContext(ctx).
+			WithError(err).
+			WithField("query", truncateQuery(q.query)).
+			Warn("shadow query failed")
+		return err
+	}
+
+	if rows != q.rows {
+		atomic.AddUint64(&s.stats.Mismatches, 1)
+		logrus.WithContext(ctx).
+			WithField("query", truncateQuery(q.query)).
+			WithField("main_rows", q.rows).
+			WithField("shadow_rows", rows).
+			Warn("shadow query mismatch")
+	}
+	return nil
+}
+
+// rawQuery is an already formatted query. Passing it as a string would format
+// it again and treat question marks in values as placeholders.
+type rawQuery []byte
+
+var _ orm.QueryAppender = (rawQuery)(nil)
+
+func (q rawQuery) AppendQuery(fmter orm.QueryFormatter, b []byte) ([]byte, error) {
+	return append(b, q...), nil
+}
+
+func truncateQuery(query []byte) string {
+	if len(query) > maxLoggedQueryLen {
+		return string(query[:maxLoggedQueryLen]) + "..."
+	}
+	return string(query)
+}
@@ -0,0 +1,148 @@
+package rwe
+
+import (
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/uptrace/go-realworld-example-app/xconfig"
+)
+
+func TestClassifyQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		kind  shadowKind
+	}{
+		{"SELECT * FROM articles", shadowRead},
+		{"  select(1)", shadowRead},
+		{"SELECT * FROM articles FOR UPDATE", shadowRead},
+		{"INSERT INTO articles DEFAULT VALUES", shadowWrite},
+		{"UPDATE articles SET title = 'x'", shadowWrite},
+		{"DELETE FROM articles", shadowWrite},
+		{"COMMIT", shadowCommit},
+		{"ROLLBACK", shadowRollback},
+		{"BEGIN", shadowIgnore},
+		{"SET LOCAL statement_timeout = 0", shadowIgnore},
+
+		{"WITH a AS (SELECT id FROM articles) SELECT * FROM a", shadowRead},
+		{"WITH\n\ta AS (SELECT 1) SELECT * FROM a", shadowRead},
+		{"WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t) SELECT * FROM t", shadowRead},
+		{"WITH a AS (SELECT id FROM articles) SELECT * FROM a FOR UPDATE", shadowRead},
+		{"WITH a AS (SELECT id FROM articles) SELECT * FROM a FOR NO KEY UPDATE", shadowRead},
+		{"WITH a AS (SELECT id, deleted_at, updated_at FROM articles) SELECT * FROM a", shadowRead},
+		{"WITH a AS (SELECT 'delete from articles' AS s) SELECT * FROM a", shadowRead},
+		{`WITH a AS (SELECT 1 AS "insert") SELECT * FROM a`, shadowRead},
+		{"WITH a AS (SELECT 'it''s' AS s) SELECT * FROM a", shadowRead},
+		{"WITH a AS (SELECT 1) -- update later\nSELECT * FROM a", shadowRead},
+		{"WITH a AS (SELECT 1) /* DELETE */ SELECT * FROM a", shadowRead},
+
+		{"WITH moved AS (DELETE FROM a RETURNING *) INSERT INTO b SELECT * FROM moved", shadowWrite},
+		{"WITH a AS (SELECT id FROM articles) UPDATE articles SET title = 'x' FROM a", shadowWrite},
+		{"WITH a AS (UPDATE articles SET title = 'x' RETURNING id) SELECT * FROM a", shadowWrite},
+		{"WITH a AS (SELECT 'it''s' AS s) insert INTO b SELECT * FROM a", shadowWrite},
+	}
+
+	for _, test := range tests {
+		if got := classifyQuery([]byte(test.query)); got != test.kind {
+			t.Errorf("%q: got %d, wanted %d", test.query, got, test.kind)
+		}
+	}
+}
+
+type shadowResult struct {
+	affected int
+	returned int
+}
+
+var _ pg.Result = (*shadowResult)(nil)
+
+func (r *shadowResult) Model() orm.Model  { return nil }
+func (r *shadowResult) RowsAffected() int { return r.affected }
+func (r *shadowResult) RowsReturned() int { return r.returned }
+
+func newTestShadowDB(size int) *shadowDB {
+	return &shadowDB{
+		queue: make(chan []shadowQuery, size),
+		txs:   make(map[*pg.Tx][]shadowQuery),
+	}
+}
+
+func TestShadowReadSampling(t *testing.T) {
+	saved := Config
+	Config = new(xconfig.Config)
+	defer func() { Config = saved }()
+
+	const n = 1000
+	res := &shadowResult{returned: 3}
+	query := []byte("WITH a AS (SELECT 1) SELECT * FROM a")
+
+	tests := []struct {
+		compareReads float64
+		min, max     int
+	}{
+		{0, 0, 0},
+		{1, n, n},
+		{0.25, 150, 350},
+	}
+
+	for _, test := range tests {
+		Config.Shadow.CompareReads = test.compareReads
+		s := newTestShadowDB(n)
+
+		for i := 0; i < n; i++ {
+			s.record(nil, query, res)
+		}
+		if got := len(s.queue); got < test.min || got > test.max {
+			t.Errorf("compare_reads=%v: got %d sampled reads, wanted %d..%d",
+				test.compareReads, got, test.min, test.max)
+		}
+
+		if got := len(s.queue); got > 0 {
+			q := (<-s.queue)[0]
+			if !q.read || q.rows != 3 {
+				t.Errorf("got %+v, wanted a read with 3 rows", q)
+			}
+		}
+	}
+
+	// Reads in transactions see uncommitted writes, so they are not compared.
+	Config.Shadow.CompareReads = 1
+	s := newTestShadowDB(1)
+	tx := new(pg.Tx)
+	s.record(tx, query, res)
+	s.record(tx, []byte("COMMIT"), res)
+	if len(s.queue) != 0 {
+		t.Errorf("got %d queued batches, wanted 0", len(s.queue))
+	}
+}
+
+func TestShadowWrites(t *testing.T) {
+	s := newTestShadowDB(1)
+	res := &shadowResult{affected: 2}
+
+	tx := new(pg.Tx)
+	s.record(tx, []byte("WITH a AS (DELETE FROM b RETURNING *) INSERT INTO c SELECT * FROM a"), res)
+	s.record(tx, []byte("UPDATE c SET x = 1"), res)
+	if len(s.queue) != 0 {
+		t.Fatalf("writes are queued before COMMIT")
+	}
+
+	s.record(tx, []byte("COMMIT"), res)
+	batch := <-s.queue
+	if len(batch) != 2 || batch[0].read || batch[0].rows != 2 {
+		t.Fatalf("got %+v, wanted 2 writes", batch)
+	}
+
+	s.record(tx, []byte("DELETE FROM c"), res)
+	s.record(tx, []byte("ROLLBACK"), res)
+	if len(s.queue) != 0 || len(s.txs) != 0 {
+		t.Fatalf("rolled back writes are queued")
+	}
+
+	// The queue is full, so the second write is dropped.
+	s.record(nil, []byte("DELETE FROM c"), res)
+	s.record(nil, []byte("DELETE FROM c"), res)
+	if len(s.queue) != 1 || s.stats.Dropped != 1 {
+		t.Fatalf("got %d queued and %d dropped, wanted 1 and 1", len(s.queue), s.stats.Dropped)
+	}
+}
@@ -0,0 +1,107 @@
+package rwe
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/vmihailenco/treemux"
+)
+
+// Headers of signed server-to-server requests.
+const (
+	SignatureKeyHeader       = "X-Signature-Key"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureHeader          = "X-Signature"
+)
+
+// signatureWindow is how far the request timestamp may be from the server
+// time. Signatures are remembered for twice as long to reject replays.
+const signatureWindow = 5 * time.Minute
+
+const maxSignedBodySize = 1 << 20
+
+var errInvalidSignature = apperr.New(apperr.Unauthorized, "request signature is invalid")
+
+// Signature returns the HMAC-SHA256 signature of the request with the
+// timestamp in Unix seconds. The uri is the path with the query, so query
+// params can't be changed either. Callers send the signature in
+// SignatureHeader together with the key id and the timestamp.
+func Signature(secret, method, uri string, timestamp int64, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("\n" + method + "\n" + uri + "\n"))
+	mac.Write([]byte(hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignPayload returns the HMAC-SHA256 signature of a document, for example,
+// an account export, that is verified by another instance sharing the secret.
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyPayload checks the signature of the document with the signing key.
+func VerifyPayload(keyID string, payload []byte, signature string) error {
+	secret, ok := Config.SigningKeys[keyID]
+	if !ok || secret == "" {
+		return apperr.New(apperr.Unauthorized, "signing key is unknown")
+	}
+	if !hmac.Equal([]byte(SignPayload(secret, payload)), []byte(signature)) {
+		return apperr.New(apperr.Unauthorized, "signature is invalid")
+	}
+	return nil
+}
+
+// SignedMiddleware accepts only requests signed with one of the signing_keys
+// from the config. It protects the Internal routes called by other services
+// rather than by users.
+func SignedMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		secret, ok := Config.SigningKeys[req.Header.Get(SignatureKeyHeader)]
+		if !ok || secret == "" {
+			return apperr.New(apperr.Unauthorized, "request signing key is unknown")
+		}
+
+		timestamp, err := strconv.ParseInt(req.Header.Get(SignatureTimestampHeader), 10, 64)
+		if err != nil {
+			return apperr.New(apperr.Unauthorized, "request signature timestamp is malformed")
+		}
+		if d := time.Since(time.Unix(timestamp, 0)); d > signatureWindow || d < -signatureWindow {
+			return apperr.New(apperr.Unauthorized, "request signature has expired")
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxSignedBodySize))
+		if err != nil {
+			return apperr.New(apperr.RequestTooLarge, "request body is too large")
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		want := Signature(secret, req.Method, req.URL.RequestURI(), timestamp, body)
+		got := req.Header.Get(SignatureHeader)
+		if !hmac.Equal([]byte(want), []byte(got)) {
+			return errInvalidSignature
+		}
+
+		ctx := req.Context()
+		fresh, err := RedisRing().SetNX(ctx, "sig:"+got, 1, 2*signatureWindow).Result()
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return apperr.New(apperr.Unauthorized, "request signature was already used")
+		}
+
+		return next(w, req)
+	}
+}
@@ -0,0 +1,295 @@
+package rwe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uptrace/go-realworld-example-app/xconfig"
+	"github.com/vmihailenco/treemux"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+)
+
+const (
+	sloLongWindow  = time.Hour
+	sloShortWindow = 5 * time.Minute
+	sloBuckets     = int(sloLongWindow / time.Minute)
+
+	defaultBurnRate = 14.4
+)
+
+// SLOStatus reports how fast an objective spends its error budget over the
+// last hour. Burn rate 1 spends the budget exactly within the SLO period.
+type SLOStatus struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+
+	Availability         float64 `json:"availability"`
+	AvailabilityBurnRate float64 `json:"availabilityBurnRate"`
+	LatencyBurnRate      float64 `json:"latencyBurnRate"`
+}
+
+type sloBucket struct {
+	minute int64
+	total  int
+	errors int
+	slow   int
+}
+
+type sloTracker struct {
+	obj *xconfig.Objective
+
+	mu        sync.Mutex
+	buckets   [sloBuckets]sloBucket
+	checkedAt time.Time
+	alertedAt time.Time
+}
+
+func (t *sloTracker) record(now time.Time, status int, dur time.Duration) {
+	minute := now.Unix() / 60
+	b := &t.buckets[minute%int64(sloBuckets)]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+
+	b.total++
+	if status >= 500 {
+		b.errors++
+	}
+	if t.obj.Latency > 0 && dur > t.obj.Latency {
+		b.slow++
+	}
+}
+
+func (t *sloTracker) sum(now time.Time, window time.Duration) sloBucket {
+	var sum sloBucket
+	since := now.Add(-window).Unix() / 60
+	for _, b := range t.buckets {
+		if b.minute > since {
+			sum.total += b.total
+			sum.errors += b.errors
+			sum.slow += b.slow
+		}
+	}
+	return sum
+}
+
+func (t *sloTracker) status(now time.Time, window time.Duration) *SLOStatus {
+	sum := t.sum(now, window)
+	status := &SLOStatus{
+		Name:         t.obj.Name,
+		Requests:     sum.total,
+		Availability: 1,
+	}
+	if sum.total == 0 {
+		return status
+	}
+
+	errorRatio := float64(sum.errors) / float64(sum.total)
+	status.Availability = 1 - errorRatio
+	status.AvailabilityBurnRate = burnRate(errorRatio, t.obj.Availability)
+	status.LatencyBurnRate = burnRate(float64(sum.slow)/float64(sum.total), t.obj.LatencyTarget)
+	return status
+}
+
+func (s *SLOStatus) burnRate() float64 {
+	if s.LatencyBurnRate > s.AvailabilityBurnRate {
+		return s.LatencyBurnRate
+	}
+	return s.AvailabilityBurnRate
+}
+
+func burnRate(badRatio, target float64) float64 {
+	if target <= 0 || target >= 1 {
+		return 0
+	}
+	return badRatio / (1 - target)
+}
+
+// shouldAlert checks the objective once a minute. Both windows must burn too
+// fast so a short spike doesn't alert and a resolved incident stops alerting.
+func (t *sloTracker) shouldAlert(now time.Time, threshold float64) (*SLOStatus, bool) {
+	if now.Sub(t.checkedAt) < time.Minute || now.Sub(t.alertedAt) < sloLongWindow {
+		return nil, false
+	}
+	t.checkedAt = now
+
+	status := t.status(now, sloLongWindow)
+	if status.burnRate() < threshold || t.status(now, sloShortWindow).burnRate() < threshold {
+		return nil, false
+	}
+	t.alertedAt = now
+	return status, true
+}
+
+//------------------------------------------------------------------------------
+
+var (
+	sloMu       sync.RWMutex
+	sloTrackers []*sloTracker
+)
+
+// SetObjectives replaces tracked objectives and discards collected stats.
+func SetObjectives(objectives []*xconfig.Objective) {
+	trackers := make([]*sloTracker, len(objectives))
+	for i, obj := range objectives {
+		trackers[i] = &sloTracker{obj: obj}
+	}
+
+	sloMu.Lock()
+	sloTrackers = trackers
+	sloMu.Unlock()
+}
+
+func objectives() []*sloTracker {
+	sloMu.RLock()
+	defer sloMu.RUnlock()
+	return sloTrackers
+}
+
+// sloBurnRateGauge reports the burn rates of every objective over both alert
+// windows, so dashboards can alert without polling /api/admin/slo.
+var sloBurnRateGauge = metric.Must(global.Meter("github.com/uptrace/go-treemux-realworld-example-app")).
+	NewFloat64ValueObserver("slo.burn_rate", observeBurnRates,
+		metric.WithDescription("How fast the objective spends its error budget, 1 spends it within the SLO period"))
+
+func observeBurnRates(ctx context.Context, result metric.Float64ObserverResult) {
+	now := Clock.Now()
+	windows := []struct {
+		name string
+		dur  time.Duration
+	}{
+		{"1h", sloLongWindow},
+		{"5m", sloShortWindow},
+	}
+
+	for _, t := range objectives() {
+		for _, window := range windows {
+			t.mu.Lock()
+			status := t.status(now, window.dur)
+			t.mu.Unlock()
+
+			objective := label.String("slo", status.Name)
+			win := label.String("window", window.name)
+			result.Observe(status.AvailabilityBurnRate,
+				objective, win, label.String("indicator", "availability"))
+			result.Observe(status.LatencyBurnRate,
+				objective, win, label.String("indicator", "latency"))
+		}
+	}
+}
+
+// SLOStatuses returns the status of every objective over the last hour.
+func SLOStatuses() []*SLOStatus {
+	now := Clock.Now()
+	trackers := objectives()
+
+	statuses := make([]*SLOStatus, len(trackers))
+	for i, t := range trackers {
+		t.mu.Lock()
+		statuses[i] = t.status(now, sloLongWindow)
+		t.mu.Unlock()
+	}
+	return statuses
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// sloMiddleware must be used before errorHandler to see the status of errors.
+func sloMiddleware(next treemux.HandlerFunc) treemux.HandlerFunc {
+	return func(w http.ResponseWriter, req treemux.Request) error {
+		trackers := objectives()
+		if len(trackers) == 0 {
+			return next(w, req)
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		err := next(rec, req)
+		dur := time.Since(start)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		now := Clock.Now()
+		for _, t := range trackers {
+			if !strings.HasPrefix(req.URL.Path, t.obj.Prefix) {
+				continue
+			}
+
+			t.mu.Lock()
+			t.record(now, status, dur)
+			alert, ok := t.shouldAlert(now, sloBurnRate())
+			t.mu.Unlock()
+
+			if ok {
+				go sendSLOAlert(DetachedContext(req.Context()), alert)
+			}
+		}
+
+		return err
+	}
+}
+
+func sloBurnRate() float64 {
+	if Config.SLO.BurnRate > 0 {
+		return Config.SLO.BurnRate
+	}
+	return defaultBurnRate
+}
+
+var sloAlertClient = &http.Client{Timeout: 5 * time.Second}
+
+func sendSLOAlert(ctx context.Context, status *SLOStatus) {
+	logrus.WithContext(ctx).
+		WithField("objective", status.Name).
+		WithField("availability", status.Availability).
+		Warnf("SLO is burning error budget %.1fx too fast", status.burnRate())
+
+	if Config.SLO.WebhookURL == "" {
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"objective": status,
+		"burnRate":  status.burnRate(),
+		"threshold": sloBurnRate(),
+	})
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("json.Marshal failed")
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, Config.SLO.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("SLO alert request failed")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sloAlertClient.Do(req)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("SLO alert webhook failed")
+		return
+	}
+	_ = resp.Body.Close()
+}
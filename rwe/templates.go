@@ -0,0 +1,26 @@
+package rwe
+
+import (
+	"html/template"
+	"path/filepath"
+)
+
+var templates *template.Template
+
+// ParseTemplates parses HTML templates from the app/templates dir. It is called
+// on startup so a broken template stops the server instead of failing the
+// first request that renders a page.
+func ParseTemplates() error {
+	pattern := filepath.Join(Config.AppDir, "templates", "*.html")
+	t, err := template.ParseGlob(pattern)
+	if err != nil {
+		return err
+	}
+	templates = t
+	return nil
+}
+
+// Templates returns the templates parsed by ParseTemplates.
+func Templates() *template.Template {
+	return templates
+}
@@ -0,0 +1,223 @@
+package rwe
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"github.com/uptrace/go-realworld-example-app/xconfig"
+	"github.com/vmihailenco/treemux"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+)
+
+// Classes of expensive endpoints limited by ThrottleMiddleware.
+const (
+	ThrottleSearch = "search"
+	ThrottleExport = "export"
+	ThrottleImport = "import"
+)
+
+// defaultThrottles keep a burst of heavy requests from taking all database
+// connections, so the rest of the API keeps working.
+var defaultThrottles = map[string]xconfig.Throttle{
+	ThrottleSearch: {Concurrency: 16, QueueSize: 32, MaxWait: time.Second},
+	ThrottleExport: {Concurrency: 4, QueueSize: 8, MaxWait: 2 * time.Second},
+	ThrottleImport: {Concurrency: 2, QueueSize: 4, MaxWait: 2 * time.Second},
+}
+
+var throttleRejected = metric.Must(global.Meter("github.com/uptrace/go-treemux-realworld-example-app")).
+	NewInt64Counter("http.server.throttle.rejected",
+		metric.WithDescription("Requests rejected because the endpoint class was saturated"))
+
+// throttleQueued reports the queue depth of every endpoint class, so
+// dashboards can alert before requests are rejected.
+var throttleQueued = metric.Must(global.Meter("github.com/uptrace/go-treemux-realworld-example-app")).
+	NewInt64ValueObserver("http.server.throttle.queued", observeThrottleQueues,
+		metric.WithDescription("Requests waiting for a slot of the endpoint class"))
+
+func observeThrottleQueues(ctx context.Context, result metric.Int64ObserverResult) {
+	for class, stats := range ThrottleStatuses() {
+		result.Observe(stats.Queued, label.String("class", class))
+	}
+}
+
+// ThrottleStats reports the load of an endpoint class. Queued is the number
+// of requests waiting for a slot.
+type ThrottleStats struct {
+	Concurrency int    `json:"concurrency"`
+	Active      int    `json:"active"`
+	Queued      int64  `json:"queued"`
+	Served      uint64 `json:"served"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+type throttle struct {
+	class string
+	cfg   xconfig.Throttle
+	slots chan struct{}
+
+	queued   int64
+	served   uint64
+	rejected uint64
+}
+
+func newThrottle(class string, cfg xconfig.Throttle) *throttle {
+	return &throttle{
+		class: class,
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.Concurrency),
+	}
+}
+
+// acquire takes a slot, waiting for at most MaxWait when all slots are taken.
+// Requests that don't fit into the queue are rejected right away.
+func (t *throttle) acquire(ctx context.Context) error {
+	select {
+	case t.slots <- struct{}{}:
+		atomic.AddUint64(&t.served, 1)
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&t.queued, 1) > int64(t.cfg.QueueSize) {
+		atomic.AddInt64(&t.queued, -1)
+		return t.reject(ctx)
+	}
+	defer atomic.AddInt64(&t.queued, -1)
+
+	timer := time.NewTimer(t.cfg.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case t.slots <- struct{}{}:
+		atomic.AddUint64(&t.served, 1)
+		return nil
+	case <-timer.C:
+		return t.reject(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *throttle) release() {
+	<-t.slots
+}
+
+func (t *throttle) reject(ctx context.Context) error {
+	atomic.AddUint64(&t.rejected, 1)
+	throttleRejected.Add(ctx, 1, label.String("class", t.class))
+	return apperr.New(apperr.Overloaded, "too many concurrent %s requests", t.class)
+}
+
+// retryAfter suggests to retry when the queued requests were served.
+func (t *throttle) retryAfter() string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(t.cfg.MaxWait.Seconds()))))
+}
+
+func (t *throttle) stats() *ThrottleStats {
+	return &ThrottleStats{
+		Concurrency: t.cfg.Concurrency,
+		Active:      len(t.slots),
+		Queued:      atomic.LoadInt64(&t.queued),
+		Served:      atomic.LoadUint64(&t.served),
+		Rejected:    atomic.LoadUint64(&t.rejected),
+	}
+}
+
+//------------------------------------------------------------------------------
+
+var (
+	throttleMu sync.RWMutex
+	throttles  map[string]*throttle
+)
+
+func init() {
+	SetThrottles(nil)
+	OnInit(func(ctx context.Context) {
+		SetThrottles(Config.Throttles)
+	})
+}
+
+// SetThrottles replaces the limits of endpoint classes. Zero fields and
+// missing classes use the defaults. Requests in flight keep their slots in
+// the replaced limits.
+func SetThrottles(m map[string]*xconfig.Throttle) {
+	list := make(map[string]*throttle, len(defaultThrottles))
+	for class, cfg := range defaultThrottles {
+		if override := m[class]; override != nil {
+			if override.Concurrency > 0 {
+				cfg.Concurrency = override.Concurrency
+			}
+			if override.QueueSize > 0 {
+				cfg.QueueSize = override.QueueSize
+			}
+			if override.MaxWait > 0 {
+				cfg.MaxWait = override.MaxWait
+			}
+		}
+		list[class] = newThrottle(class, cfg)
+	}
+
+	throttleMu.Lock()
+	throttles = list
+	throttleMu.Unlock()
+}
+
+func getThrottle(class string) *throttle {
+	throttleMu.RLock()
+	defer throttleMu.RUnlock()
+
+	t, ok := throttles[class]
+	if !ok {
+		panic("rwe: unknown throttle class " + strconv.Quote(class))
+	}
+	return t
+}
+
+// AcquireThrottle takes a slot of the endpoint class for work done outside of
+// ThrottleMiddleware. The caller must call release when the work is done.
+func AcquireThrottle(ctx context.Context, class string) (release func(), err error) {
+	t := getThrottle(class)
+	if err := t.acquire(ctx); err != nil {
+		return nil, err
+	}
+	return t.release, nil
+}
+
+// ThrottleMiddleware limits concurrent requests of the endpoint class and
+// responds with 503 Service Unavailable and Retry-After when it is saturated.
+func ThrottleMiddleware(class string) treemux.MiddlewareFunc {
+	getThrottle(class)
+
+	return func(next treemux.HandlerFunc) treemux.HandlerFunc {
+		return func(w http.ResponseWriter, req treemux.Request) error {
+			t := getThrottle(class)
+			if err := t.acquire(req.Context()); err != nil {
+				w.Header().Set("Retry-After", t.retryAfter())
+				return err
+			}
+			defer t.release()
+
+			return next(w, req)
+		}
+	}
+}
+
+// ThrottleStatuses returns the load of every endpoint class.
+func ThrottleStatuses() map[string]*ThrottleStats {
+	throttleMu.RLock()
+	defer throttleMu.RUnlock()
+
+	m := make(map[string]*ThrottleStats, len(throttles))
+	for class, t := range throttles {
+		m[class] = t.stats()
+	}
+	return m
+}
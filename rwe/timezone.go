@@ -0,0 +1,62 @@
+package rwe
+
+import (
+	"fmt"
+	"time"
+	// Time zones are validated against the IANA database embedded into the
+	// binary, so they don't depend on the tzdata installed on the host.
+	_ "time/tzdata"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// LoadLocation returns the IANA time zone with the name. Empty name is UTC.
+// Unlike time.LoadLocation it rejects "Local", which depends on the server.
+func LoadLocation(name string) (*time.Location, error) {
+	switch name {
+	case "", "UTC":
+		return time.UTC, nil
+	case "Local":
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// StartOfDay returns midnight of the day of t in loc. A day that starts with
+// a DST gap starts when the gap ends.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return wallTime(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// AddDays adds calendar days to t keeping the wall clock time in loc, so days
+// with a DST change are shorter or longer than 24 hours.
+func AddDays(t time.Time, days int, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return wallTime(t.Year(), t.Month(), t.Day()+days,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// wallTime is time.Date that moves wall clock times skipped by DST forward by
+// the length of the gap, e.g. 02:30 becomes 03:30 on the day clocks jump from
+// 02:00 to 03:00. Depending on the zone, time.Date moves them forward or back,
+// and back can be the previous day.
+func wallTime(
+	year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location,
+) time.Time {
+	t := time.Date(year, month, day, hour, min, sec, nsec, loc)
+	want := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+	got := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	if got.Before(want) {
+		return t.Add(want.Sub(got))
+	}
+	return t
+}
+
+// LocalDate converts the timestamptz column to the calendar date in loc,
+// e.g. to bucket stats by the days of the user. Postgres applies the DST
+// rules of the zone to each row.
+func LocalDate(column string, loc *time.Location) *orm.SafeQueryAppender {
+	return pg.SafeQuery("(? AT TIME ZONE ?)::date", pg.Ident(column), loc.String())
+}
@@ -0,0 +1,112 @@
+package rwe
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestWallTime(t *testing.T) {
+	tests := []struct {
+		zone string
+		wall string // requested wall clock time
+		want string // resolved time with the zone abbreviation
+	}{
+		// Spring gaps are skipped forward in zones both east and west of UTC.
+		{"Europe/Berlin", "2021-03-28 02:30", "2021-03-28 03:30 CEST"},
+		{"America/New_York", "2021-03-14 02:30", "2021-03-14 03:30 EDT"},
+		{"Australia/Sydney", "2021-10-03 02:30", "2021-10-03 03:30 AEDT"},
+		{"America/Sao_Paulo", "2018-11-04 00:00", "2018-11-04 01:00 -02"},
+		// Ambiguous fall times resolve like time.Date.
+		{"Europe/Berlin", "2021-10-31 02:30", "2021-10-31 02:30 CET"},
+		{"America/New_York", "2021-11-07 01:30", "2021-11-07 01:30 EDT"},
+		// Other times are unchanged.
+		{"Europe/Berlin", "2021-03-28 01:59", "2021-03-28 01:59 CET"},
+		{"America/New_York", "2021-03-14 03:00", "2021-03-14 03:00 EDT"},
+		{"UTC", "2021-03-28 02:30", "2021-03-28 02:30 UTC"},
+	}
+
+	for _, test := range tests {
+		loc := mustLoadLocation(t, test.zone)
+		w, err := time.Parse("2006-01-02 15:04", test.wall)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := wallTime(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc)
+		if s := got.Format("2006-01-02 15:04 MST"); s != test.want {
+			t.Errorf("%s %s: got %s, wanted %s", test.zone, test.wall, s, test.want)
+		}
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	tests := []struct {
+		zone string
+		t    string // UTC
+		want string
+	}{
+		{"Europe/Berlin", "2021-03-27T23:30:00Z", "2021-03-28 00:00 CET"},
+		{"Europe/Berlin", "2021-10-31T12:00:00Z", "2021-10-31 00:00 CEST"},
+		{"America/New_York", "2021-03-14T03:00:00Z", "2021-03-13 00:00 EST"},
+		{"America/New_York", "2021-11-07T12:00:00Z", "2021-11-07 00:00 EDT"},
+		// The day starts when the midnight gap ends.
+		{"Asia/Beirut", "2021-03-28T12:00:00Z", "2021-03-28 01:00 EEST"},
+		{"America/Sao_Paulo", "2018-11-04T12:00:00Z", "2018-11-04 01:00 -02"},
+	}
+
+	for _, test := range tests {
+		loc := mustLoadLocation(t, test.zone)
+		tm, err := time.Parse(time.RFC3339, test.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := StartOfDay(tm, loc).Format("2006-01-02 15:04 MST")
+		if got != test.want {
+			t.Errorf("%s %s: got %s, wanted %s", test.zone, test.t, got, test.want)
+		}
+	}
+}
+
+func TestAddDays(t *testing.T) {
+	tests := []struct {
+		zone string
+		t    string // UTC
+		days int
+		want string
+		dur  time.Duration
+	}{
+		{"Europe/Berlin", "2021-03-27T11:00:00Z", 1, "2021-03-28 12:00 CEST", 23 * time.Hour},
+		{"Europe/Berlin", "2021-10-30T10:00:00Z", 1, "2021-10-31 12:00 CET", 25 * time.Hour},
+		{"America/New_York", "2021-03-13T17:00:00Z", 1, "2021-03-14 12:00 EDT", 23 * time.Hour},
+		{"America/New_York", "2021-11-06T16:00:00Z", 1, "2021-11-07 12:00 EST", 25 * time.Hour},
+		{"America/New_York", "2021-11-07T17:00:00Z", -1, "2021-11-06 12:00 EDT", -25 * time.Hour},
+		// The wall clock time doesn't exist on the new day.
+		{"Europe/Berlin", "2021-03-27T01:30:00Z", 1, "2021-03-28 03:30 CEST", 24 * time.Hour},
+		{"America/New_York", "2021-03-13T07:30:00Z", 1, "2021-03-14 03:30 EDT", 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		loc := mustLoadLocation(t, test.zone)
+		tm, err := time.Parse(time.RFC3339, test.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := AddDays(tm, test.days, loc)
+		if s := got.Format("2006-01-02 15:04 MST"); s != test.want {
+			t.Errorf("%s %s %+d: got %s, wanted %s", test.zone, test.t, test.days, s, test.want)
+		}
+		if d := got.Sub(tm); d != test.dur {
+			t.Errorf("%s %s %+d: got %s later, wanted %s", test.zone, test.t, test.days, d, test.dur)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/sirupsen/logrus"
+	"github.com/uptrace/uptrace-go/metricexp"
 	"github.com/uptrace/uptrace-go/uptrace"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -43,6 +44,24 @@ func setupUptrace(ctx context.Context) error {
 		}
 	})
 
+	// Metrics like the exceeded latency budgets are only exported with a DSN.
+	if Config.Uptrace.DSN == "" {
+		return nil
+	}
+
+	ctrl, err := metricexp.InstallNewPipeline(ctx, &metricexp.Config{
+		DSN: Config.Uptrace.DSN,
+	})
+	if err != nil {
+		return err
+	}
+
+	OnExitSecondary(func(ctx context.Context) {
+		if err := ctrl.Stop(ctx); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("metrics controller Stop failed")
+		}
+	})
+
 	return nil
 }
 
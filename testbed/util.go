@@ -27,7 +27,7 @@ func ResetAll(ctx context.Context) {
 }
 
 func truncateDB(ctx context.Context) {
-	cmd := "TRUNCATE users, favorite_articles, follow_users, comments, articles, article_tags"
+	cmd := "TRUNCATE users, favorite_articles, follow_users, comments, articles, article_tags, subscriptions, appeals, favorite_tombstones, experiments, experiment_exposures, saved_searches, tag_rules, verification_requests, backfills, jobs"
 	_, err := rwe.PGMain().ExecContext(ctx, cmd)
 	Expect(err).NotTo(HaveOccurred())
 }
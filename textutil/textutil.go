@@ -0,0 +1,82 @@
+// Package textutil normalizes user supplied text before it is stored, so text
+// that looks the same is stored, compared, and searched the same way.
+package textutil
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"github.com/uptrace/go-realworld-example-app/apperr"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Len returns the number of user perceived characters, i.e. grapheme
+// clusters, so an emoji made of several code points counts as one.
+func Len(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
+
+// Normalize converts multi-line text to NFC, normalizes line endings to \n,
+// and removes control characters except newlines and tabs.
+func Normalize(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return normalize(s, func(r rune) rune {
+		switch r {
+		case '\n', '\t':
+			return r
+		case '\r':
+			return '\n'
+		}
+		return -1
+	})
+}
+
+// NormalizeLine is Normalize for single line text such as titles. Newlines
+// and tabs are replaced with spaces.
+func NormalizeLine(s string) string {
+	return normalize(s, func(r rune) rune {
+		switch r {
+		case '\n', '\r', '\t':
+			return ' '
+		}
+		return -1
+	})
+}
+
+func normalize(s string, control func(rune) rune) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return control(r)
+		}
+		return r
+	}, s)
+	return norm.NFC.String(s)
+}
+
+// Text normalizes the multi-line field in place and checks that it is at
+// most max characters long. Zero max only normalizes the field.
+func Text(field string, s *string, max int) error {
+	return check(field, s, Normalize, max)
+}
+
+// Line is Text for single line fields.
+func Line(field string, s *string, max int) error {
+	return check(field, s, NormalizeLine, max)
+}
+
+func check(field string, s *string, normalize func(string) string, max int) error {
+	// encoding/json replaces invalid UTF-8, but imports and query params
+	// can still contain it.
+	if !utf8.ValidString(*s) {
+		return apperr.Validation(field, "%s must be valid UTF-8", field)
+	}
+
+	*s = normalize(*s)
+
+	if max > 0 && Len(*s) > max {
+		return apperr.Validation(field, "%s must be at most %d characters long", field, max)
+	}
+	return nil
+}
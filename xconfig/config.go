@@ -2,15 +2,13 @@ package xconfig
 
 import (
 	"flag"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-
-	"gopkg.in/yaml.v2"
+	"time"
 )
 
 var (
-	envFlag    = flag.String("env", "dev", "environment, e.g. development or production")
+	envFlag    = flag.String("env", "dev", "config profile, e.g. dev, staging, or prod")
 	appDirFlag = flag.String("app_dir", "app", "path to the app dir")
 )
 
@@ -22,15 +20,104 @@ type Config struct {
 	RedisCache *RedisRing `yaml:"redis_cache"`
 	PGMain     *Postgres  `yaml:"pg_main"`
 
+	// Shadow mirrors writes to a secondary database while moving storage
+	// backends. It is disabled when the database is not set.
+	Shadow struct {
+		PG *Postgres `yaml:"pg"`
+		// CompareReads is the fraction of reads repeated on the secondary
+		// database to compare the number of returned rows.
+		CompareReads float64 `yaml:"compare_reads"`
+		// QueueSize is the number of queries waiting for the secondary
+		// database. Queries are dropped and counted when the queue is full.
+		QueueSize int `yaml:"queue_size"`
+	} `yaml:"shadow"`
+
 	Uptrace struct {
 		DSN string `yaml:"dsn"`
 	} `yaml:"uptrace"`
 
 	SecretKey string `yaml:"secret_key"`
+	SiteURL   string `yaml:"site_url"`
+
+	// Instance describes the deployment to clients, see GET /api/meta.
+	Instance struct {
+		Name        string `yaml:"name"`
+		Description string `yaml:"description"`
+		// Languages are content languages offered by clients. Empty list
+		// allows any ISO 639 language.
+		Languages []string `yaml:"languages"`
+	} `yaml:"instance"`
+
+	// SigningKeys are secrets of services that call internal routes, by key id.
+	SigningKeys map[string]string `yaml:"signing_keys"`
+	// AccountExportKey is the id of the signing key that signs account exports.
+	// Instances that accept the exports must have the same key.
+	AccountExportKey string `yaml:"account_export_key"`
+
+	SLO SLO `yaml:"slo"`
+
+	// Throttles override the limits of endpoint classes like search and
+	// export, by class name.
+	Throttles map[string]*Throttle `yaml:"throttles"`
+
+	Features        map[string]bool `yaml:"features"`
+	CountThresholds map[string]int  `yaml:"count_thresholds"`
+
+	// Public is the read-only mode for demo instances. Write endpoints are
+	// disabled and logged out clients read the API with anonymous tokens.
+	Public struct {
+		Enabled bool `yaml:"enabled"`
+		// AnonymousLimit is the number of requests per minute per client IP
+		// that reads the API with anonymous tokens.
+		AnonymousLimit int `yaml:"anonymous_limit"`
+	} `yaml:"public"`
+
+	JSON struct {
+		// Naming is either camelCase (default) or snake_case.
+		Naming    string `yaml:"naming"`
+		OmitNulls bool   `yaml:"omit_nulls"`
+	} `yaml:"json"`
+
+	// Retention overrides retention periods of the migrate_db purge command
+	// by retention name, e.g. hidden_comments: 720h.
+	Retention map[string]time.Duration `yaml:"retention"`
+
+	Tags struct {
+		MaxCount  int `yaml:"max_count"`
+		MaxLength int `yaml:"max_length"`
+	} `yaml:"tags"`
+
+	Comments struct {
+		// MaxDepth is the deepest reply level. Deeper replies are flattened.
+		MaxDepth int `yaml:"max_depth"`
+	} `yaml:"comments"`
+
+	Notifications struct {
+		// PollInterval is how often notification polls query the database.
+		// Polls are woken up right away by activity published to Redis, so
+		// the interval only bounds the delay of activity that is not
+		// published, e.g. saved search matches, or is lost while Redis is
+		// down.
+		PollInterval time.Duration `yaml:"poll_interval"`
+	} `yaml:"notifications"`
+
+	Articles struct {
+		// MetadataSchema is the path of the JSON Schema file, relative to the
+		// app dir, that validates article metadata. Empty path allows any
+		// metadata object.
+		MetadataSchema string `yaml:"metadata_schema"`
+	} `yaml:"articles"`
+
+	Feed struct {
+		// VerifiedBoost multiplies the engagement and affinity scores of
+		// articles by verified authors by 1 + VerifiedBoost. Zero disables
+		// the boost.
+		VerifiedBoost float64 `yaml:"verified_boost"`
+	} `yaml:"feed"`
 }
 
 func LoadConfig(service string) (*Config, error) {
-	return loadConfigEnv(service, *appDirFlag, *envFlag)
+	return loadConfigEnv(service, *appDirFlag, profileFromEnv(*envFlag))
 }
 
 func LoadConfigEnv(service, env string) (*Config, error) {
@@ -44,18 +131,19 @@ func loadConfigEnv(service, appDir, env string) (*Config, error) {
 	}
 
 	appDir = findAppDir(appDir, env)
-	f, err := os.Open(joinPath(appDir, env))
-	if err != nil {
+
+	// Later layers win: profile files, environment variables, and -set flags.
+	cfg := new(Config)
+	if err := loadProfile(cfg, appDir, env, nil); err != nil {
 		return nil, err
 	}
-
-	b, err := ioutil.ReadAll(f)
-	if err != nil {
+	if err := applyOverrides(cfg, envOverrides(os.Environ())); err != nil {
 		return nil, err
 	}
-
-	cfg, err := parseConfig(b)
-	if err != nil {
+	if err := applyOverrides(cfg, setFlag); err != nil {
+		return nil, err
+	}
+	if err := resolveSecrets(cfg); err != nil {
 		return nil, err
 	}
 
@@ -87,12 +175,3 @@ func findAppDir(appDir, env string) string {
 func joinPath(appDir, env string) string {
 	return filepath.Join(appDir, "config", env+".yml")
 }
-
-func parseConfig(b []byte) (*Config, error) {
-	cfg := new(Config)
-	err := yaml.Unmarshal(b, cfg)
-	if err != nil {
-		return nil, err
-	}
-	return cfg, nil
-}
@@ -26,6 +26,12 @@ type Postgres struct {
 	IdleTimeout  time.Duration `yaml:"idle_timeout"`
 
 	ConnectionPoolPort string `yaml:"connection_pool_port"`
+
+	// HealthCheckInterval is how often the pool is pinged and the host is
+	// resolved again. The pool is replaced after MaxFailures consecutive
+	// connection errors.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	MaxFailures         int           `yaml:"max_failures"`
 }
 
 func (cfg *Postgres) Options() *pg.Options {
@@ -0,0 +1,193 @@
+package xconfig
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts environment variables that override config values. Nested
+// keys are separated with double underscores, e.g. RWE_PG_MAIN__ADDR sets
+// pg_main.addr.
+const EnvPrefix = "RWE_"
+
+var setFlag overrideFlag
+
+func init() {
+	flag.Var(&setFlag, "set", "config override, e.g. -set pg_main.addr=db:5432 (repeatable)")
+}
+
+// profile is the part of a config file that is read before the config itself.
+type profile struct {
+	// Extends is the name of the profile the file is layered on, e.g. a
+	// staging.yml that only changes a few values of prod.yml.
+	Extends string `yaml:"extends"`
+}
+
+// loadProfile decodes the profile on top of cfg after its parent profiles, so
+// values of the most specific profile win.
+func loadProfile(cfg *Config, appDir, env string, chain []string) error {
+	for _, name := range chain {
+		if name == env {
+			return fmt.Errorf("config: profile %s extends itself: %s",
+				env, strings.Join(append(chain, env), " -> "))
+		}
+	}
+	chain = append(chain, env)
+
+	b, err := ioutil.ReadFile(joinPath(appDir, env))
+	if err != nil {
+		return err
+	}
+
+	var p profile
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return fmt.Errorf("config: profile %s: %w", env, err)
+	}
+
+	if p.Extends != "" {
+		if err := loadProfile(cfg, appDir, p.Extends, chain); err != nil {
+			return err
+		}
+	}
+
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return fmt.Errorf("config: profile %s: %w", env, err)
+	}
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// override sets the config value at the path of yaml keys.
+type override struct {
+	path  []string
+	value string
+}
+
+func parseOverride(s string) (override, error) {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return override{}, fmt.Errorf("config: override %q must look like key.path=value", s)
+	}
+	return override{
+		path:  strings.Split(s[:i], "."),
+		value: s[i+1:],
+	}, nil
+}
+
+type overrideFlag []override
+
+var _ flag.Value = (*overrideFlag)(nil)
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(s string) error {
+	o, err := parseOverride(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, o)
+	return nil
+}
+
+func envOverrides(environ []string) []override {
+	var list []override
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, EnvPrefix) {
+			continue
+		}
+
+		i := strings.IndexByte(kv, '=')
+		if i == -1 {
+			continue
+		}
+
+		key := strings.ToLower(kv[len(EnvPrefix):i])
+		if key == "env" {
+			continue // selects the profile, see profileFromEnv
+		}
+		list = append(list, override{
+			path:  strings.Split(key, "__"),
+			value: kv[i+1:],
+		})
+	}
+	return list
+}
+
+// applyOverrides decodes the values on top of cfg the same way config files
+// are decoded, so overrides accept durations, numbers, and lists.
+func applyOverrides(cfg *Config, list []override) error {
+	for _, o := range list {
+		doc, err := overrideDoc(o)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(doc, cfg); err != nil {
+			return fmt.Errorf("config: override %s: %w", strings.Join(o.path, "."), err)
+		}
+	}
+	return nil
+}
+
+// overrideDoc nests the value under the keys of the path. Numbers, booleans,
+// and lists are used verbatim so they can be decoded into strings as well.
+// Anything else is quoted, so characters like # and : are kept.
+func overrideDoc(o override) ([]byte, error) {
+	var b strings.Builder
+	for i, key := range o.path {
+		if i > 0 {
+			b.WriteString("\n")
+			b.WriteString(strings.Repeat("  ", i))
+		}
+		b.WriteString(key)
+		b.WriteString(":")
+	}
+
+	value := o.value
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil || !isVerbatim(v) {
+		quoted, err := yaml.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		value = strings.TrimSuffix(string(quoted), "\n")
+	}
+
+	b.WriteString(" ")
+	b.WriteString(value)
+	return []byte(b.String()), nil
+}
+
+func isVerbatim(v interface{}) bool {
+	switch v.(type) {
+	case bool, int, float64, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// profileFromEnv is the profile used when the -env flag is not set.
+func profileFromEnv(env string) string {
+	if s := os.Getenv(EnvPrefix + "ENV"); s != "" && !flagSet("env") {
+		return s
+	}
+	return env
+}
+
+func flagSet(name string) bool {
+	var found bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
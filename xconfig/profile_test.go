@@ -0,0 +1,158 @@
+package xconfig
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, profiles map[string]string) string {
+	appDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(appDir, "config"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for env, yml := range profiles {
+		if err := ioutil.WriteFile(joinPath(appDir, env), []byte(yml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return appDir
+}
+
+func TestLoadProfile(t *testing.T) {
+	profiles := map[string]string{
+		"prod":    "site_url: https://prod\nsecret_key: prod\n",
+		"staging": "extends: prod\nsite_url: https://staging\n",
+		"review":  "extends: staging\nsecret_key: review\n",
+		"broken":  "extends: missing\n",
+		"loop-a":  "extends: loop-b\n",
+		"loop-b":  "extends: loop-a\n",
+		"invalid": "site_url: [\n",
+	}
+	appDir := writeProfiles(t, profiles)
+
+	tests := []struct {
+		env       string
+		siteURL   string
+		secretKey string
+		err       string
+	}{
+		{env: "prod", siteURL: "https://prod", secretKey: "prod"},
+		{env: "staging", siteURL: "https://staging", secretKey: "prod"},
+		{env: "review", siteURL: "https://staging", secretKey: "review"},
+		{env: "missing", err: "no such file"},
+		{env: "broken", err: "no such file"},
+		{env: "loop-a", err: "profile loop-a extends itself: loop-a -> loop-b -> loop-a"},
+		{env: "invalid", err: "config: profile invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			cfg := new(Config)
+			err := loadProfile(cfg, appDir, test.env, nil)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, wanted %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.SiteURL != test.siteURL || cfg.SecretKey != test.secretKey {
+				t.Fatalf("got site_url=%q secret_key=%q, wanted %q and %q",
+					cfg.SiteURL, cfg.SecretKey, test.siteURL, test.secretKey)
+			}
+		})
+	}
+}
+
+func TestConfigOverlays(t *testing.T) {
+	appDir := writeProfiles(t, map[string]string{
+		"test": "site_url: https://file\nsecret_key: file\npg_main:\n  addr: file:5432\n",
+	})
+
+	tests := []struct {
+		name    string
+		environ map[string]string
+		set     []string
+		want    [3]string // site_url, secret_key, pg_main.addr
+	}{
+		{
+			name: "profile",
+			want: [3]string{"https://file", "file", "file:5432"},
+		},
+		{
+			name:    "env over profile",
+			environ: map[string]string{"RWE_SECRET_KEY": "env", "RWE_PG_MAIN__ADDR": "env:5432"},
+			want:    [3]string{"https://file", "env", "env:5432"},
+		},
+		{
+			name:    "set over env",
+			environ: map[string]string{"RWE_SECRET_KEY": "env", "RWE_PG_MAIN__ADDR": "env:5432"},
+			set:     []string{"pg_main.addr=set:5432", "site_url=https://set#1"},
+			want:    [3]string{"https://set#1", "env", "set:5432"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.environ {
+				if err := os.Setenv(k, v); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Unsetenv(k)
+			}
+
+			saved := setFlag
+			setFlag = nil
+			defer func() { setFlag = saved }()
+			for _, s := range test.set {
+				if err := setFlag.Set(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := loadConfigEnv("test", appDir, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := [3]string{cfg.SiteURL, cfg.SecretKey, cfg.PGMain.Addr}
+			if got != test.want {
+				t.Fatalf("got %q, wanted %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseOverride(t *testing.T) {
+	tests := []struct {
+		in   string
+		path string
+		err  bool
+	}{
+		{in: "pg_main.addr=db:5432", path: "pg_main.addr"},
+		{in: "site_url=", path: "site_url"},
+		{in: "=value", err: true},
+		{in: "site_url", err: true},
+	}
+
+	for _, test := range tests {
+		o, err := parseOverride(test.in)
+		if test.err {
+			if err == nil {
+				t.Fatalf("%q: expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %s", test.in, err)
+		}
+		if path := strings.Join(o.path, "."); path != test.path {
+			t.Fatalf("%q: got path %q, wanted %q", test.in, path, test.path)
+		}
+	}
+}
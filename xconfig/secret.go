@@ -0,0 +1,239 @@
+package xconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretDriver resolves secret references. A config value ${vault:path#field}
+// is passed to the vault driver as "path#field" and replaced with the result,
+// so secrets don't have to be stored in config files.
+type SecretDriver interface {
+	Secret(ref string) (string, error)
+}
+
+// SecretDriverFunc adapts a function to SecretDriver.
+type SecretDriverFunc func(ref string) (string, error)
+
+func (fn SecretDriverFunc) Secret(ref string) (string, error) {
+	return fn(ref)
+}
+
+var secretDrivers = struct {
+	sync.Mutex
+	m map[string]SecretDriver
+}{
+	m: map[string]SecretDriver{
+		"file":  SecretDriverFunc(fileSecret),
+		"env":   SecretDriverFunc(envSecret),
+		"vault": new(vaultDriver),
+	},
+}
+
+// RegisterSecretDriver makes the driver available as ${scheme:ref} in configs.
+// It must be called before the config is loaded.
+func RegisterSecretDriver(scheme string, driver SecretDriver) {
+	secretDrivers.Lock()
+	defer secretDrivers.Unlock()
+	secretDrivers.m[scheme] = driver
+}
+
+func secretDriver(scheme string) (SecretDriver, bool) {
+	secretDrivers.Lock()
+	defer secretDrivers.Unlock()
+	driver, ok := secretDrivers.m[scheme]
+	return driver, ok
+}
+
+// fileSecret reads secrets mounted as files, e.g. ${file:/run/secrets/pg}.
+func fileSecret(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func envSecret(name string) (string, error) {
+	s, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return s, nil
+}
+
+//------------------------------------------------------------------------------
+
+// resolveSecrets replaces secret references in all string values of cfg.
+func resolveSecrets(cfg *Config) error {
+	return walkStrings(reflect.ValueOf(cfg).Elem(), "", resolveSecret)
+}
+
+func resolveSecret(field, s string) (string, error) {
+	if !strings.HasPrefix(s, "${") || !strings.HasSuffix(s, "}") {
+		return s, nil
+	}
+
+	ref := s[2 : len(s)-1]
+	i := strings.IndexByte(ref, ':')
+	if i == -1 {
+		return "", fmt.Errorf("config: %s: secret reference %s has no scheme", field, s)
+	}
+
+	scheme := ref[:i]
+	driver, ok := secretDriver(scheme)
+	if !ok {
+		return "", fmt.Errorf("config: %s: unknown secret scheme %q", field, scheme)
+	}
+
+	secret, err := driver.Secret(ref[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("config: %s: %w", field, err)
+	}
+	return secret, nil
+}
+
+// walkStrings calls fn for every string reachable from v and stores the result.
+func walkStrings(v reflect.Value, field string, fn func(field, s string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return walkStrings(v.Elem(), field, fn)
+	case reflect.Struct:
+		typ := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if typ.Field(i).PkgPath != "" {
+				continue
+			}
+			if err := walkStrings(v.Field(i), joinField(field, typ.Field(i)), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", field, i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			s, err := fn(fmt.Sprintf("%s.%v", field, iter.Key()), iter.Value().String())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(s).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		s, err := fn(field, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	}
+	return nil
+}
+
+func joinField(prefix string, f reflect.StructField) string {
+	name := strings.ToLower(f.Name)
+	if tag := f.Tag.Get("yaml"); tag != "" {
+		name = strings.Split(tag, ",")[0]
+	}
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+//------------------------------------------------------------------------------
+
+// vaultDriver reads secrets from a Vault-style KV HTTP API at VAULT_ADDR with
+// the VAULT_TOKEN token. References look like secret/data/rwe#password.
+// Responses are cached, so fields of one secret are fetched only once.
+type vaultDriver struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+var _ SecretDriver = (*vaultDriver)(nil)
+
+func (d *vaultDriver) Secret(ref string) (string, error) {
+	i := strings.LastIndexByte(ref, '#')
+	if i == -1 {
+		return "", fmt.Errorf("vault reference %q must look like path#field", ref)
+	}
+	path, field := ref[:i], ref[i+1:]
+
+	data, err := d.secret(path)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string field %q", path, field)
+	}
+	return value, nil
+}
+
+func (d *vaultDriver) secret(path string) (map[string]interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if data, ok := d.secrets[path]; ok {
+		return data, nil
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault secret %s: %s", path, resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	data := body.Data
+	// KV version 2 nests the secret and returns its metadata next to it.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	if d.secrets == nil {
+		d.secrets = make(map[string]map[string]interface{})
+	}
+	d.secrets[path] = data
+	return data, nil
+}
@@ -0,0 +1,167 @@
+package xconfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pg")
+	if err := ioutil.WriteFile(path, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Setenv("RWE_TEST_SECRET", "from-env"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("RWE_TEST_SECRET")
+
+	RegisterSecretDriver("test", SecretDriverFunc(func(ref string) (string, error) {
+		if ref == "fail" {
+			return "", errors.New("driver failed")
+		}
+		return "test:" + ref, nil
+	}))
+
+	tests := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${unclosed", want: "${unclosed"},
+		{in: "${env:RWE_TEST_SECRET}", want: "from-env"},
+		{in: "${env:RWE_TEST_MISSING}", err: "config: field: environment variable RWE_TEST_MISSING is not set"},
+		{in: "${file:" + path + "}", want: "hunter2"},
+		{in: "${file:" + filepath.Join(dir, "missing") + "}", err: "no such file"},
+		{in: "${test:ref}", want: "test:ref"},
+		{in: "${test:fail}", err: "config: field: driver failed"},
+		{in: "${nope:ref}", err: `unknown secret scheme "nope"`},
+		{in: "${ref}", err: "has no scheme"},
+	}
+
+	for _, test := range tests {
+		got, err := resolveSecret("field", test.in)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: got error %v, wanted %q", test.in, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.in, err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got %q, wanted %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	RegisterSecretDriver("test", SecretDriverFunc(func(ref string) (string, error) {
+		return "test:" + ref, nil
+	}))
+
+	cfg := &Config{
+		SecretKey:   "${test:secret}",
+		PGMain:      &Postgres{Password: "${test:pg}"},
+		SigningKeys: map[string]string{"analytics": "${test:analytics}"},
+	}
+	cfg.Instance.Languages = []string{"${test:lang}"}
+
+	if err := resolveSecrets(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{cfg.SecretKey, cfg.PGMain.Password, cfg.SigningKeys["analytics"], cfg.Instance.Languages[0]}
+	want := []string{"test:secret", "test:pg", "test:analytics", "test:lang"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, wanted %q", got, want)
+		}
+	}
+
+	cfg.SigningKeys["broken"] = "${nope:ref}"
+	err := resolveSecrets(cfg)
+	if err == nil || !strings.Contains(err.Error(), "config: signing_keys.broken:") {
+		t.Fatalf("got error %v, wanted the field path", err)
+	}
+}
+
+func TestVaultDriver(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/secret/data/rwe":
+			_, _ = w.Write([]byte(`{"data": {"data": {"password": "pass", "port": 5432}, "metadata": {}}}`))
+		case "/v1/secret/rwe":
+			_, _ = w.Write([]byte(`{"data": {"password": "v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	for k, v := range map[string]string{"VAULT_ADDR": srv.URL + "/", "VAULT_TOKEN": "token"} {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Unsetenv(k)
+	}
+
+	d := new(vaultDriver)
+	tests := []struct {
+		ref  string
+		want string
+		err  string
+	}{
+		{ref: "secret/data/rwe#password", want: "pass"},
+		{ref: "secret/rwe#password", want: "v1"},
+		{ref: "secret/data/rwe#port", err: `has no string field "port"`},
+		{ref: "secret/data/rwe#missing", err: `has no string field "missing"`},
+		{ref: "secret/data/other#password", err: "404 Not Found"},
+		{ref: "secret/data/rwe", err: "must look like path#field"},
+	}
+
+	for _, test := range tests {
+		got, err := d.Secret(test.ref)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: got error %v, wanted %q", test.ref, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.ref, err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: got %q, wanted %q", test.ref, got, test.want)
+		}
+	}
+
+	// secret/data/rwe, secret/rwe, and secret/data/other; fields of a
+	// secret are read from the cache.
+	if requests != 3 {
+		t.Fatalf("got %d requests, wanted 3", requests)
+	}
+
+	if err := os.Unsetenv("VAULT_ADDR"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(vaultDriver).Secret("secret/data/rwe#password"); err == nil ||
+		err.Error() != "VAULT_ADDR is not set" {
+		t.Fatalf("got error %v, wanted VAULT_ADDR is not set", err)
+	}
+}
@@ -0,0 +1,26 @@
+package xconfig
+
+import "time"
+
+type SLO struct {
+	// BurnRate triggers the alert when the error budget is spent that many
+	// times faster than allowed, e.g. 14.4 spends 2% of a 30 day budget in an hour.
+	BurnRate   float64 `yaml:"burn_rate"`
+	WebhookURL string  `yaml:"webhook_url"`
+
+	Objectives []*Objective `yaml:"objectives"`
+}
+
+// Objective is the availability and latency target of the routes with the
+// path prefix.
+type Objective struct {
+	Name   string `yaml:"name"`
+	Prefix string `yaml:"prefix"`
+
+	// Availability is the share of requests that must not fail with 5xx.
+	Availability float64 `yaml:"availability"`
+
+	// LatencyTarget is the share of requests that must be faster than Latency.
+	Latency       time.Duration `yaml:"latency"`
+	LatencyTarget float64       `yaml:"latency_target"`
+}
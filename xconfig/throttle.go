@@ -0,0 +1,11 @@
+package xconfig
+
+import "time"
+
+// Throttle limits concurrent requests of an expensive endpoint class. Requests
+// over Concurrency wait in a queue of QueueSize requests for at most MaxWait.
+type Throttle struct {
+	Concurrency int           `yaml:"concurrency"`
+	QueueSize   int           `yaml:"queue_size"`
+	MaxWait     time.Duration `yaml:"max_wait"`
+}
@@ -0,0 +1,46 @@
+// Package xcontext declares context keys and typed accessors for values that
+// are shared by several packages.
+package xcontext
+
+import "context"
+
+// Key identifies a context value. Keys are package level variables created
+// with NewKey, and the owning package wraps them with typed getters and
+// setters instead of exposing the key.
+type Key struct {
+	name string
+}
+
+// NewKey returns a new key. The name is only used for debugging.
+func NewKey(name string) *Key {
+	return &Key{name: name}
+}
+
+func (k *Key) String() string {
+	return "xcontext." + k.name
+}
+
+// With returns a copy of ctx that carries the value.
+func (k *Key) With(ctx context.Context, value interface{}) context.Context {
+	return context.WithValue(ctx, k, value)
+}
+
+// Value returns the value stored in ctx or nil.
+func (k *Key) Value(ctx context.Context) interface{} {
+	return ctx.Value(k)
+}
+
+//------------------------------------------------------------------------------
+
+var requestIDKey = NewKey("request_id")
+
+// WithRequestID stores the id of the HTTP request that ctx belongs to.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return requestIDKey.With(ctx, id)
+}
+
+// RequestID returns the request id or an empty string outside of requests.
+func RequestID(ctx context.Context) string {
+	id, _ := requestIDKey.Value(ctx).(string)
+	return id
+}